@@ -7,35 +7,74 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 	"sort"
 
 	"github.com/armash/log-pipeline/internal/config"
+	"github.com/armash/log-pipeline/internal/decompress"
 	"github.com/armash/log-pipeline/internal/engine"
+	"github.com/armash/log-pipeline/internal/index"
 	"github.com/armash/log-pipeline/internal/ingest"
+	"github.com/armash/log-pipeline/internal/objstore"
 	"github.com/armash/log-pipeline/internal/query"
+	"github.com/armash/log-pipeline/internal/report"
 	"github.com/armash/log-pipeline/internal/server"
 	"github.com/armash/log-pipeline/internal/shard"
+	"github.com/armash/log-pipeline/internal/sink"
 	"github.com/armash/log-pipeline/internal/snapshot"
 	"github.com/armash/log-pipeline/internal/store"
+	"github.com/armash/log-pipeline/internal/types"
 )
 
 func main() {
 	file := flag.String("file", "samples/sample.log", "path to log file")
 	level := flag.String("level", "", "filter by level (ERROR, WARN, INFO, DEBUG)")
+	minLevel := flag.String("min-level", "", "filter by minimum severity (e.g. WARN keeps WARN and ERROR)")
+	dedupKey := flag.String("dedup-key", "timestamp,level,message", "comma-separated fields that identify duplicate entries (timestamp, level, message, field.<key>)")
+	unknownLevelRank := flag.String("unknown-level-rank", "lowest", "severity rank for unrecognized levels: lowest, highest, or a level name")
 	since := flag.String("since", "", "filter entries newer than duration (e.g. 10m, 1h)")
 	search := flag.String("search", "", "filter by substring in message (case-insensitive)")
 	jsonOut := flag.Bool("json", false, "output as JSON instead of text")
+	head := flag.Int("head", 0, "show the first N entries of the sorted filtered set (with --limit, the smaller wins)")
+	tailN := flag.Int("tail-n", 0, "show the last N entries of the sorted filtered set (with --limit, the smaller wins; unrelated to --tail)")
 	limit := flag.Int("limit", 0, "limit output to N entries (0 = no limit)")
 	output := flag.String("output", "", "save output to file (e.g. results.json, results.txt)")
 	tail := flag.Bool("tail", false, "stream new entries as the file grows")
 	tailFromStart := flag.Bool("tail-from-start", false, "when tailing, start from beginning instead of end")
 	tailPoll := flag.Duration("tail-poll", 500*time.Millisecond, "when tailing, poll interval (e.g. 250ms, 1s)")
-	format := flag.String("format", "plain", "log format: plain, json, logfmt, auto")
+	shardDedup := flag.Bool("shard-dedup", false, "with --shard-read, drop entries that overlapping shards hold more than once (by --dedup-key) and report how many")
+	numericIndex := flag.String("numeric-index", "", "with --index, also keep this entry field sorted by numeric value so field.<name> >, >=, < and <= filters use binary search")
+	namedQuery := flag.String("named-query", "", "run the query with this name from the config's \"queries\" catalog, ANDed with --query, --query-file and the other filters")
+	baselinePath := flag.String("baseline", "", "compare this run's per-level match counts with the history in this JSON file and flag anomalies in the metrics")
+	updateBaseline := flag.Bool("update-baseline", false, "with --baseline, add this run's counts to the baseline file")
+	var queryFiles listFlag
+	flag.Var(&queryFiles, "query-file", "read the query DSL from this file (repeatable): lines are ANDed (write OR to combine), blank lines and # comments are ignored")
+	queryCombine := flag.String("query-combine", "and", "how several --query-file filters combine: and, or")
+	stampIngest := flag.Bool("stamp-ingest", false, "record when each entry was parsed as \"ingestedAt\" (JSON output, store, shards), to measure ingest lag")
+	strictStore := flag.Bool("strict-store", false, "refuse to start when --store or a --shard-dir shard exists but its first lines are not JSONL entries (default: warn)")
+	progressFlag := flag.Bool("progress", false, "show files loaded and entries read on stderr while loading shards (only on a terminal; off with --quiet)")
+	periodicTZ := flag.String("periodic-tz", "Local", "time zone for the dow= and hourofday= query filters: an IANA name, UTC, or Local")
+	canonicalize := flag.String("canonicalize", "", "rewrite --file (any supported --format) to this JSONL file with UTC RFC3339 timestamps and upper-case levels, then exit")
+	partialIndex := flag.Bool("partial-index", false, "with --snapshot-load, rebuild only the snapshot index buckets for the query's time range")
+	fieldsInMessage := flag.String("fields-in-message", "", "comma-separated JSON/logfmt keys to append to each message as [key=value ...]")
+	exitBySeverity := flag.Bool("exit-by-severity", false, "exit with a code for the most severe matching entry (see --severity-exit-codes)")
+	severityExitCodes := flag.String("severity-exit-codes", defaultSeverityExitCodes, "LEVEL=code pairs for --exit-by-severity; an entry maps to the code of the highest listed level at or below its severity")
+	skipPartialLine := flag.Bool("skip-partial-line", false, "leave out a last line with no trailing newline (a file still being written) instead of parsing it")
+	sinkSpec := flag.String("sink", "", "also send matched entries to this sink: stdout, a file path to append to, or an http(s):// URL that receives NDJSON batches")
+	tailSince := flag.Duration("tail-since", 0, "when tailing, first print existing entries from this far back (e.g. 5m), then follow")
+	tailTimeout := flag.Duration("tail-timeout", 0, "when tailing, exit after this long without new lines (e.g. 30s; 0 = never)")
+	format := flag.String("format", "plain", "log format: plain, json, logfmt, glog, auto")
 	storePath := flag.String("store", "", "append ingested entries to a JSONL store file")
 	loadPath := flag.String("load", "", "load entries from a JSONL store file instead of --file")
 	useIndex := flag.Bool("index", false, "build in-memory indexes to speed up filtering")
@@ -50,14 +89,64 @@ func main() {
 	configPath := flag.String("config", "", "load settings from a JSON config file")
 	metricsFlag := flag.Bool("metrics", false, "print ingestion/query metrics")
 	metricsFile := flag.String("metrics-file", "", "write metrics to a file (text)")
+	metricsJSON := flag.Bool("metrics-json", false, "print metrics (and write --metrics-file) as one JSON object instead of key=value lines")
 	serve := flag.Bool("serve", false, "run HTTP server mode")
 	port := flag.Int("port", 8080, "server port for --serve")
+	host := flag.String("host", "", "server bind host for --serve, e.g. 127.0.0.1 for local-only (default all interfaces)")
 	shardDir := flag.String("shard-dir", "", "write daily JSONL shards to this directory")
 	shardRead := flag.Bool("shard-read", false, "read entries from shards in --shard-dir instead of --file")
 	apiKey := flag.String("api-key", "", "API key required for POST /ingest")
+	mergeSnapshots := flag.String("merge-snapshots", "", "comma-separated snapshot files to merge into --snapshot")
+	compression := flag.String("compression", "auto", "input compression: auto (by extension), none, gzip, bzip2, zstd")
+	reportFlag := flag.Bool("report", false, "print the top WARN/ERROR message patterns (numbers and IDs masked) with counts and first/last seen, then exit")
+	compare := flag.String("compare", "", "run the filters against this JSONL file too and print entries found only in the primary source, only in the other file, and the common count")
+	distinctMessages := flag.Bool("distinct-messages", false, "print each distinct message in the filtered set once with its count and first/last seen, then exit")
+	reportTop := flag.Int("report-top", 10, "number of patterns shown by --report (0 = all)")
+	defaultLimit := flag.Int("default-limit", 0, "serve mode: limit applied to /query requests without one (0 = unlimited)")
+	maxIOConcurrency := flag.Int("max-io-concurrency", 0, "serve mode: max concurrent disk-reading requests (/raw, UI files); extra ones get 503 (0 = unlimited)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", server.DefaultShutdownTimeout, "serve mode: how long in-flight requests get to finish after Ctrl+C before the server stops")
+	listenAddr := flag.String("listen", "", "serve mode: listen address instead of --port, e.g. unix:/tmp/logpipe.sock")
+	maxLimit := flag.Int("max-limit", 0, "serve mode: cap on any /query limit, including limit=0; clamped responses set X-Limit-Clamped (0 = no cap)")
+	uiBasePath := flag.String("ui-base-path", server.DefaultUIBasePath, "path the web UI is served under (e.g. /logs/ behind a reverse proxy)")
+	tailAlertFile := flag.String("tail-alert-file", "", "when tailing, also append entries at or above --tail-alert-level to this JSONL file")
+	tailAlertLevel := flag.String("tail-alert-level", "ERROR", "minimum level written to --tail-alert-file")
+	noSkipMalformed := flag.Bool("no-skip-malformed", false, "report lines that fail to parse (count plus the first few with line numbers); they are still skipped")
+	exprStr := flag.String("expr", "", `boolean expression over level/message/timestamp, e.g. 'len(message) > 100 and level == "ERROR"'`)
+	shardSorted := flag.Bool("shard-sorted", false, "keep each day shard sorted by time on append (rewrites a shard when older entries arrive)")
+	watch := flag.Bool("watch", false, "re-run the query and redraw whenever the source changes")
+	watchInterval := flag.Duration("watch-interval", 2*time.Second, "how often --watch checks the source for changes")
+	coalesceFields := flag.Bool("coalesce-fields", false, "join repeated logfmt/JSON keys with ',' instead of keeping the last value")
+	utc := flag.Bool("utc", false, "convert parsed and loaded timestamps to UTC before storing, indexing and printing")
+	keepRaw := flag.Bool("keep-raw", false, "keep each original input line on the entry (stored as \"raw\" in JSONL; costs memory)")
+	indexStats := flag.Bool("index-stats", false, "print index bucket sizes and time span, then exit")
+	levelsReport := flag.Bool("normalize-levels-report", false, "print every distinct raw level value with counts (to plan --level-map), then exit")
+	batchSize := flag.Int("batch-size", 0, "with --load or --shard-read, filter the store in batches of N entries and print matches as they are found")
+	defaultLevel := flag.String("default-level", "", "assign this level to JSON/logfmt lines without one (default: skip them)")
+	missingTS := flag.String("missing-ts", "drop", "lines without a timestamp: now (ingest time), previous (previous entry's timestamp), or drop")
+	maxMemoryEntries := flag.Int("max-memory-entries", 0, "in --serve mode, keep at most N entries in memory, evicting the oldest (0 = unbounded)")
+	outputAppend := flag.Bool("output-append", false, "append to --output instead of overwriting (text output)")
+	compact := flag.Bool("compact", false, "de-duplicate and sort every shard in --shard-dir")
+	compactWorkers := flag.Int("compact-workers", 2, "number of shards to compact concurrently")
+	shardCompress := flag.Bool("shard-compress", false, "write new day shards gzip-compressed as .jsonl.gz (both forms are always readable)")
+	bloom := flag.Bool("bloom", false, "write a bloom filter of message trigrams beside each day shard so --shard-read searches can skip shards without the term")
+	verifyShards := flag.Bool("verify-shards", false, "check that every entry in --shard-dir sits in the shard named for its UTC day")
+	snapshotFiltered := flag.Bool("snapshot-filtered", false, "with --snapshot, write only the entries matching the filters and record the query in the snapshot")
+	replayDedup := flag.Bool("replay-dedup", false, "with --replay, skip parsed entries already in the store (by --dedup-key) instead of keeping and storing them twice")
+	validateJSONL := flag.String("validate-jsonl", "", "check that every line of this JSONL file is a valid entry; prints counts and the first invalid lines, exits 1 if any")
+	importJSONL := flag.String("import-jsonl", "", "backfill a JSONL file into --shard-dir day shards, skipping entries already present")
+	cpuProfile := flag.String("cpuprofile", "", "write a CPU profile to this file")
+	memProfile := flag.String("memprofile", "", "write a heap profile to this file on exit")
+	levelMapSpec := flag.String("level-map", "", "remap parsed levels, e.g. \"10=DEBUG,20=INFO,30=WARN,40=ERROR\"")
+	sinceFile := flag.String("since-file", "", "cursor file: only process entries after its timestamp, then update it")
+	timeTolerance := flag.String("time-tolerance", "", "widen after/before bounds by this duration for clock skew (e.g. 1s, 500ms)")
+	splitByLevel := flag.String("split-by-level", "", "write filtered entries to <dir>/<LEVEL>.jsonl files")
+	apiKeyFile := flag.String("api-key-file", "", "read the API key from a file (overrides LOGPIPE_API_KEY and --api-key)")
 	cleanup := flag.Bool("cleanup", false, "apply retention cleanup on shard directory")
 	cleanupDryRun := flag.Bool("cleanup-dry-run", false, "show what would be deleted without deleting")
 	cleanupConfirm := flag.Bool("cleanup-confirm", false, "confirm deletion for cleanup")
+	maxEntries := flag.Int("max-entries", 0, "stop reading input after N parsed entries (0 = no cap)")
+	planOnly := flag.Bool("plan-only", false, "print the query plan and exit without loading entries")
+	sortOrder := flag.String("sort", "", "sort entries by time: time-asc, time-desc (default: input order)")
 	flag.Parse()
 
 	runStart := time.Now()
@@ -66,12 +155,30 @@ func main() {
 		setFlags[f.Name] = true
 	})
 
+	var namedQueries map[string]string
 	if *configPath != "" {
 		cfg, err := config.Load(*configPath)
 		if err != nil {
 			log.Fatalf("failed to load config: %v", err)
 		}
-		applyConfig(cfg, setFlags, file, level, since, search, jsonOut, limit, output, tail, tailFromStart, tailPoll, format, storePath, loadPath, useIndex, quiet, storeHeader, queryStr, explain, replay, snapshotPath, snapshotLoad, retention, metricsFlag, metricsFile, serve, port, shardDir, shardRead, apiKey, cleanup, cleanupDryRun, cleanupConfirm)
+		namedQueries = cfg.Queries
+		applyConfig(cfg, setFlags, file, level, since, search, jsonOut, limit, output, tail, tailFromStart, tailPoll, format, storePath, loadPath, useIndex, quiet, storeHeader, queryStr, explain, replay, snapshotPath, snapshotLoad, retention, metricsFlag, metricsFile, serve, port, shardDir, shardRead, apiKey, cleanup, cleanupDryRun, cleanupConfirm, maxEntries, sortOrder, planOnly, apiKeyFile, mergeSnapshots, minLevel, unknownLevelRank, splitByLevel, timeTolerance, sinceFile, levelMapSpec, cpuProfile, memProfile, compact, compactWorkers, outputAppend, maxMemoryEntries, defaultLevel, batchSize, tailTimeout, indexStats, compression, coalesceFields, watch, watchInterval, shardSorted, exprStr, noSkipMalformed, tailAlertFile, tailAlertLevel, uiBasePath, reportFlag, reportTop, defaultLimit, maxLimit, keepRaw, importJSONL, listenAddr, dedupKey, metricsJSON, verifyShards, shardCompress, distinctMessages, host, utc, compare, maxIOConcurrency, head, tailN, bloom, levelsReport, missingTS, shutdownTimeout, validateJSONL, snapshotFiltered, replayDedup, tailSince, sinkSpec, skipPartialLine, exitBySeverity, severityExitCodes, fieldsInMessage, partialIndex, canonicalize, periodicTZ, progressFlag, strictStore, stampIngest, &queryFiles, queryCombine, baselinePath, updateBaseline, namedQuery, shardDedup, numericIndex)
+	}
+
+	stopProfiles, err := startProfiles(*cpuProfile, *memProfile)
+	if err != nil {
+		log.Fatalf("failed to start profiling: %v", err)
+	}
+	defer stopProfiles()
+	if (*cpuProfile != "" || *memProfile != "") && !*serve && !*tail {
+		// serve and tail handle interrupts themselves and return normally.
+		go func() {
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, os.Interrupt)
+			<-sigs
+			stopProfiles()
+			os.Exit(130)
+		}()
 	}
 
 	if *shardRead && *shardDir == "" {
@@ -80,8 +187,112 @@ func main() {
 	if *cleanup && *shardDir == "" {
 		log.Fatalf("--cleanup requires --shard-dir")
 	}
+	if *compact && *shardDir == "" {
+		log.Fatalf("--compact requires --shard-dir")
+	}
+	if *importJSONL != "" && *shardDir == "" {
+		log.Fatalf("--import-jsonl requires --shard-dir")
+	}
+	if *head < 0 || *tailN < 0 {
+		log.Fatalf("--head and --tail-n must not be negative")
+	}
+	if *head > 0 && *tailN > 0 {
+		log.Fatalf("--head and --tail-n cannot be combined")
+	}
+	if *verifyShards && *shardDir == "" {
+		log.Fatalf("--verify-shards requires --shard-dir")
+	}
+	// Object-store shard dirs are read-only: shards are only ever loaded from them.
+	writableShardDir := *shardDir
+	if objstore.IsURL(*shardDir) {
+		if !*shardRead || *cleanup || *compact || *importJSONL != "" || *verifyShards || *watch {
+			log.Fatalf("an s3:// --shard-dir is read-only and only supports --shard-read")
+		}
+		writableShardDir = ""
+	}
+	dedup, err := types.ParseDedupKey(*dedupKey)
+	if err != nil {
+		log.Fatalf("invalid --dedup-key: %v", err)
+	}
+	shardOpts := store.ShardOptions{Sorted: *shardSorted, Compress: *shardCompress, Bloom: *bloom}
+
+	if *watch {
+		if *tail || *serve {
+			log.Fatalf("--watch cannot be combined with --tail or --serve")
+		}
+		if (*storePath != "" && *loadPath == "") || *snapshotPath != "" || *outputAppend || *sinceFile != "" {
+			log.Fatalf("--watch only re-runs read-only queries; drop --store, --snapshot, --output-append, and --since-file")
+		}
+		if *watchInterval <= 0 {
+			log.Fatalf("--watch-interval must be positive")
+		}
+	}
 
-	if *loadPath == "" && *snapshotLoad == "" && !*shardRead {
+	if *mergeSnapshots != "" && *snapshotPath == "" {
+		log.Fatalf("--merge-snapshots requires --snapshot")
+	}
+	if *partialIndex && (*snapshotLoad == "" || *serve || *indexStats || *levelsReport) {
+		log.Fatalf("--partial-index requires --snapshot-load and cannot be combined with --serve, --index-stats or --normalize-levels-report")
+	}
+	var exitCodes []severityExit
+	if *exitBySeverity {
+		if *tail || *watch || *serve || *batchSize > 0 {
+			log.Fatalf("--exit-by-severity cannot be combined with --tail, --watch, --serve or --batch-size")
+		}
+		codes, err := parseSeverityExitCodes(*severityExitCodes)
+		if err != nil {
+			log.Fatalf("invalid --severity-exit-codes: %v", err)
+		}
+		exitCodes = codes
+	}
+	if *baselinePath != "" && (*tail || *serve || *batchSize > 0) {
+		log.Fatalf("--baseline cannot be combined with --tail, --serve or --batch-size")
+	}
+	if *updateBaseline && *baselinePath == "" {
+		log.Fatalf("--update-baseline requires --baseline")
+	}
+	if *tailSince != 0 && !*tail {
+		log.Fatalf("--tail-since requires --tail")
+	}
+	if *replayDedup && (!*replay || *storePath == "") {
+		log.Fatalf("--replay-dedup requires --replay and --store")
+	}
+	if *shardDedup && !*shardRead {
+		log.Fatalf("--shard-dedup requires --shard-read")
+	}
+	if *numericIndex != "" && !*useIndex {
+		log.Fatalf("--numeric-index requires --index")
+	}
+	if *canonicalize != "" && (*tail || *watch || *serve) {
+		log.Fatalf("--canonicalize cannot be combined with --tail, --watch or --serve")
+	}
+	if *snapshotFiltered && (*snapshotPath == "" || *mergeSnapshots != "") {
+		log.Fatalf("--snapshot-filtered requires --snapshot and cannot be combined with --merge-snapshots")
+	}
+
+	// Check what runs that append to the store or to day shards would append to.
+	var appendTargets []string
+	if *storePath != "" {
+		appendTargets = append(appendTargets, *storePath)
+	}
+	if writableShardDir != "" && (!*shardRead || *serve) && !*verifyShards && !*cleanup {
+		paths, err := shard.AllShardPaths(writableShardDir)
+		if err != nil {
+			log.Fatalf("failed to list shards: %v", err)
+		}
+		appendTargets = append(appendTargets, paths...)
+	}
+	if problems := checkAppendTargets(appendTargets); len(problems) > 0 {
+		if *strictStore {
+			for _, p := range problems {
+				log.Printf("error: %s", p)
+			}
+			log.Fatalf("--strict-store: refusing to append to a file that does not look like a JSONL store; fix the path or move the file aside")
+		}
+		printWarnings(problems)
+	}
+
+	if *loadPath == "" && *snapshotLoad == "" && !*shardRead && !*planOnly && *mergeSnapshots == "" && !*compact && *importJSONL == "" && !*verifyShards && *validateJSONL == "" {
 		if _, err := os.Stat(*file); err != nil {
 			if os.IsNotExist(err) {
 				log.Fatalf("file not found: %s\nHint: check the path or run with the sample file: --file samples\\sample.log", *file)
@@ -128,13 +339,153 @@ func main() {
 		return
 	}
 
+	if *compact {
+		paths, err := shard.AllShardPaths(*shardDir)
+		if err != nil {
+			log.Fatalf("failed to list shards: %v", err)
+		}
+		results, err := store.CompactShards(paths, *compactWorkers, dedup, shardOpts)
+		if err != nil {
+			log.Fatalf("compaction failed: %v", err)
+		}
+		printCompactResults(results)
+		return
+	}
+
+	if *validateJSONL != "" {
+		res, err := store.ValidateJSONL(*validateJSONL, 5)
+		if err != nil {
+			log.Fatalf("failed to validate %s: %v", *validateJSONL, err)
+		}
+		printValidation(*validateJSONL, res, *jsonOut)
+		if res.Invalid > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *verifyShards {
+		paths, err := shard.AllShardPaths(*shardDir)
+		if err != nil {
+			log.Fatalf("failed to list shards: %v", err)
+		}
+		checks := make([]store.ShardCheck, 0, len(paths))
+		for _, p := range paths {
+			check, err := store.VerifyShard(p)
+			if err != nil {
+				log.Fatalf("failed to verify %s: %v", p, err)
+			}
+			checks = append(checks, check)
+		}
+		if printShardChecks(checks) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *importJSONL != "" {
+		entries, err := store.LoadJSONL(*importJSONL)
+		if err != nil {
+			log.Fatalf("failed to read %s: %v", *importJSONL, err)
+		}
+		results, err := store.ImportShards(*shardDir, entries, dedup, shardOpts)
+		if err != nil {
+			log.Fatalf("import failed: %v", err)
+		}
+		printImportResults(*importJSONL, len(entries), results)
+		return
+	}
+
+	if *mergeSnapshots != "" {
+		paths := splitList(*mergeSnapshots)
+		merged, sources, err := snapshot.Merge(paths, dedup)
+		if err != nil {
+			log.Fatalf("failed to merge snapshots: %v", err)
+		}
+		if err := snapshot.Create(*snapshotPath, merged, sources); err != nil {
+			log.Fatalf("failed to write snapshot: %v", err)
+		}
+		fmt.Printf("Merged %d snapshot(s) into %s (%d entries)\n", len(paths), *snapshotPath, len(merged))
+		return
+	}
+
 	parsedFormat, err := parseFormat(*format)
 	if err != nil {
 		log.Fatalf("invalid --format: %v", err)
 	}
+	parsedSort, err := parseSort(*sortOrder)
+	if err != nil {
+		log.Fatalf("invalid --sort: %v", err)
+	}
+	parsedCompression, err := decompress.Parse(*compression)
+	if err != nil {
+		log.Fatalf("invalid --compression: %v", err)
+	}
+	levelMap, err := ingest.ParseLevelMap(*levelMapSpec)
+	if err != nil {
+		log.Fatalf("invalid --level-map: %v", err)
+	}
+	parsedMissingTS, err := ingest.ParseMissingTimestamp(*missingTS)
+	if err != nil {
+		log.Fatalf("invalid --missing-ts: %v", err)
+	}
+	messageFields := splitList(*fieldsInMessage)
+
+	if *canonicalize != "" {
+		entries, stats, err := ingest.ReadLogFileWithOptions(*file, ingest.ReadOptions{
+			Format:           parsedFormat,
+			LevelMap:         levelMap,
+			DefaultLevel:     *defaultLevel,
+			Compression:      parsedCompression,
+			CoalesceFields:   *coalesceFields,
+			KeepRaw:          *keepRaw,
+			MaxParseErrors:   malformedExamples,
+			MissingTimestamp: parsedMissingTS,
+			SkipPartialLine:  *skipPartialLine,
+		})
+		if err != nil {
+			log.Fatalf("failed to read %s: %v", *file, err)
+		}
+		ingest.Canonicalize(entries)
+		if err := store.WriteJSONL(*canonicalize, entries); err != nil {
+			log.Fatalf("failed to write %s: %v", *canonicalize, err)
+		}
+		printCanonicalize(*file, *canonicalize, stats, len(entries))
+		return
+	}
+
+	unknownRank, err := query.ParseUnknownLevelRank(*unknownLevelRank)
+	if err != nil {
+		log.Fatalf("invalid --unknown-level-rank: %v", err)
+	}
+	periodicZone, err := query.ParsePeriodicZone(*periodicTZ)
+	if err != nil {
+		log.Fatalf("invalid --periodic-tz: %v", err)
+	}
+	queryOpts := query.Options{UnknownLevelRank: unknownRank, Zone: periodicZone}
+	if *minLevel != "" {
+		if err := query.CheckLevel(*minLevel); err != nil {
+			log.Fatalf("invalid --min-level: %v", err)
+		}
+	}
 
 	filters := query.BuildFilters(*level, cutoff, *search)
-	if *queryStr != "" {
+	filters.MinLevel = *minLevel
+	if len(queryFiles) > 0 {
+		if *queryStr != "" {
+			log.Fatalf("--query-file and --query cannot be combined")
+		}
+		qf, err := loadQueryFiles(queryFiles, *queryCombine)
+		if err != nil {
+			log.Fatalf("invalid --query-file: %v", err)
+		}
+		merged, err := query.MergeFilters(filters, qf)
+		if err != nil {
+			log.Fatalf("invalid --query-file: %v", err)
+		}
+		filters = merged
+		*queryStr = qf.String()
+	} else if *queryStr != "" {
 		qf, err := query.Parse(*queryStr)
 		if err != nil {
 			log.Fatalf("invalid --query: %v", err)
@@ -145,9 +496,58 @@ func main() {
 		}
 		filters = merged
 	}
+	if *namedQuery != "" {
+		nq, err := resolveNamedQuery(namedQueries, *namedQuery)
+		if err != nil {
+			log.Fatalf("invalid --named-query: %v", err)
+		}
+		combined, err := query.AndFilters(filters, nq)
+		if err != nil {
+			log.Fatalf("invalid --named-query: %v", err)
+		}
+		filters = combined
+		if *queryStr == "" {
+			*queryStr = nq.String()
+		}
+	}
+	if *exprStr != "" {
+		x, err := query.CompileExpr(*exprStr)
+		if err != nil {
+			log.Fatalf("invalid --expr: %v", err)
+		}
+		// Expr goes on the base side so MergeFilters copies it into any OR branches.
+		merged, err := query.MergeFilters(query.Filters{Expr: x}, filters)
+		if err != nil {
+			log.Fatalf("invalid --expr: %v", err)
+		}
+		filters = merged
+	}
+	if *sinceFile != "" {
+		merged, err := applyCursor(filters, *sinceFile)
+		if err != nil {
+			log.Fatalf("invalid --since-file: %v", err)
+		}
+		filters = merged
+	}
+	if *timeTolerance != "" {
+		d, err := parseFlexibleDuration(*timeTolerance)
+		if err != nil {
+			log.Fatalf("invalid --time-tolerance value: %v", err)
+		}
+		filters = query.WidenBounds(filters, d)
+	}
+
+	filters = filters.WithOptions(queryOpts)
 
+	if *planOnly {
+		printPlan(buildQueryPlan(filters, *queryStr, *useIndex))
+		return
+	}
+
+	// A server started from a snapshot also loads the live shards it ingests into.
+	readShards := *shardRead || (*serve && *snapshotLoad != "" && *shardDir != "")
 	var shardPaths []string
-	if *shardRead {
+	if readShards {
 		if !filters.After.IsZero() || !filters.Before.IsZero() {
 			shardPaths = shard.ShardPathsForRange(*shardDir, filters.After, filters.Before)
 		} else {
@@ -158,30 +558,93 @@ func main() {
 			shardPaths = paths
 		}
 	}
+	var progress *progressLine
+	var loadProgress store.ProgressFunc
+	if *progressFlag && !*quiet && isTerminal(os.Stderr) {
+		progress = &progressLine{}
+		loadProgress = progress.update
+	}
 
 	if *serve {
+		resolvedKey, err := resolveAPIKey(*apiKey, *apiKeyFile)
+		if err != nil {
+			log.Fatalf("invalid API key: %v", err)
+		}
+		if *defaultLimit < 0 || *maxLimit < 0 {
+			log.Fatalf("--default-limit and --max-limit must not be negative")
+		}
+		if *maxIOConcurrency < 0 {
+			log.Fatalf("--max-io-concurrency must not be negative")
+		}
+		if *shutdownTimeout <= 0 {
+			log.Fatalf("--shutdown-timeout must be positive")
+		}
+		addr, err := serveAddr(*host, *port, *listenAddr)
+		if err != nil {
+			log.Fatalf("invalid listen address: %v", err)
+		}
+		basePath, err := server.NormalizeUIBasePath(*uiBasePath)
+		if err != nil {
+			log.Fatalf("invalid --ui-base-path: %v", err)
+		}
 		loadPathForServe := *loadPath
 		if loadPathForServe == "" && *storePath != "" {
 			loadPathForServe = *storePath
 		}
 		result, err := engine.LoadEntries(engine.LoadOptions{
-			File:         *file,
-			Format:       parsedFormat,
-			LoadPath:     loadPathForServe,
-			SnapshotPath: *snapshotLoad,
-			StorePath:    "",
-			ShardDir:     *shardDir,
-			ShardPaths:   shardPaths,
-			Replay:       *replay,
-			Retention:    retentionDur,
+			File:             *file,
+			Format:           parsedFormat,
+			LoadPath:         loadPathForServe,
+			SnapshotPath:     *snapshotLoad,
+			StorePath:        "",
+			ShardDir:         writableShardDir,
+			ShardPaths:       shardPaths,
+			Replay:           *replay,
+			Retention:        retentionDur,
+			MaxEntries:       *maxEntries,
+			LevelMap:         levelMap,
+			DefaultLevel:     *defaultLevel,
+			MissingTimestamp: parsedMissingTS,
+			SkipPartialLine:  *skipPartialLine,
+			Sort:             parsedSort,
+			Compression:      parsedCompression,
+			CoalesceFields:   *coalesceFields,
+			KeepRaw:          *keepRaw,
+			StampIngest:      *stampIngest,
+			UTC:              *utc,
+			ShardDedup:       *shardDedup,
+			DedupKey:         dedup,
+			Progress:         loadProgress,
 		})
+		progress.finish()
 		if err != nil {
 			log.Fatalf("failed to load entries: %v", err)
 		}
+		printWarnings(result.Warnings)
+		if *shardDedup {
+			log.Printf("shard dedup: dropped %d duplicate entries of %d read from %d shards", result.Stats.ShardDuplicates, result.Stats.LogsRead, len(result.Stats.SourceCounts))
+		}
 		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 		defer stop()
-		srv := server.New(result.Entries, result.Stats, *useIndex, result.Index, *storePath, *shardDir, *apiKey)
-		addr := fmt.Sprintf(":%d", *port)
+		if *maxMemoryEntries > 0 && *storePath == "" && writableShardDir == "" {
+			log.Printf("warning: --max-memory-entries without --store or --shard-dir drops evicted entries permanently")
+		}
+		srv := server.New(result.Entries, result.Stats, result.Index, server.Options{
+			UseIndex:         *useIndex,
+			StorePath:        *storePath,
+			ShardDir:         writableShardDir,
+			APIKey:           resolvedKey,
+			MaxEntries:       *maxMemoryEntries,
+			Shards:           shardOpts,
+			UIBasePath:       basePath,
+			DefaultLimit:     *defaultLimit,
+			MaxLimit:         *maxLimit,
+			UTC:              *utc,
+			StampIngest:      *stampIngest,
+			MaxIOConcurrency: *maxIOConcurrency,
+			ShutdownTimeout:  *shutdownTimeout,
+			Query:            queryOpts,
+		})
 		if err := srv.Start(ctx, addr); err != nil {
 			log.Fatalf("server error: %v", err)
 		}
@@ -195,126 +658,460 @@ func main() {
 	}
 
 	if *tail {
+		if *tailAlertFile != "" && !query.IsKnownLevel(*tailAlertLevel) {
+			log.Fatalf("invalid --tail-alert-level %q: expected DEBUG, INFO, WARN, ERROR, or FATAL", *tailAlertLevel)
+		}
+		if *tailSince < 0 {
+			log.Fatalf("--tail-since must be positive")
+		}
+		var backfillSince time.Time
+		if *tailSince > 0 {
+			backfillSince = time.Now().Add(-*tailSince)
+		}
 		if *explain {
 			printPlan(buildQueryPlan(query.BuildFilters(*level, cutoff, *search), *queryStr, *useIndex))
 		}
-		runTail(*file, *level, cutoff, *search, *jsonOut, *limit, *output, *tailFromStart, *tailPoll, parsedFormat, *storePath, *quiet, *storeHeader)
+		if err := runTail(*file, *level, cutoff, *search, *jsonOut, *limit, *output, *tailFromStart, backfillSince, *tailPoll, *tailTimeout, parsedFormat, levelMap, *defaultLevel, *coalesceFields, *keepRaw, *stampIngest, *utc, parsedMissingTS, messageFields, *storePath, *quiet, *storeHeader, *tailAlertFile, *tailAlertLevel, queryOpts, *configPath, *sinkSpec); err != nil {
+			log.Fatal(err)
+		}
 		return
 	}
 
-	result, err := engine.LoadEntries(engine.LoadOptions{
-		File:            *file,
-		Format:          parsedFormat,
-		LoadPath:        *loadPath,
-		SnapshotPath:    *snapshotLoad,
-		StorePath:       *storePath,
-		ShardDir:        *shardDir,
-		ShardPaths:      shardPaths,
-		Replay:          *replay,
-		Retention:       retentionDur,
-		StoreHeaderText: headerText(*storePath, *storeHeader, *file),
-	})
-	if err != nil {
-		log.Fatalf("failed to load entries: %v", err)
+	if *batchSize > 0 {
+		var paths []string
+		if *loadPath != "" {
+			paths = []string{*loadPath}
+		} else if *shardRead {
+			paths, _ = store.PruneShards(shardPaths, filters)
+			sort.Strings(paths)
+		} else {
+			log.Fatalf("--batch-size requires --load or --shard-read")
+		}
+		if *useIndex || *sortOrder != "" || *snapshotPath != "" || *tailN > 0 {
+			log.Fatalf("--batch-size cannot be combined with --index, --sort, --snapshot, or --tail-n")
+		}
+		if *explain {
+			printPlan(buildQueryPlan(filters, *queryStr, false))
+		}
+		runBatched(paths, *batchSize, filters, *jsonOut, smallerLimit(*limit, *head, 0), *output, *quiet, *utc, messageFields)
+		return
 	}
 
-	entries := result.Entries
-	loadStats := result.Stats
+	var indexAfter, indexBefore time.Time
+	if *partialIndex {
+		indexAfter, indexBefore = query.TimeBounds(filters)
+	}
 
-	if *snapshotPath != "" {
-		if err := snapshot.Create(*snapshotPath, entries, snapshotSources(*file, *loadPath, *snapshotLoad)); err != nil {
-			log.Fatalf("failed to write snapshot: %v", err)
+	// --exit-by-severity and --baseline need every match, and --since-file
+	// must see matches older than the ones shown, so no read may stop at the
+	// limit.
+	fullScan := exitCodes != nil || *baselinePath != "" || *sinceFile != ""
+	// Newest-first shard reads may also stop only when the limited listing is
+	// all the run produces: snapshots, reports, comparisons and metrics need
+	// every loaded entry.
+	listingOnly := *snapshotPath == "" && !*reportFlag && !*distinctMessages && *compare == "" && !*indexStats && !*levelsReport &&
+		!*metricsFlag && *metricsFile == "" && !*metricsJSON
+
+	// runQuery returns load errors so --watch can retry them; anything else
+	// still exits.
+	runQuery := func() error {
+		result, err := engine.LoadEntries(engine.LoadOptions{
+			File:                *file,
+			Format:              parsedFormat,
+			LoadPath:            *loadPath,
+			SnapshotPath:        *snapshotLoad,
+			StorePath:           *storePath,
+			ShardDir:            writableShardDir,
+			ShardPaths:          shardPaths,
+			Replay:              *replay,
+			ReplayDedup:         *replayDedup,
+			Retention:           retentionDur,
+			StoreHeaderText:     headerText(*storePath, *storeHeader, *file),
+			MaxEntries:          *maxEntries,
+			LevelMap:            levelMap,
+			DefaultLevel:        *defaultLevel,
+			MissingTimestamp:    parsedMissingTS,
+			SkipPartialLine:     *skipPartialLine,
+			Sort:                parsedSort,
+			Compression:         parsedCompression,
+			CoalesceFields:      *coalesceFields,
+			KeepRaw:             *keepRaw,
+			StampIngest:         *stampIngest,
+			UTC:                 *utc,
+			Shards:              shardOpts,
+			MaxParseErrors:      maxParseErrors(*noSkipMalformed),
+			ShardLimit:          shardLimit(*limit, *head, *tailN, fullScan || !listingOnly),
+			ShardFilters:        filters,
+			SnapshotIndexAfter:  indexAfter,
+			SnapshotIndexBefore: indexBefore,
+			ShardBloom:          !*indexStats && !*levelsReport && (*snapshotPath == "" || *snapshotFiltered),
+			ShardDedup:          *shardDedup,
+			DedupKey:            dedup,
+			Progress:            loadProgress,
+		})
+		progress.finish()
+		if err != nil {
+			return err
+		}
+		printWarnings(result.Warnings)
+		if result.SnapshotFilter != "" {
+			log.Printf("snapshot %s represents: %s", *snapshotLoad, result.SnapshotFilter)
+		}
+		if *shardDedup {
+			log.Printf("shard dedup: dropped %d duplicate entries of %d read from %d shards", result.Stats.ShardDuplicates, result.Stats.LogsRead, len(result.Stats.SourceCounts))
+		}
+		if *replayDedup {
+			log.Printf("replay: %d of %d parsed entries were already in %s and were skipped", result.Stats.ReplayOverlap, result.Stats.LogsRead, *storePath)
 		}
-	}
 
-	if *explain {
-		printPlan(buildQueryPlan(filters, *queryStr, *useIndex))
-	}
+		entries := result.Entries
+		loadStats := result.Stats
+		if *numericIndex != "" {
+			idx := result.Index
+			if idx == nil {
+				idx = index.Build(entries)
+			}
+			result.Index = idx.WithNumeric(entries, *numericIndex)
+		}
 
-	filtered, metricsResult := engine.QueryEntries(entries, loadStats, engine.QueryOptions{
-		Filters:  filters,
-		UseIndex: *useIndex,
-		Limit:    *limit,
-		Index:    result.Index,
-	})
+		if *indexStats {
+			idx := result.Index
+			if idx == nil {
+				idx = index.Build(entries)
+			}
+			printIndexStats(idx.Stats())
+			return nil
+		}
 
-	limited := filtered
-	afterFilters := len(entries) - metricsResult.LogsFilteredOut
+		if *levelsReport {
+			idx := result.Index
+			if idx == nil {
+				idx = index.Build(entries)
+			}
+			printLevelVocabulary(report.LevelVocabulary(idx.ByLevel), len(entries), *jsonOut)
+			return nil
+		}
 
-	var outputText string
-	if *jsonOut {
-		outputData := map[string]interface{}{
-			"total_loaded":  len(entries),
-			"after_filters": afterFilters,
-			"limited_to":    *limit,
-			"entries":       limited,
+		if *reportFlag {
+			matched, _ := engine.QueryEntries(entries, loadStats, engine.QueryOptions{
+				Filters:  filters,
+				UseIndex: *useIndex,
+				Index:    result.Index,
+			})
+			printReport(report.GroupPatterns(matched, "WARN", *reportTop, queryOpts), len(matched), *jsonOut)
+			return nil
 		}
-		data, err := json.MarshalIndent(outputData, "", "  ")
-		if err != nil {
-			log.Fatalf("failed to marshal JSON: %v", err)
+
+		if *compare != "" {
+			other, err := store.LoadJSONL(*compare)
+			if err != nil {
+				log.Fatalf("failed to load --compare source: %v", err)
+			}
+			if *utc {
+				ingest.NormalizeUTC(other)
+			}
+			opts := engine.QueryOptions{Filters: filters, UseIndex: *useIndex}
+			otherMatched, _ := engine.QueryEntries(other, engine.LoadStats{}, opts)
+			opts.Index = result.Index
+			matched, _ := engine.QueryEntries(entries, loadStats, opts)
+			printComparison(engine.CompareEntries(matched, otherMatched, dedup), len(matched), len(otherMatched), *compare, *limit, *jsonOut)
+			return nil
 		}
-		outputText = string(data)
-	} else {
-		var textBuilder strings.Builder
-		textBuilder.WriteString(fmt.Sprintf("Loaded %d log entries (%d after filters)", len(entries), afterFilters))
-		if *limit > 0 {
-			textBuilder.WriteString(fmt.Sprintf(" (showing %d)", len(limited)))
+
+		if *distinctMessages {
+			matched, _ := engine.QueryEntries(entries, loadStats, engine.QueryOptions{
+				Filters:  filters,
+				UseIndex: *useIndex,
+				Index:    result.Index,
+			})
+			distinct := report.DistinctMessages(matched)
+			if *limit > 0 && len(distinct) > *limit {
+				distinct = distinct[:*limit]
+			}
+			printDistinct(distinct, len(matched), *jsonOut)
+			return nil
 		}
-		textBuilder.WriteString("\n")
-		for _, e := range limited {
-			textBuilder.WriteString(fmt.Sprintf("%s %s %s\n", e.Timestamp.Format(time.RFC3339), e.Level, e.Message))
+
+		if *snapshotPath != "" {
+			sources := snapshotSources(*file, *loadPath, *snapshotLoad)
+			var err error
+			if *snapshotFiltered {
+				matched, _ := engine.QueryEntries(entries, loadStats, engine.QueryOptions{
+					Filters:  filters,
+					UseIndex: *useIndex,
+					Index:    result.Index,
+				})
+				err = snapshot.CreateFiltered(*snapshotPath, matched, sources, snapshotFilterText(filters, result.SnapshotFilter))
+			} else {
+				err = snapshot.Create(*snapshotPath, entries, sources)
+			}
+			if err != nil {
+				log.Fatalf("failed to write snapshot: %v", err)
+			}
 		}
-		outputText = textBuilder.String()
-	}
 
-	if *output != "" {
-		err := os.WriteFile(*output, []byte(outputText), 0644)
-		if err != nil {
-			log.Fatalf("failed to write to %s: %v", *output, err)
+		if *explain {
+			printPlan(buildQueryPlan(filters, *queryStr, *useIndex))
+		}
+
+		// --head can stop the scan early like --limit; --tail-n needs every match.
+		showLimit := smallerLimit(*limit, *head, *tailN)
+		scanLimit := shardLimit(*limit, *head, *tailN, fullScan)
+		filtered, metricsResult := engine.QueryEntries(entries, loadStats, engine.QueryOptions{
+			Filters:  filters,
+			UseIndex: *useIndex,
+			Limit:    scanLimit,
+			Index:    result.Index,
+		})
+
+		limited := filtered
+		if *tailN > 0 && len(limited) > showLimit {
+			limited = limited[len(limited)-showLimit:]
+		} else if showLimit > 0 && len(limited) > showLimit {
+			limited = limited[:showLimit]
+		}
+		afterFilters := len(entries) - metricsResult.LogsFilteredOut
+		afterFiltersText := strconv.Itoa(afterFilters)
+		if metricsResult.EarlyTerminated {
+			// The scan stopped at --limit, so only a lower bound is known.
+			afterFilters = len(limited)
+			afterFiltersText = fmt.Sprintf("%d+", afterFilters)
+		}
+		loadedText := strconv.Itoa(len(entries))
+		if loadStats.ShardsStopped {
+			// Older shards were never read, so both counts are lower bounds.
+			loadedText += "+"
+			afterFiltersText = fmt.Sprintf("%d+", afterFilters)
+		}
+
+		var outputText string
+		if *jsonOut {
+			outputData := map[string]interface{}{
+				"total_loaded":  len(entries),
+				"after_filters": afterFilters,
+				"limited_to":    showLimit,
+				"entries":       limited,
+			}
+			if metricsResult.EarlyTerminated || loadStats.ShardsStopped {
+				outputData["early_terminated"] = true
+			}
+			if qualityWarnings := result.Quality.Warnings(); len(qualityWarnings) > 0 {
+				outputData["warnings"] = qualityWarnings
+			}
+			data, err := json.MarshalIndent(outputData, "", "  ")
+			if err != nil {
+				log.Fatalf("failed to marshal JSON: %v", err)
+			}
+			outputText = string(data)
+		} else {
+			var textBuilder strings.Builder
+			textBuilder.WriteString(fmt.Sprintf("Loaded %s log entries (%s after filters)", loadedText, afterFiltersText))
+			if showLimit > 0 {
+				textBuilder.WriteString(fmt.Sprintf(" (showing %d)", len(limited)))
+			}
+			textBuilder.WriteString("\n")
+			for _, w := range result.Quality.Warnings() {
+				textBuilder.WriteString(fmt.Sprintf("Warning: %s\n", w))
+			}
+			for _, e := range limited {
+				textBuilder.WriteString(fmt.Sprintf("%s %s %s\n", e.Timestamp.Format(time.RFC3339), e.Level, e.MessageWithFields(messageFields)))
+			}
+			outputText = textBuilder.String()
+		}
+
+		if *sinkSpec != "" {
+			if err := sendToSink(*sinkSpec, limited, *jsonOut, messageFields); err != nil {
+				log.Fatalf("failed to send entries to %s: %v", *sinkSpec, err)
+			}
+		}
+
+		if *splitByLevel != "" {
+			if err := writeSplitByLevel(*splitByLevel, limited); err != nil {
+				log.Fatalf("failed to split by level into %s: %v", *splitByLevel, err)
+			}
+		}
+
+		if *output != "" {
+			if *outputAppend {
+				if *jsonOut {
+					log.Printf("warning: --output-append with --json appends whole JSON documents; %s will not be a single valid JSON value", *output)
+				}
+				if err := appendFile(*output, outputText); err != nil {
+					log.Fatalf("failed to append to %s: %v", *output, err)
+				}
+				fmt.Printf("Output appended to %s\n", *output)
+			} else {
+				err := os.WriteFile(*output, []byte(outputText), 0644)
+				if err != nil {
+					log.Fatalf("failed to write to %s: %v", *output, err)
+				}
+				fmt.Printf("Output saved to %s\n", *output)
+			}
+		} else if !*quiet {
+			fmt.Print(outputText)
+		}
+
+		if *sinceFile != "" {
+			// Matches cut by --limit, --head or --tail-n were not shown, so the
+			// cursor must stay before them for the next run to pick them up.
+			skipped := filtered[len(limited):]
+			if *tailN > 0 {
+				skipped = filtered[:len(filtered)-len(limited)]
+			}
+			if err := writeCursor(*sinceFile, limited, skipped); err != nil {
+				log.Fatalf("failed to update %s: %v", *sinceFile, err)
+			}
+		}
+
+		if *baselinePath != "" {
+			cmp, err := compareBaseline(*baselinePath, engine.LevelCounts(filtered), *updateBaseline)
+			if err != nil {
+				log.Fatalf("baseline %s: %v", *baselinePath, err)
+			}
+			metricsResult.Baseline = &cmp
 		}
-		fmt.Printf("Output saved to %s\n", *output)
-	} else if !*quiet {
-		fmt.Print(outputText)
+
+		if *metricsFlag || *metricsFile != "" || *metricsJSON {
+			metricsResult.StartedAt = runStart
+			metricsResult.FinishedAt = time.Now()
+			toStdout := *metricsFlag || (*metricsJSON && *metricsFile == "")
+			printMetrics(metricsResult, toStdout, *metricsFile, *metricsJSON)
+		}
+
+		if exitCodes != nil {
+			if code := severityExitCode(filtered, exitCodes, queryOpts); code != 0 {
+				stopProfiles()
+				os.Exit(code)
+			}
+		}
+		return nil
 	}
 
-	if *metricsFlag || *metricsFile != "" {
-		metricsResult.StartedAt = runStart
-		metricsResult.FinishedAt = time.Now()
-		printMetrics(metricsResult, *metricsFlag, *metricsFile)
+	if *watch {
+		paths := func() []string {
+			return watchPaths(*file, *loadPath, *snapshotLoad, *shardDir, *shardRead)
+		}
+		runWatch(paths, *watchInterval, func() error {
+			runStart = time.Now()
+			if *shardRead && filters.After.IsZero() && filters.Before.IsZero() {
+				// Pick up day shards created since the last run.
+				if refreshed, err := shard.AllShardPaths(*shardDir); err == nil {
+					shardPaths = refreshed
+				}
+			}
+			return runQuery()
+		})
+		return
+	}
+	if err := runQuery(); err != nil {
+		log.Fatalf("failed to load entries: %v", err)
 	}
 }
 
-func runTail(path string, level string, cutoff time.Time, search string, jsonOut bool, limit int, output string, fromStart bool, poll time.Duration, format ingest.Format, storePath string, quiet bool, storeHeader bool) {
+// runWatch calls run, then re-runs it after clearing the screen whenever the
+// size or mtime of any watched path changes, until interrupted. A run that
+// fails is logged and retried at the next tick.
+func runWatch(paths func() []string, interval time.Duration, run func() error) {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
-	entries, errs := ingest.TailLogFile(ctx, path, ingest.TailOptions{
-		FromStart:    fromStart,
-		PollInterval: poll,
-		Format:       format,
-	})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	var out *os.File
-	if output != "" {
-		f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	last := ""
+	for {
+		watched := paths()
+		if sig := watchSignature(watched); sig != last {
+			last = sig
+			if isTerminal(os.Stdout) {
+				fmt.Print("\033[H\033[2J")
+			}
+			if err := run(); err != nil {
+				log.Printf("failed to load entries: %v (retrying in %s)", err, interval)
+				last = ""
+			}
+			fmt.Printf("\nWatching %d path(s) every %s (Ctrl+C to stop)\n", len(watched), interval)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchPaths lists the inputs whose changes should trigger a --watch re-run.
+func watchPaths(file, loadPath, snapshotLoad, shardDir string, shardRead bool) []string {
+	switch {
+	case snapshotLoad != "":
+		return []string{snapshotLoad}
+	case loadPath != "":
+		return []string{loadPath}
+	case shardRead:
+		// The directory mtime changes when a new day's shard is created.
+		paths, _ := shard.AllShardPaths(shardDir)
+		return append([]string{shardDir}, paths...)
+	default:
+		return []string{file}
+	}
+}
+
+func watchSignature(paths []string) string {
+	var b strings.Builder
+	for _, p := range paths {
+		info, err := os.Stat(p)
 		if err != nil {
-			log.Fatalf("failed to open %s: %v", output, err)
+			fmt.Fprintf(&b, "%s:missing;", p)
+			continue
 		}
-		defer f.Close()
-		out = f
+		fmt.Fprintf(&b, "%s:%d:%d;", p, info.Size(), info.ModTime().UnixNano())
 	}
+	return b.String()
+}
 
-	write := func(text string) {
-		if out != nil {
-			if _, err := out.WriteString(text); err != nil {
-				log.Fatalf("failed to write to %s: %v", output, err)
-			}
-			return
+func runTail(path string, level string, cutoff time.Time, search string, jsonOut bool, limit int, output string, fromStart bool, backfillSince time.Time, poll time.Duration, idleTimeout time.Duration, format ingest.Format, levelMap map[string]string, defaultLevel string, coalesceFields bool, keepRaw bool, stampIngest bool, utc bool, missingTS ingest.MissingTimestamp, messageFields []string, storePath string, quiet bool, storeHeader bool, alertFile string, alertLevel string, queryOpts query.Options, configPath string, sinkSpec string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	entries, errs := ingest.TailLogFile(ctx, path, ingest.TailOptions{
+		FromStart:        fromStart,
+		Since:            backfillSince,
+		PollInterval:     poll,
+		IdleTimeout:      idleTimeout,
+		Format:           format,
+		LevelMap:         levelMap,
+		DefaultLevel:     defaultLevel,
+		CoalesceFields:   coalesceFields,
+		KeepRaw:          keepRaw,
+		StampIngest:      stampIngest,
+		UTC:              utc,
+		MissingTimestamp: missingTS,
+	})
+
+	// Matches are printed to --output or stdout (unless --quiet) and also
+	// forwarded to --sink.
+	var sinkNames []string
+	if output != "" || !quiet {
+		sinkNames = append(sinkNames, output)
+	}
+	if sinkSpec != "" {
+		sinkNames = append(sinkNames, sinkSpec)
+	}
+	sinks := make([]sink.Sink, len(sinkNames))
+	for i, name := range sinkNames {
+		if name == "" {
+			sinkNames[i] = "stdout"
 		}
-		if quiet {
-			return
+		out, err := sink.Open(name, jsonOut, messageFields)
+		if err != nil {
+			log.Fatalf("failed to open %s: %v", name, err)
 		}
-		fmt.Print(text)
+		sinks[i] = out
+		defer func(name string) {
+			if err := out.Close(); err != nil {
+				log.Printf("failed to write to %s: %v", name, err)
+			}
+		}(sinkNames[i])
 	}
 
 	var storeFile *os.File
@@ -332,6 +1129,33 @@ func runTail(path string, level string, cutoff time.Time, search string, jsonOut
 		}
 	}
 
+	// Alerts are buffered and flushed once a second and on exit.
+	var alerts *bufio.Writer
+	var flushTick <-chan time.Time
+	if alertFile != "" {
+		f, err := os.OpenFile(alertFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalf("failed to open %s: %v", alertFile, err)
+		}
+		defer f.Close()
+		alerts = bufio.NewWriter(f)
+		defer func() {
+			if err := alerts.Flush(); err != nil {
+				log.Printf("failed to flush %s: %v", alertFile, err)
+			}
+		}()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		flushTick = ticker.C
+	}
+
+	// SIGHUP re-reads level/search from --config; the new filter applies to
+	// entries read after the reload.
+	filters := query.BuildFilters(level, cutoff, search).WithOptions(queryOpts)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
 	matched := 0
 	for {
 		select {
@@ -339,37 +1163,137 @@ func runTail(path string, level string, cutoff time.Time, search string, jsonOut
 			if err != nil {
 				log.Fatalf("tail error: %v", err)
 			}
+		case <-reload:
+			if configPath == "" {
+				log.Printf("SIGHUP ignored: no --config to reload the tail filter from")
+				continue
+			}
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				log.Printf("SIGHUP: keeping current filter, failed to reload %s: %v", configPath, err)
+				continue
+			}
+			if cfg.Level != nil {
+				level = *cfg.Level
+			}
+			if cfg.Search != nil {
+				search = *cfg.Search
+			}
+			filters = query.BuildFilters(level, cutoff, search).WithOptions(queryOpts)
+			log.Printf("SIGHUP: tail filter reloaded (level=%q search=%q)", level, search)
+		case <-flushTick:
+			if err := alerts.Flush(); err != nil {
+				log.Fatalf("failed to write to %s: %v", alertFile, err)
+			}
 		case e, ok := <-entries:
 			if !ok {
-				return
+				return nil
 			}
 			if storeFile != nil {
 				if err := store.AppendJSONLToWriter(storeFile, e); err != nil {
 					log.Fatalf("failed to store entry: %v", err)
 				}
 			}
-			if !query.MatchesFilters(e, query.BuildFilters(level, cutoff, search)) {
-				continue
-			}
-
-			if jsonOut {
+			if alerts != nil && queryOpts.MatchesMinLevel(e.Level, alertLevel) {
 				data, err := json.Marshal(e)
 				if err != nil {
 					log.Fatalf("failed to marshal JSON: %v", err)
 				}
-				write(string(data) + "\n")
-			} else {
-				write(fmt.Sprintf("%s %s %s\n", e.Timestamp.Format(time.RFC3339), e.Level, e.Message))
+				if _, err := alerts.Write(append(data, '\n')); err != nil {
+					log.Fatalf("failed to write to %s: %v", alertFile, err)
+				}
+			}
+			if !query.MatchesFilters(e, filters) {
+				continue
+			}
+
+			// Returning rather than exiting lets the deferred Closes flush the
+			// other sinks.
+			for i, out := range sinks {
+				if err := out.Write(e); err != nil {
+					return fmt.Errorf("failed to write to %s: %w", sinkNames[i], err)
+				}
 			}
 
 			matched++
 			if limit > 0 && matched >= limit {
-				return
+				return nil
 			}
 		}
 	}
 }
 
+// runBatched filters JSONL files batch by batch and writes matches as they are found.
+// Files are read in the given order and entries keep their file order.
+func runBatched(paths []string, batchSize int, filters query.Filters, jsonOut bool, limit int, output string, quiet bool, utc bool, messageFields []string) {
+	var out *os.File
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			log.Fatalf("failed to open %s: %v", output, err)
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(os.Stdout)
+	if out != nil {
+		w = bufio.NewWriter(out)
+	}
+	defer w.Flush()
+
+	scanned := 0
+	matched := 0
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil && os.IsNotExist(err) && !objstore.IsURL(p) {
+			continue
+		}
+		err := store.ScanJSONL(p, batchSize, func(batch []types.LogEntry) error {
+			if utc {
+				ingest.NormalizeUTC(batch)
+			}
+			for _, e := range batch {
+				scanned++
+				if !query.MatchesFilters(e, filters) {
+					continue
+				}
+				matched++
+				if out != nil || !quiet {
+					if jsonOut {
+						data, err := json.Marshal(e)
+						if err != nil {
+							return err
+						}
+						w.Write(append(data, '\n'))
+					} else {
+						fmt.Fprintf(w, "%s %s %s\n", e.Timestamp.Format(time.RFC3339), e.Level, e.MessageWithFields(messageFields))
+					}
+				}
+				if limit > 0 && matched >= limit {
+					return store.ErrStopScan
+				}
+			}
+			return w.Flush()
+		})
+		if err != nil {
+			// Missing object-store shards only surface when opened.
+			if objstore.IsURL(p) && os.IsNotExist(err) {
+				continue
+			}
+			log.Fatalf("failed to scan %s: %v", p, err)
+		}
+		if limit > 0 && matched >= limit {
+			break
+		}
+	}
+	w.Flush()
+	if !jsonOut {
+		fmt.Fprintf(os.Stderr, "Scanned %d log entries in batches of %d (%d after filters)\n", scanned, batchSize, matched)
+	}
+	if output != "" {
+		fmt.Printf("Output saved to %s\n", output)
+	}
+}
+
 func parseFormat(value string) (ingest.Format, error) {
 	switch strings.ToLower(strings.TrimSpace(value)) {
 	case "plain", "":
@@ -378,14 +1302,55 @@ func parseFormat(value string) (ingest.Format, error) {
 		return ingest.FormatJSON, nil
 	case "logfmt":
 		return ingest.FormatLogfmt, nil
+	case "glog", "klog":
+		return ingest.FormatGlog, nil
 	case "auto":
 		return ingest.FormatAuto, nil
 	default:
-		return "", fmt.Errorf("expected one of: plain, json, logfmt, auto")
+		return "", fmt.Errorf("expected one of: plain, json, logfmt, glog, auto")
 	}
 }
 
-func applyConfig(cfg *config.Config, setFlags map[string]bool, file *string, level *string, since *string, search *string, jsonOut *bool, limit *int, output *string, tail *bool, tailFromStart *bool, tailPoll *time.Duration, format *string, storePath *string, loadPath *string, useIndex *bool, quiet *bool, storeHeader *bool, queryStr *string, explain *bool, replay *bool, snapshot *string, snapshotLoad *string, retention *string, metricsFlag *bool, metricsFile *string, serve *bool, port *int, shardDir *string, shardRead *bool, apiKey *string, cleanup *bool, cleanupDryRun *bool, cleanupConfirm *bool) {
+// resolveAPIKey picks the API key from --api-key-file, then LOGPIPE_API_KEY, then --api-key.
+func resolveAPIKey(flagKey string, keyFile string) (string, error) {
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return "", err
+		}
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return "", fmt.Errorf("key file %s is empty", keyFile)
+		}
+		return key, nil
+	}
+	if envKey, ok := os.LookupEnv("LOGPIPE_API_KEY"); ok {
+		key := strings.TrimSpace(envKey)
+		if key == "" {
+			return "", fmt.Errorf("LOGPIPE_API_KEY is empty")
+		}
+		return key, nil
+	}
+	if flagKey != "" && strings.TrimSpace(flagKey) == "" {
+		return "", fmt.Errorf("--api-key is empty")
+	}
+	return strings.TrimSpace(flagKey), nil
+}
+
+func parseSort(value string) (engine.SortOrder, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return engine.SortNone, nil
+	case "time-asc":
+		return engine.SortTimeAsc, nil
+	case "time-desc":
+		return engine.SortTimeDesc, nil
+	default:
+		return "", fmt.Errorf("expected one of: time-asc, time-desc")
+	}
+}
+
+func applyConfig(cfg *config.Config, setFlags map[string]bool, file *string, level *string, since *string, search *string, jsonOut *bool, limit *int, output *string, tail *bool, tailFromStart *bool, tailPoll *time.Duration, format *string, storePath *string, loadPath *string, useIndex *bool, quiet *bool, storeHeader *bool, queryStr *string, explain *bool, replay *bool, snapshot *string, snapshotLoad *string, retention *string, metricsFlag *bool, metricsFile *string, serve *bool, port *int, shardDir *string, shardRead *bool, apiKey *string, cleanup *bool, cleanupDryRun *bool, cleanupConfirm *bool, maxEntries *int, sortOrder *string, planOnly *bool, apiKeyFile *string, mergeSnapshots *string, minLevel *string, unknownLevelRank *string, splitByLevel *string, timeTolerance *string, sinceFile *string, levelMapSpec *string, cpuProfile *string, memProfile *string, compact *bool, compactWorkers *int, outputAppend *bool, maxMemoryEntries *int, defaultLevel *string, batchSize *int, tailTimeout *time.Duration, indexStats *bool, compression *string, coalesceFields *bool, watch *bool, watchInterval *time.Duration, shardSorted *bool, exprStr *string, noSkipMalformed *bool, tailAlertFile *string, tailAlertLevel *string, uiBasePath *string, reportFlag *bool, reportTop *int, defaultLimit *int, maxLimit *int, keepRaw *bool, importJSONL *string, listenAddr *string, dedupKey *string, metricsJSON *bool, verifyShards *bool, shardCompress *bool, distinctMessages *bool, host *string, utc *bool, compare *string, maxIOConcurrency *int, head *int, tailN *int, bloom *bool, levelsReport *bool, missingTS *string, shutdownTimeout *time.Duration, validateJSONL *string, snapshotFiltered *bool, replayDedup *bool, tailSince *time.Duration, sinkSpec *string, skipPartialLine *bool, exitBySeverity *bool, severityExitCodes *string, fieldsInMessage *string, partialIndex *bool, canonicalize *string, periodicTZ *string, progressFlag *bool, strictStore *bool, stampIngest *bool, queryFiles *listFlag, queryCombine *string, baselinePath *string, updateBaseline *bool, namedQuery *string, shardDedup *bool, numericIndex *string) {
 	if !setFlags["file"] && cfg.File != nil {
 		*file = *cfg.File
 	}
@@ -472,17 +1437,250 @@ func applyConfig(cfg *config.Config, setFlags map[string]bool, file *string, lev
 	if !setFlags["shard-read"] && cfg.ShardRead != nil {
 		*shardRead = *cfg.ShardRead
 	}
-	if !setFlags["api-key"] && cfg.ApiKey != nil {
-		*apiKey = *cfg.ApiKey
+	if !setFlags["api-key"] && cfg.ApiKey != nil {
+		*apiKey = *cfg.ApiKey
+	}
+	if !setFlags["cleanup"] && cfg.Cleanup != nil {
+		*cleanup = *cfg.Cleanup
+	}
+	if !setFlags["cleanup-dry-run"] && cfg.CleanupDryRun != nil {
+		*cleanupDryRun = *cfg.CleanupDryRun
+	}
+	if !setFlags["cleanup-confirm"] && cfg.CleanupConfirm != nil {
+		*cleanupConfirm = *cfg.CleanupConfirm
+	}
+	if !setFlags["max-entries"] && cfg.MaxEntries != nil {
+		*maxEntries = *cfg.MaxEntries
+	}
+	if !setFlags["sort"] && cfg.Sort != nil {
+		*sortOrder = *cfg.Sort
+	}
+	if !setFlags["plan-only"] && cfg.PlanOnly != nil {
+		*planOnly = *cfg.PlanOnly
+	}
+	if !setFlags["api-key-file"] && cfg.ApiKeyFile != nil {
+		*apiKeyFile = *cfg.ApiKeyFile
+	}
+	if !setFlags["merge-snapshots"] && cfg.MergeSnapshots != nil {
+		*mergeSnapshots = *cfg.MergeSnapshots
+	}
+	if !setFlags["min-level"] && cfg.MinLevel != nil {
+		*minLevel = *cfg.MinLevel
+	}
+	if !setFlags["unknown-level-rank"] && cfg.UnknownLevelRank != nil {
+		*unknownLevelRank = *cfg.UnknownLevelRank
+	}
+	if !setFlags["split-by-level"] && cfg.SplitByLevel != nil {
+		*splitByLevel = *cfg.SplitByLevel
+	}
+	if !setFlags["time-tolerance"] && cfg.TimeTolerance != nil {
+		*timeTolerance = *cfg.TimeTolerance
+	}
+	if !setFlags["since-file"] && cfg.SinceFile != nil {
+		*sinceFile = *cfg.SinceFile
+	}
+	if !setFlags["level-map"] && cfg.LevelMap != nil {
+		*levelMapSpec = *cfg.LevelMap
+	}
+	if !setFlags["cpuprofile"] && cfg.CPUProfile != nil {
+		*cpuProfile = *cfg.CPUProfile
+	}
+	if !setFlags["memprofile"] && cfg.MemProfile != nil {
+		*memProfile = *cfg.MemProfile
+	}
+	if !setFlags["compact"] && cfg.Compact != nil {
+		*compact = *cfg.Compact
+	}
+	if !setFlags["compact-workers"] && cfg.CompactWorkers != nil {
+		*compactWorkers = *cfg.CompactWorkers
+	}
+	if !setFlags["output-append"] && cfg.OutputAppend != nil {
+		*outputAppend = *cfg.OutputAppend
+	}
+	if !setFlags["max-memory-entries"] && cfg.MaxMemoryEntries != nil {
+		*maxMemoryEntries = *cfg.MaxMemoryEntries
+	}
+	if !setFlags["default-level"] && cfg.DefaultLevel != nil {
+		*defaultLevel = *cfg.DefaultLevel
+	}
+	if !setFlags["batch-size"] && cfg.BatchSize != nil {
+		*batchSize = *cfg.BatchSize
+	}
+	if !setFlags["index-stats"] && cfg.IndexStats != nil {
+		*indexStats = *cfg.IndexStats
+	}
+	if !setFlags["compression"] && cfg.Compression != nil {
+		*compression = *cfg.Compression
+	}
+	if !setFlags["coalesce-fields"] && cfg.CoalesceFields != nil {
+		*coalesceFields = *cfg.CoalesceFields
+	}
+	if !setFlags["default-limit"] && cfg.DefaultLimit != nil {
+		*defaultLimit = *cfg.DefaultLimit
+	}
+	if !setFlags["max-limit"] && cfg.MaxLimit != nil {
+		*maxLimit = *cfg.MaxLimit
+	}
+	if !setFlags["keep-raw"] && cfg.KeepRaw != nil {
+		*keepRaw = *cfg.KeepRaw
+	}
+	if !setFlags["import-jsonl"] && cfg.ImportJSONL != nil {
+		*importJSONL = *cfg.ImportJSONL
+	}
+	if !setFlags["listen"] && cfg.Listen != nil {
+		*listenAddr = *cfg.Listen
+	}
+	if !setFlags["dedup-key"] && cfg.DedupKey != nil {
+		*dedupKey = *cfg.DedupKey
+	}
+	if !setFlags["metrics-json"] && cfg.MetricsJSON != nil {
+		*metricsJSON = *cfg.MetricsJSON
+	}
+	if !setFlags["verify-shards"] && cfg.VerifyShards != nil {
+		*verifyShards = *cfg.VerifyShards
+	}
+	if !setFlags["shard-compress"] && cfg.ShardCompress != nil {
+		*shardCompress = *cfg.ShardCompress
+	}
+	if !setFlags["distinct-messages"] && cfg.DistinctMessages != nil {
+		*distinctMessages = *cfg.DistinctMessages
+	}
+	if !setFlags["host"] && cfg.Host != nil {
+		*host = *cfg.Host
+	}
+	if !setFlags["utc"] && cfg.UTC != nil {
+		*utc = *cfg.UTC
+	}
+	if !setFlags["compare"] && cfg.Compare != nil {
+		*compare = *cfg.Compare
+	}
+	if !setFlags["max-io-concurrency"] && cfg.MaxIOConcurrency != nil {
+		*maxIOConcurrency = *cfg.MaxIOConcurrency
+	}
+	if !setFlags["head"] && cfg.Head != nil {
+		*head = *cfg.Head
+	}
+	if !setFlags["tail-n"] && cfg.TailN != nil {
+		*tailN = *cfg.TailN
+	}
+	if !setFlags["bloom"] && cfg.Bloom != nil {
+		*bloom = *cfg.Bloom
+	}
+	if !setFlags["normalize-levels-report"] && cfg.NormalizeLevelsReport != nil {
+		*levelsReport = *cfg.NormalizeLevelsReport
+	}
+	if !setFlags["missing-ts"] && cfg.MissingTS != nil {
+		*missingTS = *cfg.MissingTS
+	}
+	if !setFlags["validate-jsonl"] && cfg.ValidateJSONL != nil {
+		*validateJSONL = *cfg.ValidateJSONL
+	}
+	if !setFlags["snapshot-filtered"] && cfg.SnapshotFiltered != nil {
+		*snapshotFiltered = *cfg.SnapshotFiltered
+	}
+	if !setFlags["replay-dedup"] && cfg.ReplayDedup != nil {
+		*replayDedup = *cfg.ReplayDedup
+	}
+	if !setFlags["report"] && cfg.Report != nil {
+		*reportFlag = *cfg.Report
+	}
+	if !setFlags["report-top"] && cfg.ReportTop != nil {
+		*reportTop = *cfg.ReportTop
+	}
+	if !setFlags["ui-base-path"] && cfg.UIBasePath != nil {
+		*uiBasePath = *cfg.UIBasePath
+	}
+	if !setFlags["tail-alert-file"] && cfg.TailAlertFile != nil {
+		*tailAlertFile = *cfg.TailAlertFile
+	}
+	if !setFlags["tail-alert-level"] && cfg.TailAlertLevel != nil {
+		*tailAlertLevel = *cfg.TailAlertLevel
+	}
+	if !setFlags["no-skip-malformed"] && cfg.NoSkipMalformed != nil {
+		*noSkipMalformed = *cfg.NoSkipMalformed
+	}
+	if !setFlags["expr"] && cfg.Expr != nil {
+		*exprStr = *cfg.Expr
+	}
+	if !setFlags["shard-sorted"] && cfg.ShardSorted != nil {
+		*shardSorted = *cfg.ShardSorted
+	}
+	if !setFlags["watch"] && cfg.Watch != nil {
+		*watch = *cfg.Watch
+	}
+	if !setFlags["watch-interval"] && cfg.WatchInterval != nil {
+		if d, err := time.ParseDuration(*cfg.WatchInterval); err == nil {
+			*watchInterval = d
+		}
+	}
+	if !setFlags["shard-dedup"] && cfg.ShardDedup != nil {
+		*shardDedup = *cfg.ShardDedup
+	}
+	if !setFlags["named-query"] && cfg.NamedQuery != nil {
+		*namedQuery = *cfg.NamedQuery
+	}
+	if !setFlags["numeric-index"] && cfg.NumericIndex != nil {
+		*numericIndex = *cfg.NumericIndex
+	}
+	if !setFlags["baseline"] && cfg.Baseline != nil {
+		*baselinePath = *cfg.Baseline
+	}
+	if !setFlags["update-baseline"] && cfg.UpdateBaseline != nil {
+		*updateBaseline = *cfg.UpdateBaseline
+	}
+	if !setFlags["query-file"] && cfg.QueryFile != nil {
+		*queryFiles = splitList(*cfg.QueryFile)
+	}
+	if !setFlags["query-combine"] && cfg.QueryCombine != nil {
+		*queryCombine = *cfg.QueryCombine
+	}
+	if !setFlags["stamp-ingest"] && cfg.StampIngest != nil {
+		*stampIngest = *cfg.StampIngest
+	}
+	if !setFlags["strict-store"] && cfg.StrictStore != nil {
+		*strictStore = *cfg.StrictStore
+	}
+	if !setFlags["progress"] && cfg.Progress != nil {
+		*progressFlag = *cfg.Progress
+	}
+	if !setFlags["periodic-tz"] && cfg.PeriodicTZ != nil {
+		*periodicTZ = *cfg.PeriodicTZ
+	}
+	if !setFlags["canonicalize"] && cfg.Canonicalize != nil {
+		*canonicalize = *cfg.Canonicalize
+	}
+	if !setFlags["partial-index"] && cfg.PartialIndex != nil {
+		*partialIndex = *cfg.PartialIndex
+	}
+	if !setFlags["fields-in-message"] && cfg.FieldsInMessage != nil {
+		*fieldsInMessage = *cfg.FieldsInMessage
+	}
+	if !setFlags["exit-by-severity"] && cfg.ExitBySeverity != nil {
+		*exitBySeverity = *cfg.ExitBySeverity
+	}
+	if !setFlags["severity-exit-codes"] && cfg.SeverityExitCodes != nil {
+		*severityExitCodes = *cfg.SeverityExitCodes
+	}
+	if !setFlags["skip-partial-line"] && cfg.SkipPartialLine != nil {
+		*skipPartialLine = *cfg.SkipPartialLine
+	}
+	if !setFlags["sink"] && cfg.Sink != nil {
+		*sinkSpec = *cfg.Sink
 	}
-	if !setFlags["cleanup"] && cfg.Cleanup != nil {
-		*cleanup = *cfg.Cleanup
+	if !setFlags["tail-since"] && cfg.TailSince != nil {
+		if d, err := time.ParseDuration(*cfg.TailSince); err == nil {
+			*tailSince = d
+		}
 	}
-	if !setFlags["cleanup-dry-run"] && cfg.CleanupDryRun != nil {
-		*cleanupDryRun = *cfg.CleanupDryRun
+	if !setFlags["tail-timeout"] && cfg.TailTimeout != nil {
+		if d, err := time.ParseDuration(*cfg.TailTimeout); err == nil {
+			*tailTimeout = d
+		}
 	}
-	if !setFlags["cleanup-confirm"] && cfg.CleanupConfirm != nil {
-		*cleanupConfirm = *cfg.CleanupConfirm
+	if !setFlags["shutdown-timeout"] && cfg.ShutdownTimeout != nil {
+		if d, err := time.ParseDuration(*cfg.ShutdownTimeout); err == nil {
+			*shutdownTimeout = d
+		}
 	}
 }
 
@@ -508,14 +1706,41 @@ func buildQueryPlan(filters query.Filters, queryStr string, useIndex bool) []str
 	if len(filters.LevelIn) > 0 {
 		plan = append(plan, fmt.Sprintf("filter(level_in=%s)", strings.Join(filters.LevelIn, ",")))
 	}
+	if filters.MinLevel != "" {
+		plan = append(plan, fmt.Sprintf("filter(level>=%s)", strings.ToUpper(filters.MinLevel)))
+	}
+	for _, lvl := range filters.NotLevel {
+		plan = append(plan, fmt.Sprintf("filter(level!=%s)", strings.ToUpper(lvl)))
+	}
 	if !filters.After.IsZero() {
 		plan = append(plan, fmt.Sprintf("filter(after=%s)", filters.After.UTC().Format(time.RFC3339)))
 	}
 	if !filters.Before.IsZero() {
 		plan = append(plan, fmt.Sprintf("filter(before=%s)", filters.Before.UTC().Format(time.RFC3339)))
 	}
-	if filters.Search != "" {
-		plan = append(plan, fmt.Sprintf("filter(message~%q)", filters.Search))
+	for _, sub := range filters.Search {
+		plan = append(plan, fmt.Sprintf("filter(message~%q)", sub))
+	}
+	if filters.MessageEquals != "" {
+		plan = append(plan, fmt.Sprintf("filter(message=%q)", filters.MessageEquals))
+	}
+	for _, re := range filters.MessageRegex {
+		plan = append(plan, fmt.Sprintf("filter(message=~%q)", re.String()))
+	}
+	for _, sub := range filters.NotSearch {
+		plan = append(plan, fmt.Sprintf("filter(message!~%q)", sub))
+	}
+	if len(filters.FieldEq) > 0 || len(filters.FieldContains) > 0 || len(filters.FieldCompare) > 0 || len(filters.HasFields) > 0 {
+		plan = append(plan, fmt.Sprintf("filter(%s)", query.Filters{FieldEq: filters.FieldEq, FieldContains: filters.FieldContains, FieldCompare: filters.FieldCompare, HasFields: filters.HasFields}))
+	}
+	if len(filters.Weekdays) > 0 || len(filters.Hours) > 0 {
+		plan = append(plan, fmt.Sprintf("filter(%s)", query.Filters{Weekdays: filters.Weekdays, Hours: filters.Hours}))
+	}
+	if filters.Expr != nil {
+		plan = append(plan, fmt.Sprintf("filter(expr=%q)", filters.Expr.String()))
+	}
+	if len(filters.Or) > 0 {
+		plan = append(plan, fmt.Sprintf("filter(any of: %s)", filters))
 	}
 
 	if queryStr != "" {
@@ -525,6 +1750,263 @@ func buildQueryPlan(filters query.Filters, queryStr string, useIndex bool) []str
 	return plan
 }
 
+// startProfiles starts CPU profiling when requested and returns a stop function
+// that finishes the CPU profile and writes the heap profile. It is safe to call twice.
+func startProfiles(cpuPath string, memPath string) (func(), error) {
+	var cpuFile *os.File
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		cpuFile = f
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if cpuFile != nil {
+				pprof.StopCPUProfile()
+				cpuFile.Close()
+			}
+			if memPath != "" {
+				f, err := os.Create(memPath)
+				if err != nil {
+					log.Printf("failed to write heap profile: %v", err)
+					return
+				}
+				defer f.Close()
+				runtime.GC()
+				if err := pprof.WriteHeapProfile(f); err != nil {
+					log.Printf("failed to write heap profile: %v", err)
+				}
+			}
+		})
+	}, nil
+}
+
+func appendFile(path string, text string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// compareBaseline scores counts against the baseline file, logging the levels
+// that moved enough to flag the run, and records counts in it when update is set.
+func compareBaseline(path string, counts map[string]int, update bool) (engine.BaselineComparison, error) {
+	b, err := engine.LoadBaseline(path)
+	if err != nil {
+		return engine.BaselineComparison{}, err
+	}
+	cmp := b.Compare(counts)
+	for _, d := range cmp.Deltas {
+		if math.Abs(d.Z) >= engine.AnomalyZ {
+			log.Printf("anomaly: %s count %d vs baseline mean %.1f over %d runs (z=%.1f)", d.Level, d.Count, d.Mean, cmp.Runs, d.Z)
+		}
+	}
+	if update {
+		b.Add(counts)
+		if err := engine.SaveBaseline(path, b); err != nil {
+			return cmp, err
+		}
+	}
+	return cmp, nil
+}
+
+// listFlag collects a flag given more than once; each value may also be a
+// comma-separated list.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, splitList(value)...)
+	return nil
+}
+
+// loadQueryFiles parses each --query-file and combines them with AND or OR.
+func loadQueryFiles(paths []string, combine string) (query.Filters, error) {
+	parsed := make([]query.Filters, 0, len(paths))
+	for _, p := range paths {
+		text, err := readQueryFile(p)
+		if err != nil {
+			return query.Filters{}, err
+		}
+		f, err := query.Parse(text)
+		if err != nil {
+			return query.Filters{}, fmt.Errorf("%s: %v", p, err)
+		}
+		parsed = append(parsed, f)
+	}
+	switch strings.ToLower(strings.TrimSpace(combine)) {
+	case "", "and":
+		combined := parsed[0]
+		for _, f := range parsed[1:] {
+			var err error
+			if combined, err = query.AndFilters(combined, f); err != nil {
+				return query.Filters{}, fmt.Errorf("the files cannot all match: %v", err)
+			}
+		}
+		return combined, nil
+	case "or":
+		return query.OrFilters(parsed...), nil
+	default:
+		return query.Filters{}, fmt.Errorf("unknown --query-combine %q (use and, or)", combine)
+	}
+}
+
+// resolveNamedQuery parses the query called name in the config catalog.
+func resolveNamedQuery(queries map[string]string, name string) (query.Filters, error) {
+	text, ok := queries[name]
+	if !ok {
+		if len(queries) == 0 {
+			return query.Filters{}, fmt.Errorf("unknown query %q (the config defines no \"queries\")", name)
+		}
+		names := make([]string, 0, len(queries))
+		for n := range queries {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return query.Filters{}, fmt.Errorf("unknown query %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	f, err := query.Parse(text)
+	if err != nil {
+		return query.Filters{}, fmt.Errorf("%s: %v", name, err)
+	}
+	return f, nil
+}
+
+// readQueryFile joins the non-blank, non-comment lines of a --query-file into
+// one DSL string. Lines are separated by spaces, so they AND unless a line
+// starts or ends with OR.
+func readQueryFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts = append(parts, line)
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("%s has no query", path)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// readCursor reads the last processed timestamp; a missing file means from the beginning.
+func readCursor(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	text := strings.TrimSpace(string(data))
+	if text == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, text)
+}
+
+// applyCursor restricts filters to entries after the cursor saved in path.
+// It ANDs the bound into every OR branch, where a root After would be ignored.
+func applyCursor(filters query.Filters, path string) (query.Filters, error) {
+	cursor, err := readCursor(path)
+	if err != nil || cursor.IsZero() {
+		return filters, err
+	}
+	return query.AndFilters(filters, query.Filters{After: cursor.Add(time.Nanosecond)})
+}
+
+// writeCursor stores the newest timestamp among the emitted entries, held back
+// to just before the oldest skipped match so that one is read again next run.
+// It leaves the file alone when there is nothing to advance to.
+func writeCursor(path string, emitted []types.LogEntry, skipped []types.LogEntry) error {
+	var latest time.Time
+	for _, e := range emitted {
+		if e.Timestamp.After(latest) {
+			latest = e.Timestamp
+		}
+	}
+	for _, e := range skipped {
+		if !e.Timestamp.IsZero() && !e.Timestamp.After(latest) {
+			latest = e.Timestamp.Add(-time.Nanosecond)
+		}
+	}
+	if latest.IsZero() {
+		return nil
+	}
+	return os.WriteFile(path, []byte(latest.UTC().Format(time.RFC3339Nano)+"\n"), 0644)
+}
+
+// writeSplitByLevel appends entries to one JSONL file per level under dir.
+func writeSplitByLevel(dir string, entries []types.LogEntry) error {
+	grouped := make(map[string][]types.LogEntry)
+	for _, e := range entries {
+		key := levelFileName(e.Level)
+		grouped[key] = append(grouped[key], e)
+	}
+	levels := make([]string, 0, len(grouped))
+	for lvl := range grouped {
+		levels = append(levels, lvl)
+	}
+	sort.Strings(levels)
+	for _, lvl := range levels {
+		if err := store.AppendJSONL(filepath.Join(dir, lvl+".jsonl"), grouped[lvl]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// levelFileName turns a level into a safe file name (no path separators).
+func levelFileName(level string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(level))
+	if name == "" {
+		return "UNKNOWN"
+	}
+	return name
+}
+
+// malformedExamples is how many failing lines --no-skip-malformed reports.
+const malformedExamples = 5
+
+func maxParseErrors(report bool) int {
+	if report {
+		return malformedExamples
+	}
+	return 0
+}
+
+func printWarnings(warnings []string) {
+	for _, w := range warnings {
+		log.Printf("warning: %s", w)
+	}
+}
+
 func printPlan(plan []string) {
 	fmt.Println("PLAN:")
 	for _, step := range plan {
@@ -533,7 +2015,23 @@ func printPlan(plan []string) {
 	fmt.Println()
 }
 
-func printMetrics(m engine.Metrics, toStdout bool, path string) {
+func printMetrics(m engine.Metrics, toStdout bool, path string, asJSON bool) {
+	if asJSON {
+		data, err := json.Marshal(server.MetricsToMap(m))
+		if err != nil {
+			log.Fatalf("failed to marshal metrics: %v", err)
+		}
+		if toStdout {
+			fmt.Println(string(data))
+		}
+		if path != "" {
+			if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+				log.Fatalf("failed to write metrics to %s: %v", path, err)
+			}
+		}
+		return
+	}
+
 	rate, ok := m.RatePerSec()
 	rateText := "NA"
 	if ok {
@@ -549,6 +2047,26 @@ func printMetrics(m engine.Metrics, toStdout bool, path string) {
 		fmt.Sprintf("metrics.logs_returned=%d", m.LogsReturned),
 		fmt.Sprintf("metrics.rate_per_sec=%s", rateText),
 		fmt.Sprintf("metrics.index_enabled=%t", m.IndexEnabled),
+		fmt.Sprintf("metrics.truncated=%t", m.Truncated),
+		fmt.Sprintf("metrics.early_terminated=%t", m.EarlyTerminated),
+		fmt.Sprintf("metrics.shards_skipped=%d", m.ShardsSkipped),
+	}
+	sources := make([]string, 0, len(m.SourceCounts))
+	for src := range m.SourceCounts {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+	for _, src := range sources {
+		lines = append(lines, fmt.Sprintf("metrics.source.%s=%d", src, m.SourceCounts[src]))
+	}
+	if b := m.Baseline; b != nil {
+		lines = append(lines, fmt.Sprintf("metrics.anomaly=%t", b.Anomaly), fmt.Sprintf("metrics.baseline_runs=%d", b.Runs))
+		for _, d := range b.Deltas {
+			lines = append(lines,
+				fmt.Sprintf("metrics.baseline.%s.count=%d", d.Level, d.Count),
+				fmt.Sprintf("metrics.baseline.%s.mean=%.2f", d.Level, d.Mean),
+				fmt.Sprintf("metrics.baseline.%s.z=%.2f", d.Level, d.Z))
+		}
 	}
 
 	if toStdout {
@@ -562,6 +2080,48 @@ func printMetrics(m engine.Metrics, toStdout bool, path string) {
 	}
 }
 
+// serveAddr builds the --serve listen address: --listen verbatim, otherwise
+// host:port, where an empty host binds all interfaces.
+func serveAddr(host string, port int, listen string) (string, error) {
+	if listen != "" {
+		if host != "" {
+			return "", fmt.Errorf("--host cannot be combined with --listen")
+		}
+		return listen, nil
+	}
+	if port < 0 || port > 65535 {
+		return "", fmt.Errorf("--port %d out of range 0-65535", port)
+	}
+	host = strings.Trim(strings.TrimSpace(host), "[]")
+	if strings.ContainsAny(host, " /") || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+		return "", fmt.Errorf("--host %q is not a host name or IP address", host)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// smallerLimit returns the smallest positive value among limit, head and tailN
+// (0 = no limit). Only one of head and tailN is set.
+func smallerLimit(limit int, head int, tailN int) int {
+	n := limit
+	for _, v := range []int{head, tailN} {
+		if v > 0 && (n == 0 || v < n) {
+			n = v
+		}
+	}
+	return n
+}
+
+// shardLimit is the match count after which newest-first shard reads and the
+// query scan may stop. --tail-n keeps the last matches and fullScan outputs
+// (--exit-by-severity, --baseline, --since-file) look at all of them, so both
+// disable the early stop.
+func shardLimit(limit int, head int, tailN int, fullScan bool) int {
+	if tailN > 0 || fullScan {
+		return 0
+	}
+	return smallerLimit(limit, head, 0)
+}
+
 func printRunHeader(source string, dest string) error {
 	existing, err := countExistingEntries(dest)
 	if err != nil {
@@ -656,6 +2216,89 @@ func formatCount(n int) string {
 	return b.String()
 }
 
+const defaultSeverityExitCodes = "ERROR=2,WARN=1"
+
+// severityExit maps entries at least as severe as Level to Code.
+type severityExit struct {
+	Level string
+	Code  int
+}
+
+// parseSeverityExitCodes parses "LEVEL=code,..." into exits ordered from the
+// most to the least severe level.
+func parseSeverityExitCodes(spec string) ([]severityExit, error) {
+	var out []severityExit
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		lvl, codeText, ok := strings.Cut(pair, "=")
+		lvl = strings.ToUpper(strings.TrimSpace(lvl))
+		if !ok || !query.IsKnownLevel(lvl) {
+			return nil, fmt.Errorf("%q: expected LEVEL=code with one of DEBUG, INFO, WARN, ERROR, FATAL", pair)
+		}
+		code, err := strconv.Atoi(strings.TrimSpace(codeText))
+		if err != nil || code < 0 || code > 125 {
+			return nil, fmt.Errorf("%q: exit code must be 0-125", pair)
+		}
+		out = append(out, severityExit{Level: lvl, Code: code})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no LEVEL=code pairs")
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return query.LevelRank(out[i].Level) > query.LevelRank(out[j].Level)
+	})
+	return out, nil
+}
+
+// severityExitCode returns the code for the most severe of entries (ranked
+// under opts): that of the highest mapped level at or below its rank, or 0 if
+// none applies.
+func severityExitCode(entries []types.LogEntry, exits []severityExit, opts query.Options) int {
+	maxRank := -1
+	for _, e := range entries {
+		if r := opts.LevelRank(e.Level); r > maxRank {
+			maxRank = r
+		}
+	}
+	for _, x := range exits {
+		if query.LevelRank(x.Level) <= maxRank {
+			return x.Code
+		}
+	}
+	return 0
+}
+
+// sendToSink writes entries to the sink named by spec and closes it.
+func sendToSink(spec string, entries []types.LogEntry, jsonOut bool, messageFields []string) error {
+	out, err := sink.Open(spec, jsonOut, messageFields)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := out.Write(e); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// snapshotFilterText describes the entries in a filtered snapshot: filters, ANDed
+// with the query of the snapshot they were loaded from, if that was filtered too.
+func snapshotFilterText(filters query.Filters, loadedFilter string) string {
+	text := filters.String()
+	if loadedFilter == "" {
+		return text
+	}
+	if text == "" {
+		return loadedFilter
+	}
+	return "(" + loadedFilter + ") and (" + text + ")"
+}
+
 func snapshotSources(file string, loadPath string, snapshotLoad string) []string {
 	sources := make([]string, 0, 2)
 	if snapshotLoad != "" {
@@ -670,6 +2313,19 @@ func snapshotSources(file string, loadPath string, snapshotLoad string) []string
 	return sources
 }
 
+func splitList(value string) []string {
+	parts := strings.Split(value, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
 func parseFlexibleDuration(value string) (time.Duration, error) {
 	value = strings.TrimSpace(value)
 	if value == "" {
@@ -761,11 +2417,287 @@ func printCleanupPlan(plan cleanupPlan) {
 	fmt.Println()
 }
 
+func printReport(patterns []report.Pattern, total int, jsonOut bool) {
+	if jsonOut {
+		data, err := json.MarshalIndent(map[string]interface{}{
+			"entries":  total,
+			"patterns": patterns,
+		}, "", "  ")
+		if err != nil {
+			log.Fatalf("failed to marshal JSON: %v", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Printf("TOP ISSUES (%d pattern(s) from %d entries)\n", len(patterns), total)
+	for i, p := range patterns {
+		fmt.Printf("%2d. [%s] x%d  %s\n", i+1, p.Level, p.Count, p.Pattern)
+		fmt.Printf("    first %s  last %s\n", p.FirstSeen.UTC().Format(time.RFC3339), p.LastSeen.UTC().Format(time.RFC3339))
+	}
+}
+
+// printComparison prints a --compare result; limit > 0 caps the entries listed
+// on each side (counts are always complete).
+func printComparison(cmp engine.Comparison, primary int, other int, otherPath string, limit int, jsonOut bool) {
+	onlyA, onlyB := cmp.OnlyA, cmp.OnlyB
+	if limit > 0 && len(onlyA) > limit {
+		onlyA = onlyA[:limit]
+	}
+	if limit > 0 && len(onlyB) > limit {
+		onlyB = onlyB[:limit]
+	}
+	if jsonOut {
+		if onlyA == nil {
+			onlyA = []types.LogEntry{}
+		}
+		if onlyB == nil {
+			onlyB = []types.LogEntry{}
+		}
+		data, err := json.MarshalIndent(map[string]interface{}{
+			"primary":          primary,
+			"other":            other,
+			"common":           cmp.Common,
+			"onlyPrimaryCount": len(cmp.OnlyA),
+			"onlyOtherCount":   len(cmp.OnlyB),
+			"onlyPrimary":      onlyA,
+			"onlyOther":        onlyB,
+		}, "", "  ")
+		if err != nil {
+			log.Fatalf("failed to marshal JSON: %v", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Println("COMPARE")
+	fmt.Printf("Primary   : %d matches\n", primary)
+	fmt.Printf("Other     : %d matches (%s)\n", other, otherPath)
+	fmt.Printf("Common    : %d\n", cmp.Common)
+	fmt.Printf("\nOnly in primary (%d):\n", len(cmp.OnlyA))
+	for _, e := range onlyA {
+		fmt.Printf("- %s %s %s\n", e.Timestamp.Format(time.RFC3339), e.Level, e.Message)
+	}
+	fmt.Printf("\nOnly in other (%d):\n", len(cmp.OnlyB))
+	for _, e := range onlyB {
+		fmt.Printf("+ %s %s %s\n", e.Timestamp.Format(time.RFC3339), e.Level, e.Message)
+	}
+}
+
+func printDistinct(messages []report.Distinct, total int, jsonOut bool) {
+	if jsonOut {
+		data, err := json.MarshalIndent(map[string]interface{}{
+			"entries":  total,
+			"messages": messages,
+		}, "", "  ")
+		if err != nil {
+			log.Fatalf("failed to marshal JSON: %v", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Printf("DISTINCT MESSAGES (%d from %d entries)\n", len(messages), total)
+	for _, d := range messages {
+		fmt.Printf("%6d  %s .. %s  %s\n", d.Count, d.FirstSeen.UTC().Format(time.RFC3339), d.LastSeen.UTC().Format(time.RFC3339), d.Message)
+	}
+}
+
+func printLevelVocabulary(levels []report.LevelCount, total int, jsonOut bool) {
+	if jsonOut {
+		data, err := json.MarshalIndent(map[string]interface{}{
+			"entries": total,
+			"levels":  levels,
+		}, "", "  ")
+		if err != nil {
+			log.Fatalf("failed to marshal JSON: %v", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Printf("LEVEL VALUES (%d spellings in %d entries)\n", len(levels), total)
+	for _, l := range levels {
+		note := ""
+		if !l.Known {
+			note = "  (unknown level)"
+		}
+		if l.Level != l.Bucket {
+			note += fmt.Sprintf("  (indexed as %s)", l.Bucket)
+		}
+		fmt.Printf("%6d  %q%s\n", l.Count, l.Level, note)
+	}
+}
+
+func printIndexStats(st index.Stats) {
+	fmt.Println("INDEX STATS")
+	levels := make([]string, 0, len(st.Levels))
+	for lvl := range st.Levels {
+		levels = append(levels, lvl)
+	}
+	sort.Strings(levels)
+	fmt.Printf("Levels    : %d bucket(s)\n", len(levels))
+	for _, lvl := range levels {
+		fmt.Printf("- %s: %d\n", lvl, st.Levels[lvl])
+	}
+	fmt.Printf("Hours     : %d bucket(s) (largest %d)\n", st.HourBuckets, st.LargestHour)
+	if st.First.IsZero() {
+		fmt.Println("Span      : (empty)")
+		return
+	}
+	fmt.Printf("Span      : %s .. %s (%s)\n", st.First.UTC().Format(time.RFC3339), st.Last.UTC().Format(time.RFC3339), st.Last.Sub(st.First))
+}
+
+func printCompactResults(results []store.CompactResult) {
+	var reclaimed int64
+	removed := 0
+	fmt.Println("COMPACTION")
+	for _, r := range results {
+		fmt.Printf("- %s: %d -> %d entries", r.Path, r.EntriesBefore, r.EntriesAfter)
+		if r.Malformed > 0 {
+			fmt.Printf(" (%d malformed lines kept)", r.Malformed)
+		}
+		fmt.Println()
+		reclaimed += r.BytesReclaimed
+		removed += r.EntriesBefore - r.EntriesAfter
+	}
+	fmt.Printf("Shards    : %d\n", len(results))
+	fmt.Printf("Removed   : %d duplicate entries\n", removed)
+	fmt.Printf("Reclaimed : %s bytes\n", formatCount(int(reclaimed)))
+}
+
+// printValidation prints the --validate-jsonl line counts and the invalid lines found.
+func printValidation(path string, res store.JSONLValidation, jsonOut bool) {
+	if jsonOut {
+		data, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			log.Fatalf("failed to marshal JSON: %v", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Println("JSONL VALIDATE")
+	fmt.Printf("File    : %s\n", path)
+	fmt.Printf("Lines   : %s\n", formatCount(res.Lines))
+	fmt.Printf("Valid   : %s\n", formatCount(res.Valid))
+	fmt.Printf("Invalid : %s\n", formatCount(res.Invalid))
+	for _, e := range res.Errors {
+		fmt.Printf("- line %d: %s\n", e.Line, e.Reason)
+	}
+	if more := res.Invalid - len(res.Errors); more > 0 {
+		fmt.Printf("  ... and %d more\n", more)
+	}
+}
+
+func printCanonicalize(src, dst string, stats ingest.ReadStats, written int) {
+	fmt.Println("CANONICALIZE")
+	fmt.Printf("Source  : %s\n", src)
+	fmt.Printf("Output  : %s\n", dst)
+	fmt.Printf("Lines   : %s\n", formatCount(stats.Lines))
+	fmt.Printf("Written : %s entries\n", formatCount(written))
+	fmt.Printf("Dropped : %s lines\n", formatCount(stats.Malformed))
+	for _, pe := range stats.ParseErrors {
+		fmt.Printf("- %v\n", pe)
+	}
+	if more := stats.Malformed - len(stats.ParseErrors); more > 0 {
+		fmt.Printf("  ... and %d more\n", more)
+	}
+	if stats.PartialLineBytes > 0 {
+		fmt.Printf("Partial : last line left out (%d bytes, no trailing newline)\n", stats.PartialLineBytes)
+	}
+}
+
+// storeSampleLines is how many lines of each append target are checked.
+const storeSampleLines = 5
+
+// checkAppendTargets samples the start of each existing store or shard file and
+// describes those that do not look like JSONL entries.
+func checkAppendTargets(paths []string) []string {
+	var problems []string
+	for _, p := range paths {
+		res, err := store.SampleJSONL(p, storeSampleLines)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s exists but cannot be read as JSONL: %v", p, err))
+			continue
+		}
+		if res.Invalid == 0 {
+			continue
+		}
+		first := res.Errors[0]
+		problems = append(problems, fmt.Sprintf("%s does not look like a JSONL store: %d of %d sampled lines are not entries (line %d: %s)", p, res.Invalid, res.Lines, first.Line, first.Reason))
+	}
+	return problems
+}
+
+// progressLine redraws one stderr status line for --progress.
+type progressLine struct {
+	shown bool
+}
+
+func (p *progressLine) update(done, total, entries int) {
+	fmt.Fprintf(os.Stderr, "\rloading: %d/%d files, %s entries", done, total, formatCount(entries))
+	p.shown = true
+}
+
+// finish ends the status line so later output starts on a fresh line.
+func (p *progressLine) finish() {
+	if p == nil || !p.shown {
+		return
+	}
+	fmt.Fprintln(os.Stderr)
+	p.shown = false
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// printShardChecks prints per-shard verification results and returns the number
+// of misplaced entries.
+func printShardChecks(checks []store.ShardCheck) int {
+	misplaced := 0
+	fmt.Println("SHARD VERIFY")
+	for _, c := range checks {
+		status := "ok"
+		switch {
+		case c.Undated:
+			status = "not a dated shard"
+		case c.Misplaced > 0:
+			status = "MISPLACED"
+		}
+		fmt.Printf("- %s: %d entries, %d misplaced (%s)\n", c.Path, c.Entries, c.Misplaced, status)
+		days := make([]string, 0, len(c.WrongDays))
+		for day := range c.WrongDays {
+			days = append(days, day)
+		}
+		sort.Strings(days)
+		for _, day := range days {
+			fmt.Printf("    %d entries belong to %s\n", c.WrongDays[day], day)
+		}
+		misplaced += c.Misplaced
+	}
+	fmt.Printf("Shards    : %d\n", len(checks))
+	fmt.Printf("Misplaced : %d entries\n", misplaced)
+	return misplaced
+}
+
+func printImportResults(path string, read int, results []store.ImportResult) {
+	added := 0
+	fmt.Println("IMPORT")
+	for _, r := range results {
+		fmt.Printf("- %s: +%d (%d already present)\n", r.Day, r.Added, r.Skipped)
+		added += r.Added
+	}
+	fmt.Printf("Source  : %s\n", path)
+	fmt.Printf("Read    : %s entries\n", formatCount(read))
+	fmt.Printf("Added   : %s entries across %d days\n", formatCount(added), len(results))
+}
+
 func executeCleanup(plan cleanupPlan) error {
 	for _, p := range plan.ToDelete {
 		if err := os.Remove(p); err != nil {
 			return err
 		}
+		if err := os.Remove(store.BloomPath(p)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
 	return nil
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/query"
+	"github.com/armash/log-pipeline/internal/snapshot"
+	"github.com/armash/log-pipeline/internal/store"
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+// runMain runs the CLI with args in a child test process, since main parses
+// the global flag set and exits on errors. It returns the combined output.
+func runMain(t *testing.T, args ...string) string {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunMain$")
+	cmd.Env = append(os.Environ(), "LOG_PIPELINE_MAIN_ARGS="+strings.Join(args, "\n"))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("log-pipeline %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func TestRunMain(t *testing.T) {
+	args := os.Getenv("LOG_PIPELINE_MAIN_ARGS")
+	if args == "" {
+		t.Skip("only runs as the child of runMain")
+	}
+	os.Args = append([]string{"log-pipeline"}, strings.Split(args, "\n")...)
+	main()
+}
+
+func TestSinceFileWithOrQuery(t *testing.T) {
+	cursorPath := filepath.Join(t.TempDir(), "cursor")
+	base := time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC)
+	entries := []types.LogEntry{
+		{Timestamp: base, Level: "ERROR", Message: "db down"},
+		{Timestamp: base.Add(time.Minute), Level: "INFO", Message: "auth ok"},
+		{Timestamp: base.Add(2 * time.Minute), Level: "INFO", Message: "tick"},
+	}
+	f, err := query.Parse("level=ERROR OR message~auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func() []types.LogEntry {
+		t.Helper()
+		filters, err := applyCursor(f, cursorPath)
+		if err != nil {
+			t.Fatalf("applyCursor() error = %v", err)
+		}
+		var emitted []types.LogEntry
+		for _, e := range entries {
+			if query.MatchesFilters(e, filters) {
+				emitted = append(emitted, e)
+			}
+		}
+		if err := writeCursor(cursorPath, emitted, nil); err != nil {
+			t.Fatalf("writeCursor() error = %v", err)
+		}
+		return emitted
+	}
+
+	if got := run(); len(got) != 2 {
+		t.Fatalf("first run emitted %d entries, want 2", len(got))
+	}
+	if got := run(); len(got) != 0 {
+		t.Errorf("second run emitted %v, want nothing new", got)
+	}
+	entries = append(entries, types.LogEntry{Timestamp: base.Add(3 * time.Minute), Level: "ERROR", Message: "db down again"})
+	if got := run(); len(got) != 1 || got[0].Message != "db down again" {
+		t.Errorf("third run emitted %v, want only the new ERROR", got)
+	}
+}
+
+func TestShardReadDescSnapshotReadsAllShards(t *testing.T) {
+	dir := t.TempDir()
+	shardDir := filepath.Join(dir, "shards")
+	day := time.Date(2026, 2, 7, 10, 0, 0, 0, time.UTC)
+	entries := []types.LogEntry{
+		{Timestamp: day, Level: "INFO", Message: "older"},
+		{Timestamp: day.AddDate(0, 0, 1), Level: "INFO", Message: "newer"},
+		{Timestamp: day.AddDate(0, 0, 1).Add(time.Minute), Level: "ERROR", Message: "newest"},
+	}
+	if err := store.AppendShards(shardDir, entries, store.ShardOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	snapPath := filepath.Join(dir, "snap.json")
+	out := runMain(t, "--shard-dir", shardDir, "--shard-read", "--sort", "time-desc", "--limit", "1", "--snapshot", snapPath)
+	if !strings.Contains(out, "newest") || strings.Contains(out, "newer") {
+		t.Errorf("listing = %q, want only the newest entry", out)
+	}
+	snap, err := snapshot.Load(snapPath)
+	if err != nil {
+		t.Fatalf("snapshot.Load() error = %v", err)
+	}
+	if len(snap.Entries) != len(entries) {
+		t.Errorf("snapshot holds %d entries, want all %d from every shard", len(snap.Entries), len(entries))
+	}
+}
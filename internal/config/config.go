@@ -18,6 +18,28 @@ type Config struct {
 	Tail          *bool   `json:"tail"`
 	TailFromStart *bool   `json:"tailFromStart"`
 	TailPoll      *string `json:"tailPoll"`
+	TailTimeout   *string `json:"tailTimeout"`
+	TailSince     *string `json:"tailSince"`
+	Sink          *string `json:"sink"`
+	SkipPartialLine *bool `json:"skipPartialLine"`
+	ExitBySeverity *bool   `json:"exitBySeverity"`
+	FieldsInMessage *string `json:"fieldsInMessage"`
+	PartialIndex   *bool   `json:"partialIndex"`
+	Canonicalize   *string `json:"canonicalize"`
+	PeriodicTZ     *string `json:"periodicTz"`
+	Progress       *bool   `json:"progress"`
+	StrictStore    *bool   `json:"strictStore"`
+	StampIngest    *bool   `json:"stampIngest"`
+	QueryFile      *string `json:"queryFile"`
+	QueryCombine   *string `json:"queryCombine"`
+	Baseline       *string `json:"baseline"`
+	UpdateBaseline *bool   `json:"updateBaseline"`
+	NamedQuery     *string `json:"namedQuery"`
+	ShardDedup     *bool   `json:"shardDedup"`
+	NumericIndex   *string `json:"numericIndex"`
+	// Queries is a catalog of DSL queries by name, run with --named-query.
+	Queries map[string]string `json:"queries"`
+	SeverityExitCodes *string `json:"severityExitCodes"`
 	Format        *string `json:"format"`
 	Store         *string `json:"store"`
 	Load          *string `json:"load"`
@@ -40,6 +62,61 @@ type Config struct {
 	Cleanup       *bool   `json:"cleanup"`
 	CleanupDryRun *bool   `json:"cleanupDryRun"`
 	CleanupConfirm *bool  `json:"cleanupConfirm"`
+	MaxEntries     *int   `json:"maxEntries"`
+	Sort           *string `json:"sort"`
+	PlanOnly       *bool   `json:"planOnly"`
+	ApiKeyFile     *string `json:"apiKeyFile"`
+	MergeSnapshots *string `json:"mergeSnapshots"`
+	MinLevel       *string `json:"minLevel"`
+	UnknownLevelRank *string `json:"unknownLevelRank"`
+	SplitByLevel   *string `json:"splitByLevel"`
+	TimeTolerance  *string `json:"timeTolerance"`
+	SinceFile      *string `json:"sinceFile"`
+	LevelMap       *string `json:"levelMap"`
+	CPUProfile     *string `json:"cpuProfile"`
+	MemProfile     *string `json:"memProfile"`
+	Compact        *bool   `json:"compact"`
+	CompactWorkers *int    `json:"compactWorkers"`
+	OutputAppend   *bool   `json:"outputAppend"`
+	MaxMemoryEntries *int  `json:"maxMemoryEntries"`
+	DefaultLevel   *string `json:"defaultLevel"`
+	BatchSize      *int    `json:"batchSize"`
+	IndexStats     *bool   `json:"indexStats"`
+	Compression    *string `json:"compression"`
+	CoalesceFields *bool   `json:"coalesceFields"`
+	Watch          *bool   `json:"watch"`
+	ShardSorted    *bool   `json:"shardSorted"`
+	Expr           *string `json:"expr"`
+	NoSkipMalformed *bool  `json:"noSkipMalformed"`
+	TailAlertFile  *string `json:"tailAlertFile"`
+	TailAlertLevel *string `json:"tailAlertLevel"`
+	UIBasePath     *string `json:"uiBasePath"`
+	Report         *bool   `json:"report"`
+	ReportTop      *int    `json:"reportTop"`
+	DefaultLimit   *int    `json:"defaultLimit"`
+	MaxLimit       *int    `json:"maxLimit"`
+	KeepRaw        *bool   `json:"keepRaw"`
+	ImportJSONL    *string `json:"importJsonl"`
+	Listen         *string `json:"listen"`
+	DedupKey       *string `json:"dedupKey"`
+	MetricsJSON    *bool   `json:"metricsJson"`
+	VerifyShards   *bool   `json:"verifyShards"`
+	ShardCompress  *bool   `json:"shardCompress"`
+	DistinctMessages *bool `json:"distinctMessages"`
+	Host           *string `json:"host"`
+	UTC            *bool   `json:"utc"`
+	Compare        *string `json:"compare"`
+	MaxIOConcurrency *int  `json:"maxIoConcurrency"`
+	Head           *int    `json:"head"`
+	TailN          *int    `json:"tailN"`
+	Bloom          *bool   `json:"bloom"`
+	NormalizeLevelsReport *bool `json:"normalizeLevelsReport"`
+	MissingTS      *string `json:"missingTs"`
+	ShutdownTimeout *string `json:"shutdownTimeout"`
+	ValidateJSONL  *string `json:"validateJsonl"`
+	SnapshotFiltered *bool `json:"snapshotFiltered"`
+	ReplayDedup    *bool   `json:"replayDedup"`
+	WatchInterval  *string `json:"watchInterval"`
 }
 
 // Load reads a JSON config file from disk.
@@ -0,0 +1,126 @@
+// Package decompress opens log inputs and stored JSONL files that may be
+// gzip-, bzip2- or zstd-compressed. Both ingest and store read through it.
+package decompress
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec selects how an input file is decompressed.
+type Codec string
+
+const (
+	Auto  Codec = "auto" // pick by file extension
+	None  Codec = "none"
+	Gzip  Codec = "gzip"
+	Bzip2 Codec = "bzip2"
+	Zstd  Codec = "zstd"
+)
+
+// ErrUnsupported is returned for a codec that is not built in.
+var ErrUnsupported = errors.New("unsupported compression")
+
+// Parse validates a --compression value. Empty means auto.
+func Parse(value string) (Codec, error) {
+	switch c := Codec(strings.ToLower(strings.TrimSpace(value))); c {
+	case "":
+		return Auto, nil
+	case Auto, None, Gzip, Bzip2, Zstd:
+		return c, nil
+	case "gz":
+		return Gzip, nil
+	case "bz2":
+		return Bzip2, nil
+	case "zst":
+		return Zstd, nil
+	default:
+		return "", fmt.Errorf("invalid compression %q (use auto, none, gzip, bzip2, or zstd)", value)
+	}
+}
+
+// ForPath picks a codec from the file extension (.gz, .bz2, .zst).
+func ForPath(path string) Codec {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		return Gzip
+	case ".bz2":
+		return Bzip2
+	case ".zst":
+		return Zstd
+	default:
+		return None
+	}
+}
+
+// Open opens path and wraps it in a decompressor. Auto (or empty) selects the
+// codec by extension; any other value overrides it.
+func Open(path string, c Codec) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return Wrap(f, path, c)
+}
+
+// Wrap decompresses an already opened stream named name (a path or URL) like
+// Open does. Closing the result closes rc; on error rc is closed.
+func Wrap(rc io.ReadCloser, name string, c Codec) (io.ReadCloser, error) {
+	if c == "" || c == Auto {
+		c = ForPath(name)
+	}
+	switch c {
+	case None:
+		return rc, nil
+	case Gzip:
+		zr, err := gzip.NewReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return &reader{Reader: zr, closers: []io.Closer{zr, rc}}, nil
+	case Bzip2:
+		return &reader{Reader: bzip2.NewReader(rc), closers: []io.Closer{rc}}, nil
+	case Zstd:
+		zr, err := zstd.NewReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return &reader{Reader: zr, closers: []io.Closer{closerFunc(zr.Close), rc}}, nil
+	default:
+		rc.Close()
+		return nil, fmt.Errorf("%s: %w: %s", name, ErrUnsupported, c)
+	}
+}
+
+// closerFunc adapts a Close method that returns nothing, like zstd.Decoder's.
+type closerFunc func()
+
+func (f closerFunc) Close() error {
+	f()
+	return nil
+}
+
+type reader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *reader) Close() error {
+	var first error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
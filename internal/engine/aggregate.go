@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/query"
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+// MaxAggregateBuckets bounds the number of buckets one Aggregate call may return.
+const MaxAggregateBuckets = 10000
+
+// AggregateBucket holds the metrics for one time bucket.
+type AggregateBucket struct {
+	Start     time.Time      `json:"start"`
+	Total     int            `json:"total"`
+	Levels    map[string]int `json:"levels"`
+	Errors    int            `json:"errors"`
+	ErrorRate float64        `json:"error_rate"`
+}
+
+// Aggregate counts entries matching filters per UTC time bucket of the given width.
+// Errors counts entries ranked ERROR or above; ErrorRate is Errors/Total. Buckets
+// are contiguous from the first to the last match, with empty ones zero-filled so
+// the result can be charted directly.
+func Aggregate(entries []types.LogEntry, filters query.Filters, bucket time.Duration) ([]AggregateBucket, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("bucket must be positive")
+	}
+	errorRank := query.LevelRank("ERROR")
+
+	byStart := make(map[int64]*AggregateBucket)
+	var first, last time.Time
+	for _, e := range entries {
+		if !query.MatchesFilters(e, filters) {
+			continue
+		}
+		start := e.Timestamp.UTC().Truncate(bucket)
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+		if int64(last.Sub(first)/bucket) >= MaxAggregateBuckets {
+			return nil, fmt.Errorf("more than %d buckets; use a wider bucket or narrow the time range", MaxAggregateBuckets)
+		}
+		b, ok := byStart[start.UnixNano()]
+		if !ok {
+			b = &AggregateBucket{Start: start, Levels: make(map[string]int)}
+			byStart[start.UnixNano()] = b
+		}
+		b.Total++
+		b.Levels[e.Level]++
+		if query.LevelRank(e.Level) >= errorRank {
+			b.Errors++
+		}
+	}
+	if len(byStart) == 0 {
+		return []AggregateBucket{}, nil
+	}
+
+	out := make([]AggregateBucket, 0, int(last.Sub(first)/bucket)+1)
+	for t := first; !t.After(last); t = t.Add(bucket) {
+		b, ok := byStart[t.UnixNano()]
+		if !ok {
+			out = append(out, AggregateBucket{Start: t, Levels: map[string]int{}})
+			continue
+		}
+		b.ErrorRate = float64(b.Errors) / float64(b.Total)
+		out = append(out, *b)
+	}
+	return out, nil
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+const (
+	// BaselineWindow is how many past runs a baseline keeps per level.
+	BaselineWindow = 20
+	// AnomalyZ is how far (in standard deviations) a level count may move
+	// from its baseline mean before the run is flagged.
+	AnomalyZ = 3.0
+)
+
+// Baseline holds per-level match counts of previous runs, oldest first. Every
+// level has one count per run (0 when the run had none).
+type Baseline struct {
+	Runs   int              `json:"runs"`
+	Levels map[string][]int `json:"levels"`
+}
+
+// LevelDelta compares one level's count with its baseline. Z is the distance
+// from the mean in standard deviations, with the deviation floored at the
+// square root of the mean (and at 1) so small or steady counts are not
+// flagged for trivial moves.
+type LevelDelta struct {
+	Level string
+	Count int
+	Mean  float64
+	Z     float64
+}
+
+// BaselineComparison is the result of Baseline.Compare.
+type BaselineComparison struct {
+	Runs    int
+	Anomaly bool
+	Deltas  []LevelDelta
+}
+
+// LoadBaseline reads a baseline file; a missing file is an empty baseline.
+func LoadBaseline(path string) (Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Baseline{}, nil
+		}
+		return Baseline{}, err
+	}
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return Baseline{}, err
+	}
+	return b, nil
+}
+
+// SaveBaseline writes b to path as indented JSON.
+func SaveBaseline(path string, b Baseline) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// LevelCounts counts entries per upper-cased level.
+func LevelCounts(entries []types.LogEntry) map[string]int {
+	counts := make(map[string]int)
+	for _, e := range entries {
+		counts[strings.ToUpper(e.Level)]++
+	}
+	return counts
+}
+
+// Compare scores counts against the baseline. An empty baseline yields no
+// deltas and no anomaly; levels new to the baseline compare against a mean of 0.
+func (b Baseline) Compare(counts map[string]int) BaselineComparison {
+	cmp := BaselineComparison{Runs: b.Runs}
+	if b.Runs == 0 {
+		return cmp
+	}
+	for _, level := range b.levelNames(counts) {
+		history := b.Levels[level]
+		mean, sd := meanStdDev(history, b.Runs)
+		sd = math.Max(sd, math.Sqrt(math.Max(mean, 1)))
+		d := LevelDelta{Level: level, Count: counts[level], Mean: mean}
+		d.Z = (float64(d.Count) - mean) / sd
+		if math.Abs(d.Z) >= AnomalyZ {
+			cmp.Anomaly = true
+		}
+		cmp.Deltas = append(cmp.Deltas, d)
+	}
+	return cmp
+}
+
+// Add records counts as the newest run, keeping the last BaselineWindow runs.
+func (b *Baseline) Add(counts map[string]int) {
+	levels := b.levelNames(counts)
+	if b.Levels == nil {
+		b.Levels = make(map[string][]int)
+	}
+	runs := b.Runs
+	for _, level := range levels {
+		history := b.Levels[level]
+		for len(history) < runs {
+			history = append([]int{0}, history...)
+		}
+		history = append(history, counts[level])
+		if len(history) > BaselineWindow {
+			history = history[len(history)-BaselineWindow:]
+		}
+		b.Levels[level] = history
+	}
+	b.Runs++
+	if b.Runs > BaselineWindow {
+		b.Runs = BaselineWindow
+	}
+}
+
+// levelNames returns the levels in the baseline or in counts, sorted.
+func (b Baseline) levelNames(counts map[string]int) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for level := range b.Levels {
+		seen[level] = true
+		out = append(out, level)
+	}
+	for level := range counts {
+		if !seen[level] {
+			out = append(out, level)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// meanStdDev treats history as the last runs counts, with missing older runs
+// as 0.
+func meanStdDev(history []int, runs int) (float64, float64) {
+	if runs == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range history {
+		sum += float64(v)
+	}
+	mean := sum / float64(runs)
+	var sq float64
+	for _, v := range history {
+		sq += (float64(v) - mean) * (float64(v) - mean)
+	}
+	sq += float64(runs-len(history)) * mean * mean
+	return mean, math.Sqrt(sq / float64(runs))
+}
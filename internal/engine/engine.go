@@ -1,17 +1,29 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/armash/log-pipeline/internal/decompress"
 	"github.com/armash/log-pipeline/internal/index"
 	"github.com/armash/log-pipeline/internal/ingest"
 	"github.com/armash/log-pipeline/internal/query"
+	"github.com/armash/log-pipeline/internal/shard"
 	"github.com/armash/log-pipeline/internal/snapshot"
 	"github.com/armash/log-pipeline/internal/store"
 	"github.com/armash/log-pipeline/internal/types"
 )
 
+type SortOrder string
+
+const (
+	SortNone     SortOrder = ""
+	SortTimeAsc  SortOrder = "time-asc"
+	SortTimeDesc SortOrder = "time-desc"
+)
+
 type LoadOptions struct {
 	File            string
 	Format          ingest.Format
@@ -21,13 +33,80 @@ type LoadOptions struct {
 	ShardDir        string
 	ShardPaths      []string
 	Replay          bool
+	// ReplayDedup drops parsed entries that the replayed store already holds
+	// (by DedupKey) before they are kept or stored, so re-ingesting an
+	// append-only file only adds its new lines.
+	ReplayDedup bool
 	Retention       time.Duration
 	StoreHeaderText string
+	MaxEntries      int
+	LevelMap        map[string]string
+	DefaultLevel    string
+	Sort            SortOrder
+	Compression     decompress.Codec
+	CoalesceFields  bool
+	KeepRaw         bool
+	// StampIngest sets IngestedAt on parsed entries (see ingest.ReadOptions).
+	StampIngest bool
+	// UTC normalizes timestamps to UTC: parsed entries before they are stored,
+	// and loaded entries before indexing.
+	UTC bool
+	// MissingTimestamp keeps parsed lines that lack a timestamp (see ingest.MissingTimestamp).
+	MissingTimestamp ingest.MissingTimestamp
+	// SkipPartialLine leaves out an unterminated last line (see ingest.ReadOptions).
+	SkipPartialLine bool
+	// Store receives parsed entries and is replayed with Replay. When nil and
+	// StorePath is set, a store.JSONLStore at StorePath is used.
+	Store store.Store
+	// Shards controls how entries are appended to ShardDir (sorted, compressed).
+	Shards store.ShardOptions
+	// MaxParseErrors reports malformed input lines as warnings, with up to this
+	// many example lines (0 = skip them silently).
+	MaxParseErrors int
+	// ShardLimit and ShardFilters let newest-first shard reads stop early
+	// once enough matching entries have been loaded.
+	ShardLimit   int
+	ShardFilters query.Filters
+	// SnapshotIndexAfter and SnapshotIndexBefore, when either is set, rebuild a
+	// snapshot's index only for that time range (see index.FromSnapshotIndexRange).
+	// Only set them when every query on the result lies within the range.
+	SnapshotIndexAfter  time.Time
+	SnapshotIndexBefore time.Time
+	// ShardBloom skips shards whose bloom sidecar rules out ShardFilters' search
+	// terms. Only set it when just the matching entries are needed.
+	ShardBloom bool
+	// ShardDedup drops entries that several shards hold (by DedupKey) in a
+	// shard-only load; see store.DropDuplicates. Newest-first loads drop them
+	// before counting toward ShardLimit. Shards merged into a snapshot are
+	// always de-duplicated.
+	ShardDedup bool
+	// DedupKey identifies duplicates for ReplayDedup, ShardDedup and
+	// snapshot+shard loads; nil is timestamp,level,message.
+	DedupKey types.DedupKey
+	// Progress, if set, is called as shard files are loaded.
+	Progress store.ProgressFunc
 }
 
 type LoadStats struct {
 	LogsRead     int
 	LogsIngested int
+	Truncated    bool
+	DefaultLevel int
+	Malformed    int
+	// SynthesizedTimestamps counts entries given a timestamp under MissingTimestamp.
+	SynthesizedTimestamps int
+	// SourceCounts holds entries loaded per file for multi-file loads.
+	SourceCounts map[string]int
+	// ShardsSkipped counts shards a bloom filter ruled out for the search terms.
+	ShardsSkipped int
+	// ReplayOverlap counts parsed entries ReplayDedup found already in the store.
+	ReplayOverlap int
+	// ShardDuplicates counts loaded shard entries dropped as duplicates, by
+	// ShardDedup or when merging shards into a snapshot.
+	ShardDuplicates int
+	// ShardsStopped is set when a newest-first read stopped at ShardLimit and
+	// left older shards unread, so loaded and matched counts are lower bounds.
+	ShardsStopped bool
 }
 
 type QueryOptions struct {
@@ -45,6 +124,14 @@ type Metrics struct {
 	LogsFilteredOut int
 	LogsReturned   int
 	IndexEnabled   bool
+	Truncated      bool
+	// EarlyTerminated is set when the scan stopped at Limit matches, so
+	// LogsFilteredOut only covers the entries scanned before stopping.
+	EarlyTerminated bool
+	SourceCounts    map[string]int
+	ShardsSkipped   int
+	// Baseline is set when the run was compared with a --baseline file.
+	Baseline *BaselineComparison
 }
 
 func (m Metrics) Duration() time.Duration {
@@ -62,8 +149,35 @@ func (m Metrics) RatePerSec() (float64, bool) {
 // LoadEntries loads entries from a file or JSONL store and optionally appends to a store.
 type LoadResult struct {
 	Entries []types.LogEntry
-	Stats   LoadStats
-	Index   *index.Index
+	Stats    LoadStats
+	Index    *index.Index
+	Warnings []string
+	Quality  QualityStats
+	// SnapshotFilter is the query a filtered snapshot was written with; it is
+	// empty for full snapshots and other sources.
+	SnapshotFilter string
+}
+
+// QualityStats counts entries that parsed but look suspicious.
+type QualityStats struct {
+	FutureTimestamps int
+	UnknownLevels    int
+	EmptyMessages    int
+}
+
+// Warnings summarizes non-zero quality counters as human-readable lines.
+func (q QualityStats) Warnings() []string {
+	var out []string
+	if q.FutureTimestamps > 0 {
+		out = append(out, fmt.Sprintf("%d entries have future timestamps", q.FutureTimestamps))
+	}
+	if q.UnknownLevels > 0 {
+		out = append(out, fmt.Sprintf("%d entries have unknown levels", q.UnknownLevels))
+	}
+	if q.EmptyMessages > 0 {
+		out = append(out, fmt.Sprintf("%d entries have empty messages", q.EmptyMessages))
+	}
+	return out
 }
 
 type IngestStats struct {
@@ -71,12 +185,18 @@ type IngestStats struct {
 }
 
 func LoadEntries(opts LoadOptions) (LoadResult, error) {
+	st := opts.Store
+	if st == nil && opts.StorePath != "" {
+		st = store.NewJSONL(opts.StorePath)
+	}
 	var entries []types.LogEntry
 	stats := LoadStats{}
 	var loadedIndex *index.Index
+	var warnings []string
+	var snapshotFilter string
 
 	if opts.SnapshotPath != "" {
-		snap, err := snapshot.Load(opts.SnapshotPath)
+		snap, err := snapshot.LoadAuto(opts.SnapshotPath)
 		if err != nil {
 			return LoadResult{}, err
 		}
@@ -86,10 +206,11 @@ func LoadEntries(opts LoadOptions) (LoadResult, error) {
 		entries = append(entries, snap.Entries...)
 		stats.LogsRead = len(snap.Entries)
 		stats.LogsIngested = len(snap.Entries)
-		loadedIndex = index.FromSnapshotIndex(snap.Index, snap.Entries)
+		loadedIndex = index.FromSnapshotIndexRange(snap.Index, snap.Entries, opts.SnapshotIndexAfter, opts.SnapshotIndexBefore)
+		snapshotFilter = snap.Metadata.Filter
 
-		if opts.Replay && opts.StorePath != "" {
-			loaded, err := store.LoadJSONL(opts.StorePath)
+		if opts.Replay && st != nil {
+			loaded, err := st.Load()
 			if err != nil {
 				return LoadResult{}, err
 			}
@@ -98,8 +219,25 @@ func LoadEntries(opts LoadOptions) (LoadResult, error) {
 			stats.LogsIngested += len(loaded)
 			loadedIndex = nil
 		}
+
+		if len(opts.ShardPaths) > 0 {
+			// Cold data from the snapshot plus warm data from shards. Entries in
+			// both (same timestamp, level and message) keep the snapshot copy.
+			loaded, counts, err := store.LoadJSONLFromMany(opts.ShardPaths, opts.Progress)
+			if err != nil {
+				return LoadResult{}, err
+			}
+			stats.LogsRead += len(loaded)
+			before := len(entries)
+			entries = mergeUnique(entries, loaded, opts.DedupKey)
+			stats.ShardDuplicates = len(loaded) - (len(entries) - before)
+			shard.SortEntries(entries)
+			stats.LogsIngested = len(entries)
+			stats.SourceCounts = counts
+			loadedIndex = nil
+		}
 	} else if opts.LoadPath != "" {
-		loaded, err := store.LoadJSONL(opts.LoadPath)
+		loaded, err := store.NewJSONL(opts.LoadPath).Load()
 		if err != nil {
 			return LoadResult{}, err
 		}
@@ -107,64 +245,145 @@ func LoadEntries(opts LoadOptions) (LoadResult, error) {
 		stats.LogsRead = len(loaded)
 		stats.LogsIngested = len(loaded)
 	} else if len(opts.ShardPaths) > 0 {
-		loaded, err := store.LoadJSONLFromMany(opts.ShardPaths)
+		var loaded []types.LogEntry
+		var counts map[string]int
+		var err error
+		paths := opts.ShardPaths
+		if opts.ShardBloom {
+			paths, stats.ShardsSkipped = store.PruneShards(paths, opts.ShardFilters)
+		}
+		if opts.Sort == SortTimeDesc {
+			var desc store.DescLoad
+			loaded, desc, err = store.LoadJSONLFromManyDesc(paths, opts.ShardLimit, func(e types.LogEntry) bool {
+				return query.MatchesFilters(e, opts.ShardFilters)
+			}, opts.ShardDedup, opts.DedupKey, opts.Progress)
+			counts, stats.ShardDuplicates, stats.ShardsStopped = desc.Counts, desc.Duplicates, desc.Stopped
+			stats.LogsRead = len(loaded) + stats.ShardDuplicates
+		} else {
+			loaded, counts, err = store.LoadJSONLFromMany(paths, opts.Progress)
+			stats.LogsRead = len(loaded)
+			if err == nil && opts.ShardDedup {
+				loaded, stats.ShardDuplicates = store.DropDuplicates(loaded, opts.DedupKey)
+			}
+		}
 		if err != nil {
 			return LoadResult{}, err
 		}
 		entries = append(entries, loaded...)
-		stats.LogsRead = len(loaded)
 		stats.LogsIngested = len(loaded)
+		stats.SourceCounts = counts
 	} else {
-		if opts.Replay && opts.StorePath != "" {
-			loaded, err := store.LoadJSONL(opts.StorePath)
+		var stored []types.LogEntry
+		if opts.Replay && st != nil {
+			loaded, err := st.Load()
 			if err != nil {
 				return LoadResult{}, err
 			}
 			entries = append(entries, loaded...)
+			stored = loaded
 		}
 
-		newEntries, err := ingest.ReadLogFileWithFormat(opts.File, opts.Format)
+		newEntries, readStats, err := ingest.ReadLogFileWithOptions(opts.File, ingest.ReadOptions{
+			Format:           opts.Format,
+			MaxEntries:       opts.MaxEntries,
+			LevelMap:         opts.LevelMap,
+			DefaultLevel:     opts.DefaultLevel,
+			Compression:      opts.Compression,
+			CoalesceFields:   opts.CoalesceFields,
+			KeepRaw:          opts.KeepRaw,
+			StampIngest:      opts.StampIngest,
+			UTC:              opts.UTC,
+			MaxParseErrors:   opts.MaxParseErrors,
+			MissingTimestamp: opts.MissingTimestamp,
+			SkipPartialLine:  opts.SkipPartialLine,
+		})
 		if err != nil {
-			return LoadResult{}, err
+			var partial *ingest.PartialReadError
+			if !errors.As(err, &partial) {
+				return LoadResult{}, err
+			}
+			warnings = append(warnings, fmt.Sprintf("%s: %v (using partial results)", opts.File, err))
+		}
+		if readStats.DefaultLevel > 0 {
+			stats.DefaultLevel = readStats.DefaultLevel
+			warnings = append(warnings, fmt.Sprintf("%s: %d entries had no level and were assigned %s", opts.File, readStats.DefaultLevel, opts.DefaultLevel))
+		}
+		if readStats.SynthesizedTimestamps > 0 {
+			stats.SynthesizedTimestamps = readStats.SynthesizedTimestamps
+			source := "the ingest time"
+			if opts.MissingTimestamp == ingest.MissingTimestampPrevious {
+				source = "the previous entry's timestamp"
+			}
+			warnings = append(warnings, fmt.Sprintf("%s: %d entries had no timestamp and were assigned %s", opts.File, readStats.SynthesizedTimestamps, source))
+		}
+		if readStats.PartialLineBytes > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: left out a partial last line (%d bytes, no trailing newline yet)", opts.File, readStats.PartialLineBytes))
+		}
+		stats.Malformed = readStats.Malformed
+		if opts.MaxParseErrors > 0 && readStats.Malformed > 0 {
+			warnings = append(warnings, malformedWarnings(opts.File, readStats)...)
+		}
+		if readStats.Truncated {
+			stats.Truncated = true
+			warnings = append(warnings, fmt.Sprintf("%s: input truncated at %d entries (--max-entries)", opts.File, opts.MaxEntries))
 		}
-		entries = append(entries, newEntries...)
 		stats.LogsRead = len(newEntries)
+		if opts.ReplayDedup && opts.Replay && st != nil {
+			newEntries, stats.ReplayOverlap = dropStored(newEntries, stored, opts.DedupKey)
+		}
+		entries = append(entries, newEntries...)
 		stats.LogsIngested = len(newEntries)
 
-		if opts.StorePath != "" {
-			if opts.StoreHeaderText != "" {
-				if err := store.AppendHeader(opts.StorePath, opts.StoreHeaderText); err != nil {
-					return LoadResult{}, err
-				}
-			}
-			if err := store.AppendJSONL(opts.StorePath, newEntries); err != nil {
+		if st != nil {
+			if err := appendToStore(st, newEntries, opts.StoreHeaderText); err != nil {
 				return LoadResult{}, err
 			}
 		}
 
 		if opts.ShardDir != "" {
-			if err := store.AppendShards(opts.ShardDir, newEntries); err != nil {
+			if err := appendShards(opts.ShardDir, newEntries, opts.Shards); err != nil {
 				return LoadResult{}, err
 			}
 		}
 	}
 
+	if opts.UTC {
+		ingest.NormalizeUTC(entries)
+	}
+
 	if opts.Retention > 0 {
 		cutoff := time.Now().Add(-opts.Retention)
 		entries = applyRetention(entries, cutoff)
 	}
 
+	quality := checkQuality(entries, time.Now())
+
+	switch opts.Sort {
+	case SortTimeAsc:
+		shard.SortEntries(entries)
+	case SortTimeDesc:
+		shard.SortEntriesDesc(entries)
+	}
+
 	return LoadResult{
-		Entries: entries,
-		Stats:   stats,
-		Index:   loadedIndex,
+		Entries:        entries,
+		Stats:          stats,
+		Index:          loadedIndex,
+		Warnings:       warnings,
+		Quality:        quality,
+		SnapshotFilter: snapshotFilter,
 	}, nil
 }
 
 // QueryEntries filters entries and returns results with metrics.
+// Without an index the scan stops as soon as Limit matches are collected; entries are
+// already in output order (LoadEntries applies any sort), so the first matches are the
+// right ones. Indexed queries still filter every candidate before the limit is applied.
 func QueryEntries(entries []types.LogEntry, loadStats LoadStats, opts QueryOptions) ([]types.LogEntry, Metrics) {
 	start := time.Now()
 	var filtered []types.LogEntry
+	scanned := len(entries)
+	earlyStop := false
 	if opts.UseIndex {
 		idx := opts.Index
 		if idx == nil {
@@ -172,12 +391,17 @@ func QueryEntries(entries []types.LogEntry, loadStats LoadStats, opts QueryOptio
 		}
 		filtered = index.FilterWithFilters(entries, idx, opts.Filters)
 	} else {
-		filtered = make([]types.LogEntry, 0, len(entries))
-		for _, e := range entries {
+		filtered = make([]types.LogEntry, 0)
+		for i, e := range entries {
 			if !query.MatchesFilters(e, opts.Filters) {
 				continue
 			}
 			filtered = append(filtered, e)
+			if opts.Limit > 0 && len(filtered) >= opts.Limit {
+				scanned = i + 1
+				earlyStop = scanned < len(entries)
+				break
+			}
 		}
 	}
 
@@ -191,29 +415,28 @@ func QueryEntries(entries []types.LogEntry, loadStats LoadStats, opts QueryOptio
 		FinishedAt:      time.Now(),
 		LogsRead:        loadStats.LogsRead,
 		LogsIngested:    loadStats.LogsIngested,
-		LogsFilteredOut: len(entries) - len(filtered),
+		LogsFilteredOut: scanned - len(filtered),
 		LogsReturned:    len(limited),
 		IndexEnabled:    opts.UseIndex,
+		Truncated:       loadStats.Truncated,
+		EarlyTerminated: earlyStop,
+		SourceCounts:    loadStats.SourceCounts,
+		ShardsSkipped:   loadStats.ShardsSkipped,
 	}
 
 	return limited, metrics
 }
 
 // IngestEntries appends entries to stores and shards, and returns updated entries slice.
-func IngestEntries(existing []types.LogEntry, entries []types.LogEntry, storePath string, shardDir string, storeHeaderText string) ([]types.LogEntry, IngestStats, error) {
+func IngestEntries(existing []types.LogEntry, entries []types.LogEntry, st store.Store, shardDir string, storeHeaderText string, shards store.ShardOptions) ([]types.LogEntry, IngestStats, error) {
 	stats := IngestStats{LogsIngested: len(entries)}
-	if storePath != "" {
-		if storeHeaderText != "" {
-			if err := store.AppendHeader(storePath, storeHeaderText); err != nil {
-				return existing, stats, err
-			}
-		}
-		if err := store.AppendJSONL(storePath, entries); err != nil {
+	if st != nil {
+		if err := appendToStore(st, entries, storeHeaderText); err != nil {
 			return existing, stats, err
 		}
 	}
 	if shardDir != "" {
-		if err := store.AppendShards(shardDir, entries); err != nil {
+		if err := appendShards(shardDir, entries, shards); err != nil {
 			return existing, stats, err
 		}
 	}
@@ -221,6 +444,133 @@ func IngestEntries(existing []types.LogEntry, entries []types.LogEntry, storePat
 	return combined, stats, nil
 }
 
+// appendToStore writes an optional run header (for stores that keep one) and entries.
+func appendToStore(st store.Store, entries []types.LogEntry, header string) error {
+	if header != "" {
+		if h, ok := st.(store.HeaderAppender); ok {
+			if err := h.AppendHeader(header); err != nil {
+				return err
+			}
+		}
+	}
+	return st.Append(entries)
+}
+
+// malformedWarnings summarizes skipped lines, e.g.
+// "app.log: 12 lines failed to parse, e.g. line 44: invalid timestamp", followed by
+// one line per remaining collected example.
+func malformedWarnings(file string, rs ingest.ReadStats) []string {
+	noun := "lines"
+	if rs.Malformed == 1 {
+		noun = "line"
+	}
+	if len(rs.ParseErrors) == 0 {
+		return []string{fmt.Sprintf("%s: %d %s failed to parse", file, rs.Malformed, noun)}
+	}
+	out := []string{fmt.Sprintf("%s: %d %s failed to parse, e.g. %v", file, rs.Malformed, noun, rs.ParseErrors[0])}
+	for _, pe := range rs.ParseErrors[1:] {
+		out = append(out, fmt.Sprintf("%s: %v", file, pe))
+	}
+	return out
+}
+
+// Comparison is the result of CompareEntries.
+type Comparison struct {
+	OnlyA  []types.LogEntry
+	OnlyB  []types.LogEntry
+	Common int
+}
+
+// CompareEntries splits two entry sets by dedup key: entries of a with no
+// match in b, entries of b with no match in a, and the number of a's entries
+// that b also contains. Input order is kept.
+func CompareEntries(a []types.LogEntry, b []types.LogEntry, dedup types.DedupKey) Comparison {
+	inA := make(map[string]struct{}, len(a))
+	for _, e := range a {
+		inA[dedup.Key(e)] = struct{}{}
+	}
+	inB := make(map[string]struct{}, len(b))
+	for _, e := range b {
+		inB[dedup.Key(e)] = struct{}{}
+	}
+	var cmp Comparison
+	for _, e := range a {
+		if _, ok := inB[dedup.Key(e)]; ok {
+			cmp.Common++
+			continue
+		}
+		cmp.OnlyA = append(cmp.OnlyA, e)
+	}
+	for _, e := range b {
+		if _, ok := inA[dedup.Key(e)]; !ok {
+			cmp.OnlyB = append(cmp.OnlyB, e)
+		}
+	}
+	return cmp
+}
+
+// dropStored removes the entries of parsed that are already in stored, returning
+// the rest in order and how many were dropped. Keys are counted, so a line that
+// legitimately repeats is only dropped as many times as the store holds it.
+func dropStored(parsed []types.LogEntry, stored []types.LogEntry, dedup types.DedupKey) ([]types.LogEntry, int) {
+	counts := make(map[string]int, len(stored))
+	for _, e := range stored {
+		counts[dedup.Key(e)]++
+	}
+	kept := parsed[:0]
+	dropped := 0
+	for _, e := range parsed {
+		key := dedup.Key(e)
+		if counts[key] > 0 {
+			counts[key]--
+			dropped++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept, dropped
+}
+
+// mergeUnique appends the entries of extra whose key is not already in base.
+func mergeUnique(base []types.LogEntry, extra []types.LogEntry, dedup types.DedupKey) []types.LogEntry {
+	seen := make(map[string]struct{}, len(base))
+	for _, e := range base {
+		seen[dedup.Key(e)] = struct{}{}
+	}
+	for _, e := range extra {
+		key := dedup.Key(e)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		base = append(base, e)
+	}
+	return base
+}
+
+func appendShards(shardDir string, entries []types.LogEntry, opts store.ShardOptions) error {
+	if opts.Sorted {
+		return store.AppendShardsSorted(shardDir, entries, opts)
+	}
+	return store.AppendShards(shardDir, entries, opts)
+}
+
+func checkQuality(entries []types.LogEntry, now time.Time) QualityStats {
+	var q QualityStats
+	for _, e := range entries {
+		if e.Timestamp.After(now) {
+			q.FutureTimestamps++
+		}
+		if !query.IsKnownLevel(e.Level) {
+			q.UnknownLevels++
+		}
+		if strings.TrimSpace(e.Message) == "" {
+			q.EmptyMessages++
+		}
+	}
+	return q
+}
+
 func applyRetention(entries []types.LogEntry, cutoff time.Time) []types.LogEntry {
 	filtered := make([]types.LogEntry, 0, len(entries))
 	for _, e := range entries {
@@ -0,0 +1,260 @@
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/ingest"
+	"github.com/armash/log-pipeline/internal/query"
+	"github.com/armash/log-pipeline/internal/snapshot"
+	"github.com/armash/log-pipeline/internal/store"
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+// entryAt is an entry at 2026-02-<day> hour:min UTC.
+func entryAt(day, hour, min int, level, msg string) types.LogEntry {
+	return types.LogEntry{Timestamp: time.Date(2026, 2, day, hour, min, 0, 0, time.UTC), Level: level, Message: msg}
+}
+
+func TestLoadSnapshotWithShards(t *testing.T) {
+	dir := t.TempDir()
+	snapPath := filepath.Join(dir, "snap.json")
+	if err := snapshot.Create(snapPath, []types.LogEntry{entryAt(7, 1, 0, "INFO", "cold"), entryAt(8, 1, 0, "INFO", "overlap")}, nil); err != nil {
+		t.Fatalf("snapshot.Create() error = %v", err)
+	}
+	shardDir := filepath.Join(dir, "shards")
+	if err := store.AppendShards(shardDir, []types.LogEntry{entryAt(8, 1, 0, "INFO", "overlap"), entryAt(8, 2, 0, "INFO", "warm")}, store.ShardOptions{}); err != nil {
+		t.Fatalf("AppendShards() error = %v", err)
+	}
+
+	result, err := LoadEntries(LoadOptions{
+		SnapshotPath: snapPath,
+		ShardPaths:   []string{filepath.Join(shardDir, "2026-02-08.jsonl")},
+	})
+	if err != nil {
+		t.Fatalf("LoadEntries() error = %v", err)
+	}
+	want := []string{"cold", "overlap", "warm"}
+	if len(result.Entries) != len(want) {
+		t.Fatalf("LoadEntries() got %d entries, want %d", len(result.Entries), len(want))
+	}
+	for i, w := range want {
+		if result.Entries[i].Message != w {
+			t.Errorf("entry %d = %q, want %q", i, result.Entries[i].Message, w)
+		}
+	}
+	if result.Index != nil {
+		t.Errorf("snapshot index should be dropped so the union is re-indexed")
+	}
+	if result.Stats.LogsRead != 4 || result.Stats.LogsIngested != 3 || result.Stats.ShardDuplicates != 1 {
+		t.Errorf("stats = %+v, want 4 read, 3 kept and 1 shard duplicate", result.Stats)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	entries := []types.LogEntry{
+		entryAt(8, 10, 5, "INFO", "m"), entryAt(8, 10, 20, "ERROR", "m"), entryAt(8, 10, 40, "WARN", "m"), entryAt(8, 10, 50, "FATAL", "m"),
+		entryAt(8, 12, 0, "INFO", "m"),
+	}
+	got, err := Aggregate(entries, query.Filters{}, time.Hour)
+	if err != nil {
+		t.Fatalf("Aggregate() error = %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Aggregate() returned %d buckets, want 3 (gap zero-filled)", len(got))
+	}
+	if got[0].Total != 4 || got[0].Errors != 2 || got[0].ErrorRate != 0.5 || got[0].Levels["WARN"] != 1 {
+		t.Errorf("bucket 10:00 = %+v, want total 4, errors 2, rate 0.5", got[0])
+	}
+	if got[1].Total != 0 || !got[1].Start.Equal(time.Date(2026, 2, 8, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("bucket 11:00 = %+v, want empty", got[1])
+	}
+	if got[2].Total != 1 || got[2].ErrorRate != 0 {
+		t.Errorf("bucket 12:00 = %+v, want total 1, rate 0", got[2])
+	}
+
+	if _, err := Aggregate(entries, query.Filters{}, time.Millisecond); err == nil {
+		t.Errorf("Aggregate() with too many buckets: want error")
+	}
+}
+
+func TestCompareEntries(t *testing.T) {
+	a := []types.LogEntry{entryAt(8, 10, 1, "INFO", "kept"), entryAt(8, 10, 2, "INFO", "removed"), entryAt(8, 10, 3, "INFO", "kept too")}
+	b := []types.LogEntry{entryAt(8, 10, 1, "INFO", "kept"), entryAt(8, 10, 3, "INFO", "kept too"), entryAt(8, 10, 4, "INFO", "added")}
+	got := CompareEntries(a, b, nil)
+	if got.Common != 2 {
+		t.Errorf("Common = %d, want 2", got.Common)
+	}
+	if len(got.OnlyA) != 1 || got.OnlyA[0].Message != "removed" {
+		t.Errorf("OnlyA = %+v, want [removed]", got.OnlyA)
+	}
+	if len(got.OnlyB) != 1 || got.OnlyB[0].Message != "added" {
+		t.Errorf("OnlyB = %+v, want [added]", got.OnlyB)
+	}
+}
+
+// memStore is an in-memory store.Store used to check that the engine only
+// persists through the interface.
+type memStore struct{ entries []types.LogEntry }
+
+func (m *memStore) Append(entries []types.LogEntry) error {
+	m.entries = append(m.entries, entries...)
+	return nil
+}
+
+func (m *memStore) Load() ([]types.LogEntry, error) {
+	return append([]types.LogEntry(nil), m.entries...), nil
+}
+
+func TestLoadEntriesCustomStore(t *testing.T) {
+	st := &memStore{}
+	res, err := LoadEntries(LoadOptions{File: filepath.Join("..", "..", "samples", "sample.log"), Format: ingest.FormatPlain, Store: st})
+	if err != nil {
+		t.Fatalf("LoadEntries() error = %v", err)
+	}
+	if len(st.entries) == 0 || len(st.entries) != len(res.Entries) {
+		t.Fatalf("store got %d entries, want the %d parsed", len(st.entries), len(res.Entries))
+	}
+
+	combined, _, err := IngestEntries(res.Entries, []types.LogEntry{{Timestamp: time.Now(), Level: "INFO", Message: "x"}}, st, "", "", store.ShardOptions{})
+	if err != nil {
+		t.Fatalf("IngestEntries() error = %v", err)
+	}
+	if len(st.entries) != len(combined) {
+		t.Errorf("store has %d entries after ingest, want %d", len(st.entries), len(combined))
+	}
+
+	replayed, err := LoadEntries(LoadOptions{File: filepath.Join("..", "..", "samples", "sample.log"), Format: ingest.FormatPlain, Store: &memStore{entries: st.entries}, Replay: true})
+	if err != nil {
+		t.Fatalf("LoadEntries(replay) error = %v", err)
+	}
+	if want := len(combined) + len(res.Entries); len(replayed.Entries) != want {
+		t.Errorf("replayed %d entries, want %d", len(replayed.Entries), want)
+	}
+}
+
+func TestReplayDedup(t *testing.T) {
+	file := filepath.Join("..", "..", "samples", "sample.log")
+	st := &memStore{}
+	first, err := LoadEntries(LoadOptions{File: file, Format: ingest.FormatPlain, Store: st, Replay: true, ReplayDedup: true})
+	if err != nil {
+		t.Fatalf("LoadEntries() error = %v", err)
+	}
+	parsed := len(first.Entries)
+
+	again, err := LoadEntries(LoadOptions{File: file, Format: ingest.FormatPlain, Store: st, Replay: true, ReplayDedup: true})
+	if err != nil {
+		t.Fatalf("LoadEntries(again) error = %v", err)
+	}
+	if len(again.Entries) != parsed || len(st.entries) != parsed {
+		t.Errorf("second run kept %d entries and stored %d, want %d each", len(again.Entries), len(st.entries), parsed)
+	}
+	if again.Stats.ReplayOverlap != parsed || again.Stats.LogsIngested != 0 {
+		t.Errorf("stats = %+v, want overlap %d and nothing ingested", again.Stats, parsed)
+	}
+}
+
+func TestDropStoredCountsRepeats(t *testing.T) {
+	ts := time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC)
+	line := types.LogEntry{Timestamp: ts, Level: "INFO", Message: "tick"}
+	kept, dropped := dropStored([]types.LogEntry{line, line, line}, []types.LogEntry{line, line}, nil)
+	if len(kept) != 1 || dropped != 2 {
+		t.Errorf("dropStored() kept %d, dropped %d; want 1 and 2", len(kept), dropped)
+	}
+}
+
+func TestSnapshotIndexRange(t *testing.T) {
+	base := time.Date(2026, 2, 8, 0, 0, 0, 0, time.UTC)
+	var entries []types.LogEntry
+	for h := 0; h < 24; h++ {
+		entries = append(entries, types.LogEntry{Timestamp: base.Add(time.Duration(h) * time.Hour), Level: "ERROR", Message: "tick"})
+	}
+	snapPath := filepath.Join(t.TempDir(), "snap.json")
+	if err := snapshot.Create(snapPath, entries, nil); err != nil {
+		t.Fatalf("snapshot.Create() error = %v", err)
+	}
+
+	filters := query.Filters{Level: "ERROR", After: base.Add(20 * time.Hour)}
+	after, before := query.TimeBounds(filters)
+	result, err := LoadEntries(LoadOptions{SnapshotPath: snapPath, SnapshotIndexAfter: after, SnapshotIndexBefore: before})
+	if err != nil {
+		t.Fatalf("LoadEntries() error = %v", err)
+	}
+	if got := len(result.Index.Hours); got != 4 {
+		t.Errorf("index has %d hour buckets, want the 4 from 20:00", got)
+	}
+	if got := len(result.Index.ByLevel["ERROR"]); got != 4 {
+		t.Errorf("ERROR bucket has %d entries, want 4", got)
+	}
+	matched, _ := QueryEntries(result.Entries, result.Stats, QueryOptions{Filters: filters, UseIndex: true, Index: result.Index})
+	if len(matched) != 4 {
+		t.Errorf("ranged query matched %d, want 4", len(matched))
+	}
+}
+
+func TestIndexedOrKeepsDistinctEntries(t *testing.T) {
+	base := time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC)
+	entries := []types.LogEntry{
+		{Timestamp: base, Level: "ERROR", Message: "disk full"},
+		{Timestamp: base.Add(time.Second), Level: "WARN", Message: "disk full"},
+		{Timestamp: base.Add(time.Second), Level: "WARN", Message: "disk full"},
+		{Timestamp: base.Add(2 * time.Second), Level: "INFO", Message: "disk full"},
+	}
+	filters, err := query.Parse("level=ERROR OR level=WARN OR message~disk")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	scanned, _ := QueryEntries(entries, LoadStats{}, QueryOptions{Filters: filters})
+	indexed, _ := QueryEntries(entries, LoadStats{}, QueryOptions{Filters: filters, UseIndex: true})
+	if len(scanned) != 4 || len(indexed) != 4 {
+		t.Errorf("OR query matched %d scanned and %d indexed, want all 4 entries both ways", len(scanned), len(indexed))
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	b, err := LoadBaseline(path)
+	if err != nil {
+		t.Fatalf("LoadBaseline(missing) error = %v", err)
+	}
+	if cmp := b.Compare(map[string]int{"ERROR": 50}); cmp.Anomaly || len(cmp.Deltas) != 0 {
+		t.Fatalf("empty baseline Compare() = %+v, want nothing to compare", cmp)
+	}
+
+	for _, errs := range []int{4, 6, 5, 5} {
+		b.Add(map[string]int{"ERROR": errs, "INFO": 100})
+	}
+	// A level seen for the first time counts as 0 in earlier runs.
+	b.Add(map[string]int{"ERROR": 5, "INFO": 100, "WARN": 1})
+	if err := SaveBaseline(path, b); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = LoadBaseline(path); err != nil {
+		t.Fatal(err)
+	}
+	if b.Runs != 5 || len(b.Levels["WARN"]) != 5 || b.Levels["WARN"][0] != 0 {
+		t.Fatalf("baseline = %+v, want 5 runs with WARN padded", b)
+	}
+
+	cmp := b.Compare(map[string]int{"ERROR": 6, "INFO": 98})
+	if cmp.Anomaly {
+		t.Errorf("normal run flagged: %+v", cmp.Deltas)
+	}
+	cmp = b.Compare(map[string]int{"ERROR": 40, "INFO": 100})
+	if !cmp.Anomaly {
+		t.Fatalf("error spike not flagged: %+v", cmp.Deltas)
+	}
+	for _, d := range cmp.Deltas {
+		if d.Level == "ERROR" && (d.Mean != 5 || d.Z < AnomalyZ) {
+			t.Errorf("ERROR delta = %+v, want mean 5 and z >= %v", d, AnomalyZ)
+		}
+	}
+
+	for i := 0; i < BaselineWindow+5; i++ {
+		b.Add(map[string]int{"ERROR": 1})
+	}
+	if b.Runs != BaselineWindow || len(b.Levels["ERROR"]) != BaselineWindow {
+		t.Errorf("baseline kept %d runs (%d ERROR counts), want %d", b.Runs, len(b.Levels["ERROR"]), BaselineWindow)
+	}
+}
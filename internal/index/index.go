@@ -1,6 +1,9 @@
 package index
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
 	"sort"
 	"strings"
 	"time"
@@ -13,6 +16,50 @@ type Index struct {
 	ByLevel map[string][]types.LogEntry
 	ByHour  map[string][]types.LogEntry
 	Hours   []string
+	// NumericField names the entry field Numeric is sorted on; "" means no
+	// numeric index. See WithNumeric.
+	NumericField string
+	Numeric      []NumericEntry
+}
+
+// NumericEntry is an entry in Index.Numeric with its NumericField value and
+// its position in the indexed entries.
+type NumericEntry struct {
+	Value float64
+	Pos   int
+	Entry types.LogEntry
+}
+
+// Stats describes the shape of an index.
+type Stats struct {
+	Levels      map[string]int `json:"levels"`
+	HourBuckets int            `json:"hourBuckets"`
+	LargestHour int            `json:"largestHour"`
+	First       time.Time      `json:"first"`
+	Last        time.Time      `json:"last"`
+}
+
+// Stats returns bucket counts and the time span covered by the index.
+func (idx *Index) Stats() Stats {
+	st := Stats{Levels: make(map[string]int, len(idx.ByLevel))}
+	for level, entries := range idx.ByLevel {
+		st.Levels[level] = len(entries)
+	}
+	st.HourBuckets = len(idx.ByHour)
+	for _, entries := range idx.ByHour {
+		if len(entries) > st.LargestHour {
+			st.LargestHour = len(entries)
+		}
+		for _, e := range entries {
+			if st.First.IsZero() || e.Timestamp.Before(st.First) {
+				st.First = e.Timestamp
+			}
+			if e.Timestamp.After(st.Last) {
+				st.Last = e.Timestamp
+			}
+		}
+	}
+	return st
 }
 
 // SnapshotIndex stores index buckets as entry indices for snapshot persistence.
@@ -46,6 +93,57 @@ func Build(entries []types.LogEntry) *Index {
 	return idx
 }
 
+// WithNumeric returns a copy of idx that also holds a sorted index on the
+// numeric field, built from entries (the ones idx was built from). Entries whose
+// field is missing or not a number are left out, since field comparisons never
+// match them.
+func (idx *Index) WithNumeric(entries []types.LogEntry, field string) *Index {
+	out := *idx
+	out.NumericField = field
+	out.Numeric = make([]NumericEntry, 0)
+	for i, e := range entries {
+		v, ok := query.NumericField(e, field)
+		if !ok || math.IsNaN(v) {
+			continue
+		}
+		out.Numeric = append(out.Numeric, NumericEntry{Value: v, Pos: i, Entry: e})
+	}
+	sort.SliceStable(out.Numeric, func(i, j int) bool { return out.Numeric[i].Value < out.Numeric[j].Value })
+	return &out
+}
+
+// numericRange returns the entries whose NumericField value satisfies every
+// comparison, in their original order, by binary search over Numeric.
+func numericRange(idx *Index, cmps []query.Comparison) []types.LogEntry {
+	lo, hi := 0, len(idx.Numeric)
+	for _, c := range cmps {
+		// i is the first position whose value is above c.Value (> and <=) or
+		// at least c.Value (>= and <).
+		above := c.Op == ">" || c.Op == "<="
+		i := sort.Search(len(idx.Numeric), func(i int) bool {
+			if above {
+				return idx.Numeric[i].Value > c.Value
+			}
+			return idx.Numeric[i].Value >= c.Value
+		})
+		if c.Op == ">" || c.Op == ">=" {
+			lo = max(lo, i)
+		} else {
+			hi = min(hi, i)
+		}
+	}
+	if lo >= hi {
+		return nil
+	}
+	hits := append([]NumericEntry(nil), idx.Numeric[lo:hi]...)
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Pos < hits[j].Pos })
+	out := make([]types.LogEntry, 0, len(hits))
+	for _, h := range hits {
+		out = append(out, h.Entry)
+	}
+	return out
+}
+
 // ToSnapshotIndex converts an in-memory index into a snapshot-friendly index.
 func ToSnapshotIndex(idx *Index, entries []types.LogEntry) SnapshotIndex {
 	si := SnapshotIndex{
@@ -98,6 +196,47 @@ func FromSnapshotIndex(si SnapshotIndex, entries []types.LogEntry) *Index {
 	return idx
 }
 
+// FromSnapshotIndexRange is FromSnapshotIndex restricted to the hour buckets
+// that overlap [after, before); a zero bound is open. Entries outside those
+// hours are left out of ByLevel too, so the index is only good for queries whose
+// time range lies within [after, before), which is what saves the memory.
+func FromSnapshotIndexRange(si SnapshotIndex, entries []types.LogEntry, after, before time.Time) *Index {
+	if after.IsZero() && before.IsZero() {
+		return FromSnapshotIndex(si, entries)
+	}
+	inRange := func(hour string) bool {
+		if !after.IsZero() && hour < hourBucket(after) {
+			return false
+		}
+		return before.IsZero() || hour <= hourBucket(before)
+	}
+
+	idx := &Index{
+		ByLevel: make(map[string][]types.LogEntry),
+		ByHour:  make(map[string][]types.LogEntry),
+	}
+	for _, hour := range si.Hours {
+		if !inRange(hour) {
+			continue
+		}
+		idx.Hours = append(idx.Hours, hour)
+		for _, i := range si.ByHour[hour] {
+			if i >= 0 && i < len(entries) {
+				idx.ByHour[hour] = append(idx.ByHour[hour], entries[i])
+			}
+		}
+	}
+	for level, indices := range si.ByLevel {
+		for _, i := range indices {
+			if i >= 0 && i < len(entries) && inRange(hourBucket(entries[i].Timestamp)) {
+				idx.ByLevel[level] = append(idx.ByLevel[level], entries[i])
+			}
+		}
+	}
+
+	return idx
+}
+
 // Filter returns entries matching the filters using indexes when available.
 func Filter(all []types.LogEntry, idx *Index, level string, cutoff time.Time, search string) []types.LogEntry {
 	candidates := all
@@ -129,40 +268,50 @@ func Filter(all []types.LogEntry, idx *Index, level string, cutoff time.Time, se
 // FilterWithFilters returns entries matching query filters using indexes when available.
 func FilterWithFilters(all []types.LogEntry, idx *Index, f query.Filters) []types.LogEntry {
 	if len(f.Or) > 0 {
+		// An entry matching several branches must be returned once, but two
+		// distinct entries must both be kept even when identical. Matching only
+		// depends on an entry's content, so every copy of an entry lands in
+		// the same branches: skipping content already returned by an earlier
+		// branch, while keeping repeats within one branch, keeps each entry
+		// exactly once.
 		combined := make([]types.LogEntry, 0)
 		seen := make(map[string]struct{})
 		for _, opt := range f.Or {
 			part := FilterWithFilters(all, idx, opt)
+			added := make([]string, 0, len(part))
 			for _, e := range part {
-				key := e.Timestamp.Format(time.RFC3339Nano) + "|" + e.Level + "|" + e.Message
+				key := contentKey(e)
 				if _, ok := seen[key]; ok {
 					continue
 				}
-				seen[key] = struct{}{}
+				added = append(added, key)
 				combined = append(combined, e)
 			}
+			for _, key := range added {
+				seen[key] = struct{}{}
+			}
 		}
 		return combined
 	}
 
 	candidates := all
 	if idx != nil {
-		if f.Level != "" {
+		if cmps := f.FieldCompare[idx.NumericField]; idx.NumericField != "" && len(cmps) > 0 {
+			candidates = numericRange(idx, cmps)
+		} else if f.Level != "" {
 			levelKey := strings.ToUpper(f.Level)
 			candidates = idx.ByLevel[levelKey]
 		} else if len(f.LevelIn) > 0 {
+			// Level buckets are disjoint, so only repeated levels need skipping.
 			union := make([]types.LogEntry, 0)
 			seen := make(map[string]struct{})
 			for _, lvl := range f.LevelIn {
 				levelKey := strings.ToUpper(lvl)
-				for _, e := range idx.ByLevel[levelKey] {
-					key := e.Timestamp.Format(time.RFC3339Nano) + "|" + e.Level + "|" + e.Message
-					if _, ok := seen[key]; ok {
-						continue
-					}
-					seen[key] = struct{}{}
-					union = append(union, e)
+				if _, ok := seen[levelKey]; ok {
+					continue
 				}
+				seen[levelKey] = struct{}{}
+				union = append(union, idx.ByLevel[levelKey]...)
 			}
 			candidates = union
 		} else if !f.After.IsZero() {
@@ -187,13 +336,31 @@ func FilterWithFilters(all []types.LogEntry, idx *Index, f query.Filters) []type
 				continue
 			}
 		}
+		if !f.Options.MatchesMinLevel(e.Level, f.MinLevel) {
+			continue
+		}
 		if !f.After.IsZero() && e.Timestamp.Before(f.After) {
 			continue
 		}
 		if !f.Before.IsZero() && !e.Timestamp.Before(f.Before) {
 			continue
 		}
-		if f.Search != "" && !strings.Contains(strings.ToLower(e.Message), strings.ToLower(f.Search)) {
+		if !query.MatchesSearch(e, f) {
+			continue
+		}
+		if f.MessageEquals != "" && !strings.EqualFold(e.Message, f.MessageEquals) {
+			continue
+		}
+		if !query.MatchesNegated(e, f) {
+			continue
+		}
+		if !query.MatchesFields(e, f) {
+			continue
+		}
+		if !query.MatchesPeriodic(e, f) {
+			continue
+		}
+		if !f.Expr.Match(e, f.Options) {
 			continue
 		}
 		filtered = append(filtered, e)
@@ -201,6 +368,15 @@ func FilterWithFilters(all []types.LogEntry, idx *Index, f query.Filters) []type
 	return filtered
 }
 
+// contentKey identifies an entry by everything it holds.
+func contentKey(e types.LogEntry) string {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Sprintf("%#v", e)
+	}
+	return string(data)
+}
+
 func collectFromHourBuckets(idx *Index, cutoff time.Time) []types.LogEntry {
 	if idx == nil || len(idx.Hours) == 0 {
 		return nil
@@ -0,0 +1,76 @@
+package index
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/query"
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+func TestNumericIndexMatchesScan(t *testing.T) {
+	base := time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC)
+	var entries []types.LogEntry
+	for i := 0; i < 60; i++ {
+		fields := map[string]string{"latency_ms": strconv.Itoa((i * 37) % 1500)}
+		switch i % 10 {
+		case 3:
+			fields = nil // missing
+		case 7:
+			fields["latency_ms"] = "slow" // non-numeric
+		}
+		level := "INFO"
+		if i%4 == 0 {
+			level = "ERROR"
+		}
+		entries = append(entries, types.LogEntry{Timestamp: base.Add(time.Duration(i) * time.Minute), Level: level, Message: "req", Fields: fields})
+	}
+	// A repeated entry must come back as often as the scan returns it.
+	entries = append(entries, entries[5])
+
+	idx := Build(entries).WithNumeric(entries, "latency_ms")
+	if idx.NumericField != "latency_ms" || len(idx.Numeric) != 61-12 {
+		t.Fatalf("numeric index on %q holds %d entries, want 49", idx.NumericField, len(idx.Numeric))
+	}
+	for _, q := range []string{
+		"field.latency_ms>1000",
+		"field.latency_ms>=1036",
+		"field.latency_ms<100",
+		"field.latency_ms<=74",
+		"field.latency_ms>=200 field.latency_ms<600",
+		"field.latency_ms>1000 level=ERROR",
+		"field.latency_ms>900 field.latency_ms<100",
+		"field.latency_ms>5000",
+		"field.latency_ms>1000 OR level=ERROR",
+		"field.other>1",
+	} {
+		f, err := query.Parse(q)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", q, err)
+		}
+		var want []types.LogEntry
+		for _, e := range entries {
+			if query.MatchesFilters(e, f) {
+				want = append(want, e)
+			}
+		}
+		got := FilterWithFilters(entries, idx, f)
+		if len(got) == 0 && len(want) == 0 {
+			continue
+		}
+		if len(f.Or) > 0 {
+			// OR results come branch by branch, so only the set is comparable.
+			byTime := func(es []types.LogEntry) {
+				sort.SliceStable(es, func(i, j int) bool { return es[i].Timestamp.Before(es[j].Timestamp) })
+			}
+			byTime(got)
+			byTime(want)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: index returned %d entries, scan %d (or in another order)", q, len(got), len(want))
+		}
+	}
+}
@@ -2,14 +2,19 @@ package ingest
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/armash/log-pipeline/internal/decompress"
 	"github.com/armash/log-pipeline/internal/types"
 )
 
@@ -20,8 +25,187 @@ const (
 	FormatPlain  Format = "plain"
 	FormatJSON   Format = "json"
 	FormatLogfmt Format = "logfmt"
+	FormatGlog   Format = "glog"
 )
 
+// MissingTimestamp chooses what happens to lines that parse apart from lacking
+// a timestamp (banners, continuation lines).
+type MissingTimestamp string
+
+const (
+	// MissingTimestampDrop skips such lines as malformed (the default).
+	MissingTimestampDrop MissingTimestamp = "drop"
+	// MissingTimestampNow stamps them with the time they are read.
+	MissingTimestampNow MissingTimestamp = "now"
+	// MissingTimestampPrevious stamps them with the previous entry's timestamp.
+	MissingTimestampPrevious MissingTimestamp = "previous"
+)
+
+// ParseMissingTimestamp validates a --missing-ts value. Empty means drop.
+func ParseMissingTimestamp(value string) (MissingTimestamp, error) {
+	switch m := MissingTimestamp(strings.ToLower(strings.TrimSpace(value))); m {
+	case "":
+		return MissingTimestampDrop, nil
+	case MissingTimestampDrop, MissingTimestampNow, MissingTimestampPrevious:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid missing-ts mode %q (use now, previous, or drop)", value)
+	}
+}
+
+// missingTSNow supplies the ingest time for MissingTimestampNow.
+var missingTSNow = time.Now
+
+// fillMissingTimestamp completes an entry that failed with errMissingTimestamp.
+// prev is the last entry read, or nil. A line that also lacks a level gets
+// defaultLevel, or under MissingTimestampPrevious the previous entry's level.
+// ok is false when the line should still be skipped.
+func fillMissingTimestamp(entry types.LogEntry, mode MissingTimestamp, prev *types.LogEntry, defaultLevel string) (filled types.LogEntry, usedDefault bool, ok bool) {
+	switch mode {
+	case MissingTimestampNow:
+		entry.Timestamp = missingTSNow()
+	case MissingTimestampPrevious:
+		if prev == nil {
+			return entry, false, false
+		}
+		entry.Timestamp = prev.Timestamp
+	default:
+		return entry, false, false
+	}
+	if entry.Level == "" {
+		switch {
+		case defaultLevel != "":
+			entry.Level = defaultLevel
+			usedDefault = true
+		case mode == MissingTimestampPrevious:
+			entry.Level = prev.Level
+		default:
+			return entry, false, false
+		}
+	}
+	return entry, usedDefault, true
+}
+
+// ReadOptions controls how log lines are read and parsed.
+type ReadOptions struct {
+	Format     Format
+	MaxEntries int
+	// LevelMap rewrites parsed levels (keys are matched case-insensitively),
+	// e.g. numeric "30" to "WARN". Unmapped levels pass through.
+	LevelMap map[string]string
+	// DefaultLevel is assigned to JSON/logfmt lines that have a timestamp and
+	// message but no level. Empty means such lines are skipped.
+	DefaultLevel string
+	// Compression overrides extension-based decompression for file reads.
+	Compression decompress.Codec
+	// CoalesceFields joins repeated logfmt/JSON keys with "," instead of
+	// keeping only the last value.
+	CoalesceFields bool
+	// KeepRaw stores each original line in LogEntry.Raw. This roughly doubles
+	// the memory held per entry, so it is opt-in.
+	KeepRaw bool
+	// UTC converts parsed timestamps to UTC, dropping the source offset.
+	UTC bool
+	// MaxParseErrors keeps up to this many ParseErrors in ReadStats (0 = none).
+	// Malformed lines are still skipped either way.
+	MaxParseErrors int
+	// MissingTimestamp keeps lines that lack a timestamp; see MissingTimestamp.
+	// Empty means MissingTimestampDrop.
+	MissingTimestamp MissingTimestamp
+	// SkipPartialLine leaves out a last line that has no trailing newline, so a
+	// file that is still being appended to is read up to its last complete line
+	// instead of ingesting a half-written entry.
+	SkipPartialLine bool
+	// StampIngest sets LogEntry.IngestedAt to the time each line is parsed.
+	StampIngest bool
+}
+
+// ReadStats describes how a read finished.
+type ReadStats struct {
+	Lines        int // non-empty lines read
+	Truncated    bool
+	DefaultLevel int // entries that were assigned ReadOptions.DefaultLevel
+	Malformed    int // non-empty lines skipped because they failed to parse
+	// SynthesizedTimestamps counts entries kept under ReadOptions.MissingTimestamp.
+	SynthesizedTimestamps int
+	// PartialLineBytes is the length of the unterminated last line left out
+	// under ReadOptions.SkipPartialLine (0 = none).
+	PartialLineBytes int
+	ParseErrors      []ParseError
+}
+
+// ParseError records why a line was skipped.
+type ParseError struct {
+	Line int // 1-based line number
+	Err  error
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, describeParseError(e.Err))
+}
+
+func (e ParseError) Unwrap() error {
+	return e.Err
+}
+
+// describeParseError turns parser errors into short reasons for diagnostics.
+func describeParseError(err error) string {
+	var timeErr *time.ParseError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.Is(err, errMissingLevel):
+		return "missing level"
+	case errors.Is(err, os.ErrInvalid):
+		return "missing timestamp, level, or message"
+	case errors.As(err, &timeErr):
+		return fmt.Sprintf("invalid timestamp %q", timeErr.Value)
+	case errors.As(err, &syntaxErr):
+		return "invalid JSON"
+	default:
+		return err.Error()
+	}
+}
+
+// errMissingLevel is returned with an otherwise complete entry that lacks a level.
+var errMissingLevel = errors.New("missing level")
+
+// errMissingTimestamp matches errors returned with the level and message of a
+// line that has no timestamp; see missingTimestampError.
+var errMissingTimestamp = errors.New("missing timestamp")
+
+// missingTimestampError marks a line that parses apart from lacking a timestamp.
+// It reads as its cause, so the line is reported as before when it is skipped.
+type missingTimestampError struct {
+	cause error
+}
+
+func (e missingTimestampError) Error() string {
+	return e.cause.Error()
+}
+
+func (e missingTimestampError) Unwrap() error {
+	return e.cause
+}
+
+func (e missingTimestampError) Is(target error) bool {
+	return target == errMissingTimestamp
+}
+
+// PartialReadError reports a read failure that happened after some entries were parsed.
+// Callers can use the entries returned alongside it as a partial result.
+type PartialReadError struct {
+	Parsed int
+	Err    error
+}
+
+func (e *PartialReadError) Error() string {
+	return fmt.Sprintf("read stopped after %d entries: %v", e.Parsed, e.Err)
+}
+
+func (e *PartialReadError) Unwrap() error {
+	return e.Err
+}
+
 // ReadLogFile reads a log file line-by-line and returns parsed LogEntry slices.
 func ReadLogFile(path string) ([]types.LogEntry, error) {
 	return ReadLogFileWithFormat(path, FormatPlain)
@@ -29,27 +213,56 @@ func ReadLogFile(path string) ([]types.LogEntry, error) {
 
 // ReadLogFileWithFormat reads a log file using a specific format or auto-detects.
 func ReadLogFileWithFormat(path string, format Format) ([]types.LogEntry, error) {
-	f, err := os.Open(path)
+	entries, _, err := ReadLogFileWithOptions(path, ReadOptions{Format: format})
+	return entries, err
+}
+
+// ReadLogFileWithOptions reads a log file using the given read options.
+// Compressed inputs are decompressed according to opts.Compression.
+func ReadLogFileWithOptions(path string, opts ReadOptions) ([]types.LogEntry, ReadStats, error) {
+	f, err := decompress.Open(path, opts.Compression)
 	if err != nil {
-		return nil, err
+		return nil, ReadStats{}, err
 	}
 	defer f.Close()
 
-	return ReadLogReaderWithFormat(f, format)
+	return ReadLogReaderWithOptions(f, opts)
 }
 
 // ReadLogReaderWithFormat reads log lines from a reader using a specific format or auto-detects.
+// If the reader fails mid-stream, the entries parsed so far are returned with a *PartialReadError.
 func ReadLogReaderWithFormat(r io.Reader, format Format) ([]types.LogEntry, error) {
+	entries, _, err := ReadLogReaderWithOptions(r, ReadOptions{Format: format})
+	return entries, err
+}
+
+// ReadLogReaderWithOptions reads log lines from a reader using the given read options.
+// Reading stops once MaxEntries entries are parsed (0 = no cap).
+func ReadLogReaderWithOptions(r io.Reader, opts ReadOptions) ([]types.LogEntry, ReadStats, error) {
 	scanner := bufio.NewScanner(r)
 	entries := make([]types.LogEntry, 0)
+	stats := ReadStats{}
+	if opts.SkipPartialLine {
+		scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+			if atEOF && len(data) > 0 && bytes.IndexByte(data, '\n') < 0 {
+				stats.PartialLineBytes = len(data)
+				return len(data), nil, nil
+			}
+			return bufio.ScanLines(data, atEOF)
+		})
+	}
+	format := opts.Format
 	detected := format
 	seenFirstLine := false
+	lineNo := 0
 
 	for scanner.Scan() {
 		line := scanner.Text()
+		lineNo++
 		if strings.TrimSpace(line) == "" {
 			continue
 		}
+		stats.Lines++
 		if !seenFirstLine {
 			seenFirstLine = true
 			if format == FormatAuto {
@@ -57,38 +270,138 @@ func ReadLogReaderWithFormat(r io.Reader, format Format) ([]types.LogEntry, erro
 			}
 		}
 
-		entry, err := parseLineWithFormat(line, detected)
+		entry, err := parseLineWithFormat(line, detected, opts.CoalesceFields)
+		usedDefault := false
+		synthesized := false
+		if errors.Is(err, errMissingTimestamp) {
+			var prev *types.LogEntry
+			if len(entries) > 0 {
+				prev = &entries[len(entries)-1]
+			}
+			if filled, def, ok := fillMissingTimestamp(entry, opts.MissingTimestamp, prev, opts.DefaultLevel); ok {
+				entry, usedDefault, synthesized, err = filled, def, true, nil
+			}
+		}
 		if err != nil {
-			// skip malformed lines
-			continue
+			if !errors.Is(err, errMissingLevel) || opts.DefaultLevel == "" {
+				// skip malformed lines
+				stats.Malformed++
+				if len(stats.ParseErrors) < opts.MaxParseErrors {
+					stats.ParseErrors = append(stats.ParseErrors, ParseError{Line: lineNo, Err: err})
+				}
+				continue
+			}
+			entry.Level = opts.DefaultLevel
+			usedDefault = true
+		}
+		if opts.MaxEntries > 0 && len(entries) >= opts.MaxEntries {
+			stats.Truncated = true
+			break
+		}
+		if usedDefault {
+			stats.DefaultLevel++
+		}
+		if synthesized {
+			stats.SynthesizedTimestamps++
+		}
+		entry.Level = RemapLevel(entry.Level, opts.LevelMap)
+		if opts.KeepRaw {
+			entry.Raw = line
+		}
+		if opts.UTC {
+			entry.Timestamp = entry.Timestamp.UTC()
+		}
+		if opts.StampIngest {
+			entry.IngestedAt = ingestTime(opts.UTC)
 		}
 		entries = append(entries, entry)
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return entries, stats, &PartialReadError{Parsed: len(entries), Err: err}
+	}
+	return entries, stats, nil
+}
+
+// ParseLevelMap parses "from=TO,from=TO" pairs (e.g. "10=DEBUG,30=WARN") into a level map.
+func ParseLevelMap(spec string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(pair, "=")
+		from = strings.TrimSpace(from)
+		to = strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid level mapping %q (expected from=TO)", pair)
+		}
+		out[strings.ToUpper(from)] = to
+	}
+	return out, nil
+}
+
+// RemapLevel returns the mapped name for level, or level unchanged when unmapped.
+func RemapLevel(level string, levelMap map[string]string) string {
+	if len(levelMap) == 0 {
+		return level
 	}
-	return entries, nil
+	if mapped, ok := levelMap[strings.ToUpper(level)]; ok {
+		return mapped
+	}
+	return level
 }
 
-func parseLineWithFormat(line string, format Format) (types.LogEntry, error) {
+func parseLineWithFormat(line string, format Format, coalesce bool) (types.LogEntry, error) {
 	switch format {
 	case FormatJSON:
-		return parseJSONLine(line)
+		return parseJSONLine(line, coalesce)
 	case FormatLogfmt:
-		return parseLogfmtLine(line)
+		return parseLogfmtLine(line, coalesce)
+	case FormatGlog:
+		return parseGlogLine(line)
 	case FormatPlain:
 		return parseLine(line)
 	case FormatAuto:
-		return parseLineWithFormat(line, detectFormat(line))
+		return parseLineWithFormat(line, detectFormat(line), coalesce)
 	default:
 		return types.LogEntry{}, errors.New("unknown format")
 	}
 }
 
+// scalarString renders a decoded JSON value as a field value: strings as is,
+// numbers and booleans in their JSON form, null as "", and objects or arrays
+// as compact JSON.
+func scalarString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		data, _ := json.Marshal(val)
+		return string(data)
+	}
+}
+
 func parseLine(line string) (types.LogEntry, error) {
-	// Expected format: <timestamp> <LEVEL> <message...>
 	parts := strings.Fields(line)
+	entry, err := parseLineFields(parts)
+	if err != nil && len(parts) > 0 && !startsWithDigit(parts[0]) {
+		// No timestamp at all, as opposed to a malformed one: keep the whole
+		// line as the message.
+		return types.LogEntry{Message: strings.Join(parts, " ")}, missingTimestampError{err}
+	}
+	return entry, err
+}
+
+func parseLineFields(parts []string) (types.LogEntry, error) {
+	// Expected format: <timestamp> <LEVEL> <message...>
 	if len(parts) < 3 {
 		return types.LogEntry{}, os.ErrInvalid
 	}
@@ -96,9 +409,19 @@ func parseLine(line string) (types.LogEntry, error) {
 	level := parts[1]
 	message := strings.Join(parts[2:], " ")
 
-	t, err := time.Parse(time.RFC3339, ts)
+	t, err := ParseTimestamp(ts)
 	if err != nil {
-		return types.LogEntry{}, err
+		// "2026-02-08 10:15:32 ERROR msg": the timestamp spans two fields.
+		if len(parts) < 4 {
+			return types.LogEntry{}, err
+		}
+		spaced, spacedErr := ParseTimestamp(parts[0] + " " + parts[1])
+		if spacedErr != nil {
+			return types.LogEntry{}, err
+		}
+		t = spaced
+		level = parts[2]
+		message = strings.Join(parts[3:], " ")
 	}
 
 	return types.LogEntry{
@@ -108,67 +431,246 @@ func parseLine(line string) (types.LogEntry, error) {
 	}, nil
 }
 
+func startsWithDigit(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+// glogHeader matches the start of a klog/glog line: severity char plus MMDD.
+var glogHeader = regexp.MustCompile(`^[IWEF]\d{4} `)
+
+var glogSeverities = map[byte]string{
+	'I': "INFO",
+	'W': "WARN",
+	'E': "ERROR",
+	'F': "FATAL",
+}
+
+// glogNow supplies the year, which glog headers omit.
+var glogNow = time.Now
+
+// parseGlogLine parses "Lmmdd hh:mm:ss.uuuuuu threadid file:line] msg".
+// The timestamp is taken as UTC in the current year.
+func parseGlogLine(line string) (types.LogEntry, error) {
+	line = strings.TrimSpace(line)
+	if !glogHeader.MatchString(line) {
+		return types.LogEntry{}, os.ErrInvalid
+	}
+	end := strings.Index(line, "] ")
+	if end < 0 {
+		return types.LogEntry{}, os.ErrInvalid
+	}
+	header := strings.Fields(line[:end])
+	message := strings.TrimSpace(line[end+2:])
+	if len(header) < 2 || message == "" {
+		return types.LogEntry{}, os.ErrInvalid
+	}
+	year := glogNow().UTC().Year()
+	t, err := time.Parse("2006 0102 15:04:05.999999", fmt.Sprintf("%d %s %s", year, header[0][1:], header[1]))
+	if err != nil {
+		return types.LogEntry{}, err
+	}
+	return types.LogEntry{
+		Timestamp: t,
+		Level:     glogSeverities[line[0]],
+		Message:   message,
+	}, nil
+}
+
 func detectFormat(line string) Format {
 	trimmed := strings.TrimSpace(line)
 	if strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}") {
 		return FormatJSON
 	}
+	if glogHeader.MatchString(trimmed) {
+		return FormatGlog
+	}
 	if strings.Contains(trimmed, "=") {
 		return FormatLogfmt
 	}
 	return FormatPlain
 }
 
-func parseJSONLine(line string) (types.LogEntry, error) {
+func parseJSONLine(line string, coalesce bool) (types.LogEntry, error) {
 	var raw map[string]interface{}
-	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+	if coalesce {
+		var err error
+		if raw, err = decodeCoalescedObject(line); err != nil {
+			return types.LogEntry{}, err
+		}
+	} else if err := json.Unmarshal([]byte(line), &raw); err != nil {
 		return types.LogEntry{}, err
 	}
 
-	tsRaw := firstStringFromMap(raw, "timestamp", "time", "ts", "Timestamp", "Time", "TS")
-	level := firstStringFromMap(raw, "level", "severity", "Level", "Severity")
-	message := firstStringFromMap(raw, "message", "msg", "Message", "Msg")
+	tsRaw := firstStringFromMap(raw, jsonTimestampKeys...)
+	level := firstScalarFromMap(raw, jsonLevelKeys...)
+	message := firstStringFromMap(raw, jsonMessageKeys...)
 
-	if tsRaw == "" || level == "" || message == "" {
-		return types.LogEntry{}, os.ErrInvalid
+	entry, err := buildEntry(tsRaw, level, message)
+	for key, val := range raw {
+		if isEntryKey(key, jsonTimestampKeys, jsonLevelKeys, jsonMessageKeys) {
+			continue
+		}
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string)
+		}
+		// A "fields" object is how stored JSONL carries them, so re-reading a
+		// store as JSON input keeps the same fields rather than nesting them.
+		if nested, ok := val.(map[string]interface{}); ok && key == "fields" {
+			for k, v := range nested {
+				entry.Fields[k] = scalarString(v)
+			}
+			continue
+		}
+		entry.Fields[key] = scalarString(val)
 	}
+	return entry, err
+}
 
-	t, err := time.Parse(time.RFC3339, tsRaw)
-	if err != nil {
-		return types.LogEntry{}, err
+// Keys read into the timestamp, level and message; every other key of a JSON
+// or logfmt line goes to LogEntry.Fields.
+var (
+	jsonTimestampKeys   = []string{"timestamp", "time", "ts", "Timestamp", "Time", "TS"}
+	jsonLevelKeys       = []string{"level", "severity", "Level", "Severity"}
+	jsonMessageKeys     = []string{"message", "msg", "Message", "Msg"}
+	logfmtTimestampKeys = []string{"timestamp", "time", "ts"}
+	logfmtLevelKeys     = []string{"level", "severity"}
+	logfmtMessageKeys   = []string{"message", "msg"}
+)
+
+func isEntryKey(key string, aliases ...[]string) bool {
+	for _, list := range aliases {
+		for _, alias := range list {
+			if key == alias {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	return types.LogEntry{
-		Timestamp: t,
-		Level:     level,
-		Message:   message,
-	}, nil
+// decodeCoalescedObject decodes a JSON object, joining repeated top-level string
+// keys with ",". Repeated non-string values keep the last one, like encoding/json.
+func decodeCoalescedObject(line string) (map[string]interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(line))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, os.ErrInvalid
+	}
+	raw := make(map[string]interface{})
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, os.ErrInvalid
+		}
+		var val interface{}
+		if err := dec.Decode(&val); err != nil {
+			return nil, err
+		}
+		prev, seen := raw[key].(string)
+		if next, ok := val.(string); ok && seen {
+			val = prev + "," + next
+		}
+		raw[key] = val
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return raw, nil
 }
 
-func parseLogfmtLine(line string) (types.LogEntry, error) {
-	fields := parseLogfmtFields(line)
+func parseLogfmtLine(line string, coalesce bool) (types.LogEntry, error) {
+	fields := parseLogfmtFields(line, coalesce)
 	if len(fields) == 0 {
 		return types.LogEntry{}, os.ErrInvalid
 	}
 
-	tsRaw := firstStringFromStringMap(fields, "timestamp", "time", "ts")
-	level := firstStringFromStringMap(fields, "level", "severity")
-	message := firstStringFromStringMap(fields, "message", "msg")
+	tsRaw := firstStringFromStringMap(fields, logfmtTimestampKeys...)
+	level := firstStringFromStringMap(fields, logfmtLevelKeys...)
+	message := firstStringFromStringMap(fields, logfmtMessageKeys...)
+
+	entry, err := buildEntry(tsRaw, level, message)
+	for key, val := range fields {
+		if isEntryKey(key, logfmtTimestampKeys, logfmtLevelKeys, logfmtMessageKeys) {
+			continue
+		}
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string)
+		}
+		entry.Fields[key] = val
+	}
+	return entry, err
+}
+
+// timestampLayouts are tried in order by ParseTimestamp. Fractional seconds of
+// any precision are accepted by every layout.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02 15:04:05Z0700",
+	"2006-01-02 15:04:05 -0700",
+}
+
+// zonelessLayouts have no offset and are read as UTC.
+var zonelessLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
 
-	if tsRaw == "" || level == "" || message == "" {
+// ParseTimestamp parses RFC3339 plus common variants: a space instead of "T",
+// offsets without a colon (+0000), and no zone at all (taken as UTC). On failure
+// it returns the RFC3339 parse error.
+func ParseTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	t, firstErr := time.Parse(time.RFC3339Nano, value)
+	if firstErr == nil {
+		return t, nil
+	}
+	for _, layout := range timestampLayouts[1:] {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range zonelessLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, firstErr
+}
+
+// buildEntry validates structured fields. When only the level is missing it returns
+// the entry along with errMissingLevel so callers can apply a default level; without
+// a timestamp it returns the level and message with errMissingTimestamp.
+func buildEntry(tsRaw string, level string, message string) (types.LogEntry, error) {
+	if message == "" {
 		return types.LogEntry{}, os.ErrInvalid
 	}
+	if tsRaw == "" {
+		return types.LogEntry{Level: level, Message: message}, missingTimestampError{os.ErrInvalid}
+	}
 
-	t, err := time.Parse(time.RFC3339, tsRaw)
+	t, err := ParseTimestamp(tsRaw)
 	if err != nil {
 		return types.LogEntry{}, err
 	}
 
-	return types.LogEntry{
+	entry := types.LogEntry{
 		Timestamp: t,
 		Level:     level,
 		Message:   message,
-	}, nil
+	}
+	if level == "" {
+		return entry, errMissingLevel
+	}
+	return entry, nil
 }
 
 func firstStringFromStringMap(m map[string]string, keys ...string) string {
@@ -191,7 +693,24 @@ func firstStringFromMap(m map[string]interface{}, keys ...string) string {
 	return ""
 }
 
-func parseLogfmtFields(line string) map[string]string {
+// firstScalarFromMap is like firstStringFromMap but also accepts numbers (e.g. level 30).
+func firstScalarFromMap(m map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch val := m[key].(type) {
+		case string:
+			if val != "" {
+				return val
+			}
+		case float64:
+			return strconv.FormatFloat(val, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// parseLogfmtFields splits key=value pairs. Repeated keys keep the last value,
+// or are joined with "," when coalesce is set.
+func parseLogfmtFields(line string, coalesce bool) map[string]string {
 	result := make(map[string]string)
 	i := 0
 	n := len(line)
@@ -238,20 +757,72 @@ func parseLogfmtFields(line string) map[string]string {
 			val = line[startVal:i]
 		}
 
-		if key != "" {
-			result[key] = val
+		if key == "" {
+			continue
+		}
+		if prev, ok := result[key]; ok && coalesce {
+			val = prev + "," + val
 		}
+		result[key] = val
 	}
 	return result
 }
 
+// StampIngested sets IngestedAt to at on entries that do not have one yet.
+func StampIngested(entries []types.LogEntry, at time.Time) {
+	for i := range entries {
+		if entries[i].IngestedAt.IsZero() {
+			entries[i].IngestedAt = at
+		}
+	}
+}
+
+func ingestTime(utc bool) time.Time {
+	if utc {
+		return time.Now().UTC()
+	}
+	return time.Now()
+}
+
+// NormalizeUTC converts every entry timestamp to UTC in place.
+func NormalizeUTC(entries []types.LogEntry) {
+	for i := range entries {
+		entries[i].Timestamp = entries[i].Timestamp.UTC()
+	}
+}
+
+// Canonicalize puts entries in the canonical stored form in place: UTC
+// timestamps and upper-case levels.
+func Canonicalize(entries []types.LogEntry) {
+	for i := range entries {
+		entries[i].Timestamp = entries[i].Timestamp.UTC()
+		entries[i].Level = strings.ToUpper(entries[i].Level)
+	}
+}
+
 type TailOptions struct {
-	FromStart    bool
-	PollInterval time.Duration
-	Format       Format
+	FromStart      bool
+	PollInterval   time.Duration
+	Format         Format
+	LevelMap       map[string]string
+	DefaultLevel   string
+	CoalesceFields bool
+	KeepRaw        bool
+	UTC            bool
+	// MissingTimestamp is as in ReadOptions.
+	MissingTimestamp MissingTimestamp
+	// IdleTimeout stops following when no new line arrives for this long (0 = follow forever).
+	IdleTimeout time.Duration
+	// StampIngest is as in ReadOptions.
+	StampIngest bool
+	// Since backfills before following: reading starts at the beginning of the
+	// file and, of the lines already there when tailing starts, only entries at
+	// or after Since are sent. Lines appended later are sent regardless.
+	Since time.Time
 }
 
 // TailLogFile streams new log entries as they are appended to a file.
+// The entries channel is closed when ctx is done or IdleTimeout elapses without new lines.
 func TailLogFile(ctx context.Context, path string, opts TailOptions) (<-chan types.LogEntry, <-chan error) {
 	entries := make(chan types.LogEntry)
 	errs := make(chan error, 1)
@@ -267,7 +838,16 @@ func TailLogFile(ctx context.Context, path string, opts TailOptions) (<-chan typ
 		}
 		defer f.Close()
 
-		if !opts.FromStart {
+		// backfillEnd is where the existing content ends when backfilling.
+		var backfillEnd, pos int64
+		if !opts.Since.IsZero() {
+			info, err := f.Stat()
+			if err != nil {
+				errs <- err
+				return
+			}
+			backfillEnd = info.Size()
+		} else if !opts.FromStart {
 			if _, err := f.Seek(0, io.SeekEnd); err != nil {
 				errs <- err
 				return
@@ -281,6 +861,9 @@ func TailLogFile(ctx context.Context, path string, opts TailOptions) (<-chan typ
 		if poll <= 0 {
 			poll = 500 * time.Millisecond
 		}
+		lastRead := time.Now()
+		var last types.LogEntry
+		haveLast := false
 
 		for {
 			select {
@@ -292,6 +875,9 @@ func TailLogFile(ctx context.Context, path string, opts TailOptions) (<-chan typ
 			line, err := reader.ReadString('\n')
 			if err != nil {
 				if err == io.EOF {
+					if opts.IdleTimeout > 0 && time.Since(lastRead) >= opts.IdleTimeout {
+						return
+					}
 					time.Sleep(poll)
 					continue
 				}
@@ -299,6 +885,9 @@ func TailLogFile(ctx context.Context, path string, opts TailOptions) (<-chan typ
 				return
 			}
 
+			lastRead = time.Now()
+			backfill := pos < backfillEnd
+			pos += int64(len(line))
 			line = strings.TrimRight(line, "\r\n")
 			if strings.TrimSpace(line) == "" {
 				continue
@@ -311,8 +900,34 @@ func TailLogFile(ctx context.Context, path string, opts TailOptions) (<-chan typ
 				}
 			}
 
-			entry, err := parseLineWithFormat(line, detected)
+			entry, err := parseLineWithFormat(line, detected, opts.CoalesceFields)
+			if errors.Is(err, errMissingTimestamp) {
+				var prev *types.LogEntry
+				if haveLast {
+					prev = &last
+				}
+				if filled, _, ok := fillMissingTimestamp(entry, opts.MissingTimestamp, prev, opts.DefaultLevel); ok {
+					entry, err = filled, nil
+				}
+			}
 			if err != nil {
+				if !errors.Is(err, errMissingLevel) || opts.DefaultLevel == "" {
+					continue
+				}
+				entry.Level = opts.DefaultLevel
+			}
+			entry.Level = RemapLevel(entry.Level, opts.LevelMap)
+			if opts.KeepRaw {
+				entry.Raw = line
+			}
+			if opts.UTC {
+				entry.Timestamp = entry.Timestamp.UTC()
+			}
+			if opts.StampIngest {
+				entry.IngestedAt = ingestTime(opts.UTC)
+			}
+			last, haveLast = entry, true
+			if backfill && entry.Timestamp.Before(opts.Since) {
 				continue
 			}
 			entries <- entry
@@ -1,8 +1,18 @@
 package ingest
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+	"github.com/armash/log-pipeline/internal/decompress"
 	"github.com/armash/log-pipeline/internal/types"
 )
 
@@ -132,3 +142,560 @@ func TestReadLogFile(t *testing.T) {
 		})
 	}
 }
+
+type failingReader struct {
+	data []byte
+	read bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.read {
+		return 0, errors.New("disk error")
+	}
+	r.read = true
+	return copy(p, r.data), nil
+}
+
+func TestReadLogReaderPartial(t *testing.T) {
+	r := &failingReader{data: []byte("2026-02-08T10:15:32Z ERROR first\n2026-02-08T10:15:33Z INFO second\n")}
+	got, err := ReadLogReaderWithFormat(r, FormatPlain)
+	var partial *PartialReadError
+	if !errors.As(err, &partial) {
+		t.Fatalf("ReadLogReaderWithFormat() error = %v, want PartialReadError", err)
+	}
+	if len(got) != 2 || partial.Parsed != 2 {
+		t.Errorf("ReadLogReaderWithFormat() got %d entries (parsed=%d), want 2", len(got), partial.Parsed)
+	}
+}
+
+func TestLevelMap(t *testing.T) {
+	levelMap, err := ParseLevelMap("10=DEBUG, 30=WARN, 40=ERROR, crit=ERROR")
+	if err != nil {
+		t.Fatalf("ParseLevelMap() error = %v", err)
+	}
+
+	input := strings.Join([]string{
+		`{"time":"2026-02-08T10:00:00Z","level":30,"msg":"slow"}`,
+		`{"time":"2026-02-08T10:00:01Z","level":"40","msg":"failed"}`,
+		`{"time":"2026-02-08T10:00:02Z","level":"CRIT","msg":"down"}`,
+		`{"time":"2026-02-08T10:00:03Z","level":50,"msg":"unmapped"}`,
+	}, "\n")
+	got, _, err := ReadLogReaderWithOptions(strings.NewReader(input), ReadOptions{Format: FormatJSON, LevelMap: levelMap})
+	if err != nil {
+		t.Fatalf("ReadLogReaderWithOptions() error = %v", err)
+	}
+	want := []string{"WARN", "ERROR", "ERROR", "50"}
+	if len(got) != len(want) {
+		t.Fatalf("ReadLogReaderWithOptions() got %d entries, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].Level != w {
+			t.Errorf("entry %d level = %q, want %q", i, got[i].Level, w)
+		}
+	}
+
+	if _, err := ParseLevelMap("10"); err == nil {
+		t.Errorf("ParseLevelMap(10) error = nil, want error")
+	}
+}
+
+func TestDefaultLevel(t *testing.T) {
+	input := strings.Join([]string{
+		`ts=2026-02-08T10:00:00Z msg="no level here"`,
+		`ts=2026-02-08T10:00:01Z level=WARN msg="has level"`,
+		`{"time":"2026-02-08T10:00:02Z","msg":"json without level"}`,
+	}, "\n")
+
+	got, stats, err := ReadLogReaderWithOptions(strings.NewReader(input), ReadOptions{Format: FormatAuto})
+	if err != nil {
+		t.Fatalf("ReadLogReaderWithOptions() error = %v", err)
+	}
+	if len(got) != 1 || stats.DefaultLevel != 0 {
+		t.Errorf("without default: got %d entries (default=%d), want 1 (0)", len(got), stats.DefaultLevel)
+	}
+
+	got, stats, err = ReadLogReaderWithOptions(strings.NewReader(input), ReadOptions{Format: FormatAuto, DefaultLevel: "INFO"})
+	if err != nil {
+		t.Fatalf("ReadLogReaderWithOptions() error = %v", err)
+	}
+	if len(got) != 3 || stats.DefaultLevel != 2 {
+		t.Fatalf("with default: got %d entries (default=%d), want 3 (2)", len(got), stats.DefaultLevel)
+	}
+	if got[0].Level != "INFO" || got[1].Level != "WARN" || got[2].Level != "INFO" {
+		t.Errorf("with default: levels = %q, %q, %q", got[0].Level, got[1].Level, got[2].Level)
+	}
+}
+
+func TestReadCompressed(t *testing.T) {
+	dir := t.TempDir()
+	plain, err := os.ReadFile("../../samples/sample.log")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	gzPath := filepath.Join(dir, "sample.log.gz")
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(plain)
+	zw.Close()
+	if err := os.WriteFile(gzPath, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	misnamed := filepath.Join(dir, "sample.log")
+	if err := os.WriteFile(misnamed, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	zstData, err := os.ReadFile("../../samples/sample.log.zst")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	misnamedZst := filepath.Join(dir, "sample-zst.log")
+	if err := os.WriteFile(misnamedZst, zstData, 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	truncatedZst := filepath.Join(dir, "truncated.log.zst")
+	if err := os.WriteFile(truncatedZst, zstData[:len(zstData)/2], 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		compression decompress.Codec
+		wantCount   int
+		wantErr     error
+	}{
+		{name: "gzip by extension", path: gzPath, compression: decompress.Auto, wantCount: 10},
+		{name: "bzip2 by extension", path: "../../samples/sample.log.bz2", compression: decompress.Auto, wantCount: 10},
+		{name: "gzip override", path: misnamed, compression: decompress.Gzip, wantCount: 10},
+		{name: "zstd by extension", path: "../../samples/sample.log.zst", compression: decompress.Auto, wantCount: 10},
+		{name: "zstd override", path: misnamedZst, compression: decompress.Zstd, wantCount: 10},
+		{name: "unknown codec", path: gzPath, compression: decompress.Codec("lz4"), wantErr: decompress.ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := ReadLogFileWithOptions(tt.path, ReadOptions{Format: FormatPlain, Compression: tt.compression})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ReadLogFileWithOptions() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadLogFileWithOptions() error = %v", err)
+			}
+			if len(got) != tt.wantCount {
+				t.Errorf("ReadLogFileWithOptions() got %d entries, want %d", len(got), tt.wantCount)
+			}
+		})
+	}
+
+	if _, _, err := ReadLogFileWithOptions(truncatedZst, ReadOptions{Format: FormatPlain}); err == nil {
+		t.Error("ReadLogFileWithOptions(truncated .zst) error = nil, want a decode error")
+	}
+}
+
+func TestGlogFormat(t *testing.T) {
+	defer func(orig func() time.Time) { glogNow = orig }(glogNow)
+	glogNow = func() time.Time { return time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC) }
+
+	input := strings.Join([]string{
+		`I0208 10:15:32.123456     123 server.go:45] Starting server on :8080`,
+		`W0208 10:15:33.000001 123 pool.go:12] pool nearly full key=value`,
+		`E0208 10:15:34.500000 124 db.go:99] connection refused`,
+		`F0208 10:15:35.000000 124 main.go:7] unrecoverable`,
+		`X0208 10:15:36.000000 124 main.go:7] not glog`,
+	}, "\n")
+	got, _, err := ReadLogReaderWithOptions(strings.NewReader(input), ReadOptions{Format: FormatAuto})
+	if err != nil {
+		t.Fatalf("ReadLogReaderWithOptions() error = %v", err)
+	}
+	want := []types.LogEntry{
+		{Timestamp: time.Date(2026, 2, 8, 10, 15, 32, 123456000, time.UTC), Level: "INFO", Message: "Starting server on :8080"},
+		{Timestamp: time.Date(2026, 2, 8, 10, 15, 33, 1000, time.UTC), Level: "WARN", Message: "pool nearly full key=value"},
+		{Timestamp: time.Date(2026, 2, 8, 10, 15, 34, 500000000, time.UTC), Level: "ERROR", Message: "connection refused"},
+		{Timestamp: time.Date(2026, 2, 8, 10, 15, 35, 0, time.UTC), Level: "FATAL", Message: "unrecoverable"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ReadLogReaderWithOptions() got %d entries, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if !got[i].Timestamp.Equal(w.Timestamp) || got[i].Level != w.Level || got[i].Message != w.Message {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], w)
+		}
+	}
+}
+
+func TestCoalesceFields(t *testing.T) {
+	input := strings.Join([]string{
+		`ts=2026-02-08T10:00:00Z level=INFO msg=first msg=second`,
+		`{"time":"2026-02-08T10:00:01Z","level":"WARN","msg":"a","msg":"b"}`,
+	}, "\n")
+	tests := []struct {
+		name     string
+		coalesce bool
+		want     []string
+	}{
+		{name: "last wins", coalesce: false, want: []string{"second", "b"}},
+		{name: "coalesced", coalesce: true, want: []string{"first,second", "a,b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := ReadLogReaderWithOptions(strings.NewReader(input), ReadOptions{Format: FormatAuto, CoalesceFields: tt.coalesce})
+			if err != nil {
+				t.Fatalf("ReadLogReaderWithOptions() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ReadLogReaderWithOptions() got %d entries, want %d", len(got), len(tt.want))
+			}
+			for i, w := range tt.want {
+				if got[i].Message != w {
+					t.Errorf("entry %d message = %q, want %q", i, got[i].Message, w)
+				}
+			}
+		})
+	}
+}
+
+func TestKeepRaw(t *testing.T) {
+	line := `ts=2026-02-08T10:00:00Z level=INFO msg="user login"`
+	for _, keep := range []bool{false, true} {
+		got, _, err := ReadLogReaderWithOptions(strings.NewReader(line+"\n"), ReadOptions{Format: FormatAuto, KeepRaw: keep})
+		if err != nil || len(got) != 1 {
+			t.Fatalf("ReadLogReaderWithOptions(KeepRaw=%v) = %v, %v", keep, got, err)
+		}
+		data, err := json.Marshal(got[0])
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		if !keep {
+			if got[0].Raw != "" || strings.Contains(string(data), `"raw"`) {
+				t.Errorf("KeepRaw=false kept raw: %s", data)
+			}
+			continue
+		}
+		if got[0].Raw != line {
+			t.Errorf("Raw = %q, want %q", got[0].Raw, line)
+		}
+		var back types.LogEntry
+		if err := json.Unmarshal(data, &back); err != nil || back.Raw != line {
+			t.Errorf("round trip raw = %q (err %v), want %q", back.Raw, err, line)
+		}
+	}
+}
+
+func TestReadUTC(t *testing.T) {
+	line := "2026-02-08T12:00:00+02:00 INFO hello\n"
+	got, _, err := ReadLogReaderWithOptions(strings.NewReader(line), ReadOptions{Format: FormatPlain, UTC: true})
+	if err != nil || len(got) != 1 {
+		t.Fatalf("ReadLogReaderWithOptions() = %v, %v", got, err)
+	}
+	want := time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC)
+	if got[0].Timestamp != want {
+		t.Errorf("Timestamp = %v, want %v with UTC location", got[0].Timestamp, want)
+	}
+}
+
+func TestReadParseErrors(t *testing.T) {
+	input := strings.Join([]string{
+		"2026-02-08T10:00:00Z INFO ok",
+		"yesterday ERROR bad timestamp",
+		"",
+		"2026-02-08T10:00:02Z WARN",
+		"2026-02-08T10:00:03Z INFO also ok",
+		"garbage",
+	}, "\n")
+	got, stats, err := ReadLogReaderWithOptions(strings.NewReader(input), ReadOptions{Format: FormatPlain, MaxParseErrors: 2})
+	if err != nil {
+		t.Fatalf("ReadLogReaderWithOptions() error = %v", err)
+	}
+	if len(got) != 2 || stats.Malformed != 3 {
+		t.Fatalf("got %d entries, %d malformed; want 2 and 3", len(got), stats.Malformed)
+	}
+	want := []string{
+		`line 2: invalid timestamp "yesterday"`,
+		`line 4: missing timestamp, level, or message`,
+	}
+	if len(stats.ParseErrors) != len(want) {
+		t.Fatalf("got %d parse errors, want %d", len(stats.ParseErrors), len(want))
+	}
+	for i, w := range want {
+		if stats.ParseErrors[i].Error() != w {
+			t.Errorf("parse error %d = %q, want %q", i, stats.ParseErrors[i].Error(), w)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	want := time.Date(2026, 2, 8, 10, 15, 32, 123000000, time.UTC)
+	for _, value := range []string{
+		"2026-02-08T10:15:32.123Z",
+		"2026-02-08T10:15:32.123+00:00",
+		"2026-02-08T11:15:32.123+01:00",
+		"2026-02-08T10:15:32.123000000Z",
+		"2026-02-08 10:15:32.123Z",
+		"2026-02-08T10:15:32.123+0000",
+		"2026-02-08 05:15:32.123 -0500",
+		"2026-02-08T10:15:32.123",
+		"2026-02-08 10:15:32,123",
+	} {
+		got, err := ParseTimestamp(value)
+		if err != nil {
+			t.Errorf("ParseTimestamp(%q) error = %v", value, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("ParseTimestamp(%q) = %s, want %s", value, got, want)
+		}
+	}
+	for _, value := range []string{"", "yesterday", "2026-02-08", "10:15:32"} {
+		if _, err := ParseTimestamp(value); err == nil {
+			t.Errorf("ParseTimestamp(%q) error = nil, want error", value)
+		}
+	}
+
+	entry, err := parseLine("2026-02-08 10:15:32.123 ERROR spaced timestamp")
+	if err != nil || !entry.Timestamp.Equal(want) || entry.Level != "ERROR" || entry.Message != "spaced timestamp" {
+		t.Errorf("parseLine(spaced) = %+v, %v", entry, err)
+	}
+}
+
+func TestMissingTimestamp(t *testing.T) {
+	input := strings.Join([]string{
+		"=== service banner ===",
+		"2026-02-08T10:00:00Z ERROR request failed",
+		"  at handler.go:42",
+		"retrying in 5s",
+	}, "\n")
+	read := func(opts ReadOptions) ([]types.LogEntry, ReadStats) {
+		t.Helper()
+		opts.Format = FormatPlain
+		got, stats, err := ReadLogReaderWithOptions(strings.NewReader(input), opts)
+		if err != nil {
+			t.Fatalf("ReadLogReaderWithOptions() error = %v", err)
+		}
+		return got, stats
+	}
+
+	if got, stats := read(ReadOptions{}); len(got) != 1 || stats.Malformed != 3 || stats.SynthesizedTimestamps != 0 {
+		t.Fatalf("drop: got %d entries, %d malformed, %d synthesized", len(got), stats.Malformed, stats.SynthesizedTimestamps)
+	}
+
+	got, stats := read(ReadOptions{MissingTimestamp: MissingTimestampPrevious})
+	// The banner has no previous entry to borrow from.
+	if len(got) != 3 || stats.Malformed != 1 || stats.SynthesizedTimestamps != 2 {
+		t.Fatalf("previous: got %d entries, %d malformed, %d synthesized", len(got), stats.Malformed, stats.SynthesizedTimestamps)
+	}
+	if cont := got[1]; !cont.Timestamp.Equal(got[0].Timestamp) || cont.Level != "ERROR" || cont.Message != "at handler.go:42" {
+		t.Fatalf("previous: continuation = %+v", cont)
+	}
+
+	now := time.Date(2026, 2, 9, 8, 0, 0, 0, time.UTC)
+	missingTSNow = func() time.Time { return now }
+	defer func() { missingTSNow = time.Now }()
+	if got, stats := read(ReadOptions{MissingTimestamp: MissingTimestampNow}); len(got) != 1 || stats.Malformed != 3 {
+		t.Fatalf("now without --default-level: got %d entries, %d malformed", len(got), stats.Malformed)
+	}
+	got, stats = read(ReadOptions{MissingTimestamp: MissingTimestampNow, DefaultLevel: "INFO"})
+	if len(got) != 4 || stats.SynthesizedTimestamps != 3 || stats.DefaultLevel != 3 {
+		t.Fatalf("now: got %d entries, %d synthesized, %d defaulted", len(got), stats.SynthesizedTimestamps, stats.DefaultLevel)
+	}
+	if !got[0].Timestamp.Equal(now) || got[0].Level != "INFO" || got[0].Message != "=== service banner ===" {
+		t.Fatalf("now: banner = %+v", got[0])
+	}
+
+	if _, err := ParseMissingTimestamp("later"); err == nil {
+		t.Fatal("ParseMissingTimestamp() accepted an unknown mode")
+	}
+}
+
+func TestTailSince(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	existing := "2026-02-08T09:00:00Z INFO old\n2026-02-08T10:30:00Z ERROR recent\n"
+	if err := os.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	since := time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC)
+	entries, errs := TailLogFile(context.Background(), path, TailOptions{
+		Format:       FormatPlain,
+		PollInterval: 10 * time.Millisecond,
+		IdleTimeout:  300 * time.Millisecond,
+		Since:        since,
+	})
+
+	first := <-entries
+	if first.Message != "recent" {
+		t.Fatalf("first entry = %+v, want the backfilled recent one", first)
+	}
+	// Appended lines are followed even when their timestamp is older.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("2026-02-08T08:00:00Z WARN late arrival\n")
+	f.Close()
+
+	var rest []string
+	for e := range entries {
+		rest = append(rest, e.Message)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("TailLogFile() error = %v", err)
+	}
+	if len(rest) != 1 || rest[0] != "late arrival" {
+		t.Fatalf("followed entries = %q, want [late arrival]", rest)
+	}
+}
+
+func TestSkipPartialLine(t *testing.T) {
+	input := "2026-02-08T10:00:00Z INFO started\n2026-02-08T10:00:01Z ERROR req"
+	read := func(skip bool) ([]types.LogEntry, ReadStats) {
+		t.Helper()
+		got, stats, err := ReadLogReaderWithOptions(strings.NewReader(input), ReadOptions{Format: FormatPlain, SkipPartialLine: skip})
+		if err != nil {
+			t.Fatalf("ReadLogReaderWithOptions() error = %v", err)
+		}
+		return got, stats
+	}
+
+	if got, stats := read(false); len(got) != 2 || stats.PartialLineBytes != 0 {
+		t.Fatalf("default: got %d entries, partial %d; want the unterminated line parsed", len(got), stats.PartialLineBytes)
+	}
+	got, stats := read(true)
+	if len(got) != 1 || got[0].Message != "started" || stats.PartialLineBytes != len("2026-02-08T10:00:01Z ERROR req") || stats.Malformed != 0 {
+		t.Fatalf("skip: got %+v, stats %+v", got, stats)
+	}
+
+	input += "uest failed\n"
+	if got, stats := read(true); len(got) != 2 || stats.PartialLineBytes != 0 {
+		t.Fatalf("complete file: got %d entries, partial %d", len(got), stats.PartialLineBytes)
+	}
+}
+
+func TestFieldsInMessage(t *testing.T) {
+	input := strings.Join([]string{
+		`{"ts":"2026-02-08T10:00:00Z","level":"ERROR","msg":"login failed","user_id":42,"trace_id":"abc","ok":false}`,
+		`ts=2026-02-08T10:00:01Z level=INFO msg=hello trace_id="a b"`,
+		`2026-02-08T10:00:02Z WARN plain line`,
+	}, "\n")
+	got, _, err := ReadLogReaderWithOptions(strings.NewReader(input), ReadOptions{Format: FormatAuto})
+	if err != nil {
+		t.Fatalf("ReadLogReaderWithOptions() error = %v", err)
+	}
+	messages := []string{"login failed", "hello", "plain line"}
+	want := []string{
+		"login failed [user_id=42 trace_id=abc ok=false]",
+		`hello [trace_id="a b"]`,
+		"plain line",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i, e := range got {
+		if e.Message != messages[i] {
+			t.Errorf("entry %d stored message = %q, want %q", i, e.Message, messages[i])
+		}
+		if shown := e.MessageWithFields([]string{"user_id", "trace_id", "ok"}); shown != want[i] {
+			t.Errorf("entry %d shown message = %q, want %q", i, shown, want[i])
+		}
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	input := strings.Join([]string{
+		`{"ts":"2026-02-08T12:00:00+02:00","level":"warn","msg":"disk at 91%"}`,
+		``,
+		`ts=2026-02-08T10:00:01Z level=Info msg=hello`,
+		`not a log line`,
+	}, "\n")
+	got, stats, err := ReadLogReaderWithOptions(strings.NewReader(input), ReadOptions{Format: FormatAuto})
+	if err != nil {
+		t.Fatalf("ReadLogReaderWithOptions() error = %v", err)
+	}
+	if stats.Lines != 3 || stats.Malformed != 1 || len(got) != 2 {
+		t.Fatalf("got %d entries, stats %+v; want 3 lines, 1 malformed", len(got), stats)
+	}
+	Canonicalize(got)
+	want := []types.LogEntry{
+		{Timestamp: time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC), Level: "WARN", Message: "disk at 91%"},
+		{Timestamp: time.Date(2026, 2, 8, 10, 0, 1, 0, time.UTC), Level: "INFO", Message: "hello"},
+	}
+	for i, e := range got {
+		if e.Timestamp.Location() != time.UTC || !e.Timestamp.Equal(want[i].Timestamp) || e.Level != want[i].Level || e.Message != want[i].Message {
+			t.Errorf("entry %d = %+v, want %+v", i, e, want[i])
+		}
+	}
+}
+
+func TestStampIngest(t *testing.T) {
+	input := "2026-02-08T10:00:00Z INFO started\n"
+	got, _, err := ReadLogReaderWithOptions(strings.NewReader(input), ReadOptions{Format: FormatPlain})
+	if err != nil {
+		t.Fatalf("ReadLogReaderWithOptions() error = %v", err)
+	}
+	if data, _ := json.Marshal(got[0]); strings.Contains(string(data), "ingestedAt") {
+		t.Errorf("unstamped entry marshals as %s, want no ingestedAt", data)
+	}
+
+	before := time.Now()
+	got, _, err = ReadLogReaderWithOptions(strings.NewReader(input), ReadOptions{Format: FormatPlain, StampIngest: true, UTC: true})
+	if err != nil {
+		t.Fatalf("ReadLogReaderWithOptions() error = %v", err)
+	}
+	stamped := got[0].IngestedAt
+	if stamped.Before(before) || stamped.After(time.Now()) || stamped.Location() != time.UTC {
+		t.Fatalf("IngestedAt = %v, want the UTC parse time", stamped)
+	}
+	data, err := json.Marshal(got[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back types.LogEntry
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("Unmarshal(%s) error = %v", data, err)
+	}
+	if !back.IngestedAt.Equal(stamped) {
+		t.Errorf("round-tripped IngestedAt = %v, want %v", back.IngestedAt, stamped)
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	input := strings.Join([]string{
+		`{"ts":"2026-02-08T10:00:00Z","level":"ERROR","msg":"login failed","user_id":42,"ok":false,"tags":["a"],"nil":null}`,
+		`ts=2026-02-08T10:00:01Z level=INFO msg=hello trace_id="a b"`,
+		`2026-02-08T10:00:02Z WARN plain line`,
+		`{"timestamp":"2026-02-08T10:00:03Z","level":"INFO","message":"stored","fields":{"trace_id":"abc"}}`,
+	}, "\n")
+	got, _, err := ReadLogReaderWithOptions(strings.NewReader(input), ReadOptions{Format: FormatAuto})
+	if err != nil {
+		t.Fatalf("ReadLogReaderWithOptions() error = %v", err)
+	}
+	want := []map[string]string{
+		{"user_id": "42", "ok": "false", "tags": `["a"]`, "nil": ""},
+		{"trace_id": "a b"},
+		nil,
+		{"trace_id": "abc"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i, e := range got {
+		if !reflect.DeepEqual(e.Fields, want[i]) {
+			t.Errorf("entry %d fields = %v, want %v", i, e.Fields, want[i])
+		}
+	}
+
+	data, err := json.Marshal(got[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back types.LogEntry
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("Unmarshal(%s) error = %v", data, err)
+	}
+	if !reflect.DeepEqual(back.Fields, got[0].Fields) {
+		t.Errorf("round-tripped fields = %v, want %v", back.Fields, got[0].Fields)
+	}
+	if data, _ := json.Marshal(got[2]); strings.Contains(string(data), "fields") {
+		t.Errorf("plain entry marshals as %s, want no fields key", data)
+	}
+}
@@ -0,0 +1,330 @@
+// Package objstore reads shard files from object storage. Only S3 (and
+// S3-compatible endpoints) is supported; requests are signed with SigV4 using
+// credentials from the standard AWS environment variables.
+package objstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ObjectStore lists and reads objects by key.
+type ObjectStore interface {
+	// List returns every key under prefix, sorted.
+	List(prefix string) ([]string, error)
+	// Open streams the object at key. A missing object yields an error for which
+	// os.IsNotExist reports true.
+	Open(key string) (io.ReadCloser, error)
+	// Exists reports whether an object is stored at key.
+	Exists(key string) (bool, error)
+}
+
+// IsURL reports whether path names an object store location rather than a
+// local file.
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "s3://")
+}
+
+// ParseURL splits "s3://bucket/key" into bucket and key. The key may be empty.
+func ParseURL(raw string) (bucket string, key string, err error) {
+	if !IsURL(raw) {
+		return "", "", fmt.Errorf("not an s3 url: %s", raw)
+	}
+	rest := strings.TrimPrefix(raw, "s3://")
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("missing bucket in %s", raw)
+	}
+	return bucket, key, nil
+}
+
+// ForURL returns the store for the bucket named in raw along with the key part.
+func ForURL(raw string) (ObjectStore, string, error) {
+	bucket, key, err := ParseURL(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	return NewS3FromEnv(bucket), key, nil
+}
+
+// List returns the full s3:// URLs of every object under the URL prefix.
+func List(raw string) ([]string, error) {
+	st, prefix, err := ForURL(raw)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := st.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	bucket, _, _ := ParseURL(raw)
+	urls := make([]string, len(keys))
+	for i, k := range keys {
+		urls[i] = "s3://" + bucket + "/" + k
+	}
+	return urls, nil
+}
+
+// Open streams the object named by an s3:// URL.
+func Open(raw string) (io.ReadCloser, error) {
+	st, key, err := ForURL(raw)
+	if err != nil {
+		return nil, err
+	}
+	return st.Open(key)
+}
+
+// Exists reports whether the object named by an s3:// URL exists.
+func Exists(raw string) (bool, error) {
+	st, key, err := ForURL(raw)
+	if err != nil {
+		return false, err
+	}
+	return st.Exists(key)
+}
+
+// S3 is an ObjectStore for one bucket.
+type S3 struct {
+	Bucket string
+	Region string
+	// Endpoint overrides the virtual-hosted AWS endpoint, e.g. for MinIO. Requests
+	// then use path-style addressing: Endpoint/bucket/key.
+	Endpoint     string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Client       *http.Client
+	// now is stubbed in tests.
+	now func() time.Time
+}
+
+// NewS3FromEnv configures an S3 store from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION (or AWS_DEFAULT_REGION)
+// and AWS_ENDPOINT_URL_S3 (or AWS_ENDPOINT_URL). Without credentials requests
+// are sent unsigned, which works for public buckets.
+func NewS3FromEnv(bucket string) *S3 {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	return &S3{
+		Bucket:       bucket,
+		Region:       region,
+		Endpoint:     strings.TrimSuffix(endpoint, "/"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List pages through ListObjectsV2 for prefix.
+func (s *S3) List(prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		if prefix != "" {
+			q.Set("prefix", prefix)
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, "", q)
+		if err != nil {
+			return nil, err
+		}
+		var res listResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 list %s/%s: %w", s.Bucket, prefix, err)
+		}
+		for _, c := range res.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Open issues a GetObject for key.
+func (s *S3) Open(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Exists issues a HeadObject for key. Without s3:ListBucket, S3 answers 403
+// instead of 404 for a missing key, so both count as missing.
+func (s *S3) Exists(key string) (bool, error) {
+	resp, err := s.do(http.MethodHead, key, nil)
+	if err == nil {
+		resp.Body.Close()
+		return true, nil
+	}
+	if os.IsNotExist(err) || errors.Is(err, errForbidden) {
+		return false, nil
+	}
+	return false, err
+}
+
+// errForbidden wraps a 403 response.
+var errForbidden = errors.New("forbidden")
+
+func (s *S3) do(method string, key string, q url.Values) (*http.Response, error) {
+	u := s.objectURL(key)
+	if len(q) > 0 {
+		// SigV4 requires the canonical query to be sorted and %20-encoded, which
+		// Encode already does apart from spaces.
+		u.RawQuery = strings.ReplaceAll(q.Encode(), "+", "%20")
+	}
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req)
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	resp.Body.Close()
+	name := "s3://" + s.Bucket + "/" + key
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%s: %s: %w: %s", name, resp.Status, errForbidden, strings.TrimSpace(string(body)))
+	}
+	return nil, fmt.Errorf("%s: %s: %s", name, resp.Status, strings.TrimSpace(string(body)))
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	escaped := escapePath(key)
+	if s.Endpoint != "" {
+		u, err := url.Parse(s.Endpoint)
+		if err == nil {
+			base := strings.TrimSuffix(u.EscapedPath(), "/")
+			u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket + "/" + key
+			u.RawPath = base + "/" + escapePath(s.Bucket) + "/" + escaped
+			return u
+		}
+	}
+	return &url.URL{
+		Scheme:  "https",
+		Host:    s.Bucket + ".s3." + s.Region + ".amazonaws.com",
+		Path:    "/" + key,
+		RawPath: "/" + escaped,
+	}
+}
+
+// escapePath URI-encodes each segment of key the way SigV4 expects.
+func escapePath(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = strings.ReplaceAll(url.PathEscape(p), "+", "%2B")
+	}
+	return strings.Join(parts, "/")
+}
+
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds SigV4 headers for a bodiless GET or HEAD request. It is a no-op without
+// credentials.
+func (s *S3) sign(req *http.Request) {
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return
+	}
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	day := t.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	headers := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + emptyPayloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	if s.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", s.SessionToken)
+		signed += ";x-amz-security-token"
+		headers += "x-amz-security-token:" + s.SessionToken + "\n"
+	}
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers,
+		signed,
+		emptyPayloadHash,
+	}, "\n")
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256(canonical)
+	sig := hex.EncodeToString(hmacSHA256(signingKey(s.SecretKey, day, s.Region, "s3"), toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signed, sig))
+}
+
+func signingKey(secret, day, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), day)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,112 @@
+package query
+
+import (
+	"fmt"
+	"time"
+)
+
+// Builder constructs Filters programmatically. Each call is merged with
+// MergeFilters, so conflicts follow the same rules as the DSL; the first
+// error is kept and returned by Build.
+type Builder struct {
+	filters Filters
+	err     error
+	now     func() time.Time
+}
+
+// NewBuilder returns an empty Builder.
+func NewBuilder() *Builder {
+	return &Builder{now: time.Now}
+}
+
+func (b *Builder) merge(extra Filters) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if len(b.filters.Or) > 0 && len(extra.Or) == 0 {
+		// MergeFilters only distributes into the right-hand side, so push
+		// later conditions into each existing branch ourselves.
+		or := make([]Filters, 0, len(b.filters.Or))
+		for _, opt := range b.filters.Or {
+			merged, err := MergeFilters(opt, extra)
+			if err != nil {
+				b.err = err
+				return b
+			}
+			or = append(or, merged)
+		}
+		b.filters.Or = or
+		return b
+	}
+	merged, err := MergeFilters(b.filters, extra)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.filters = merged
+	return b
+}
+
+// Level matches a single level exactly.
+func (b *Builder) Level(level string) *Builder {
+	return b.merge(Filters{Level: level})
+}
+
+// LevelIn matches any of the given levels.
+func (b *Builder) LevelIn(levels ...string) *Builder {
+	return b.merge(Filters{LevelIn: levels})
+}
+
+// MinLevel matches the given level and anything more severe.
+func (b *Builder) MinLevel(level string) *Builder {
+	if b.err == nil && !IsKnownLevel(level) {
+		b.err = fmt.Errorf("unknown level %q", level)
+		return b
+	}
+	return b.merge(Filters{MinLevel: level})
+}
+
+// Search matches messages containing text (case-insensitive).
+func (b *Builder) Search(text string) *Builder {
+	return b.merge(Filters{Search: []string{text}})
+}
+
+// MessageEquals matches messages equal to text (case-insensitive).
+func (b *Builder) MessageEquals(text string) *Builder {
+	return b.merge(Filters{MessageEquals: text})
+}
+
+// Since matches entries newer than d ago.
+func (b *Builder) Since(d time.Duration) *Builder {
+	return b.After(b.now().Add(-d))
+}
+
+// After matches entries at or after t.
+func (b *Builder) After(t time.Time) *Builder {
+	return b.merge(Filters{After: t})
+}
+
+// Before matches entries before t.
+func (b *Builder) Before(t time.Time) *Builder {
+	return b.merge(Filters{Before: t})
+}
+
+// Or matches entries satisfying the current filters and any one of alternatives.
+func (b *Builder) Or(alternatives ...Filters) *Builder {
+	if len(alternatives) == 0 {
+		return b
+	}
+	return b.merge(Filters{Or: alternatives})
+}
+
+// Build returns the constructed Filters, or the first conflict encountered.
+func (b *Builder) Build() (Filters, error) {
+	if b.err != nil {
+		return Filters{}, b.err
+	}
+	f := b.filters
+	if !f.After.IsZero() && !f.Before.IsZero() && !f.After.Before(f.Before) {
+		return Filters{}, fmt.Errorf("empty time range: after %s is not before %s", f.After.Format(time.RFC3339), f.Before.Format(time.RFC3339))
+	}
+	return f, nil
+}
@@ -0,0 +1,48 @@
+package query_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/query"
+)
+
+func ExampleBuilder() {
+	f, err := query.NewBuilder().
+		Level("ERROR").
+		Since(10 * time.Minute).
+		Search("auth").
+		Build()
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Println(f.Level, f.Search, !f.After.IsZero())
+	// Output: ERROR [auth] true
+}
+
+func ExampleBuilder_conflict() {
+	_, err := query.NewBuilder().
+		Level("ERROR").
+		Level("WARN").
+		Build()
+	fmt.Println(err)
+	// Output: conflicting level filters
+}
+
+func ExampleBuilder_Or() {
+	f, err := query.NewBuilder().
+		Or(query.Filters{Level: "ERROR"}, query.Filters{Level: "WARN"}).
+		Search("timeout").
+		Build()
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	for _, opt := range f.Or {
+		fmt.Println(opt.Level, opt.Search)
+	}
+	// Output:
+	// ERROR [timeout]
+	// WARN [timeout]
+}
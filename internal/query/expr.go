@@ -0,0 +1,470 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+// Expr is a compiled boolean expression evaluated against each entry (--expr).
+//
+// Grammar:
+//
+//	expr       = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | "(" expr ")" | comparison
+//	comparison = operand op operand
+//	op         = "==" | "!=" | "<" | "<=" | ">" | ">=" | "~"
+//	operand    = "level" | "message" | "timestamp" | "field." key | "len(" operand ")" | string | number
+//
+// Level comparisons use severity ranks, so level >= "WARN" matches WARN and ERROR;
+// a level literal must be one of the ranked levels. field.<key> is the entry's
+// string field of that name, or "" when the entry lacks it.
+// "~" is a case-insensitive substring match. A string compared with timestamp must
+// be RFC3339. Type mismatches are reported by CompileExpr, not at evaluation time.
+type Expr struct {
+	src  string
+	root exprNode
+}
+
+// CompileExpr parses and type-checks an expression.
+func CompileExpr(src string) (*Expr, error) {
+	toks, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{toks: toks}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q", p.toks[p.pos].text)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the expression source.
+func (x *Expr) String() string {
+	return x.src
+}
+
+// Match reports whether e satisfies the expression, ranking levels under o.
+// A nil Expr matches everything.
+func (x *Expr) Match(e types.LogEntry, o Options) bool {
+	if x == nil {
+		return true
+	}
+	return x.root.eval(e, o).(bool)
+}
+
+// andExpr combines two expressions with "and"; either may be nil.
+func andExpr(a, b *Expr) *Expr {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return &Expr{src: "(" + a.src + ") and (" + b.src + ")", root: logicNode{op: "and", left: a.root, right: b.root}}
+}
+
+type exprKind int
+
+const (
+	kindBool exprKind = iota
+	kindString
+	kindNumber
+	kindTime
+)
+
+func (k exprKind) String() string {
+	switch k {
+	case kindBool:
+		return "bool"
+	case kindString:
+		return "string"
+	case kindNumber:
+		return "number"
+	default:
+		return "time"
+	}
+}
+
+type exprNode interface {
+	kind() exprKind
+	eval(e types.LogEntry, o Options) interface{}
+}
+
+type literalNode struct {
+	k exprKind
+	v interface{}
+}
+
+func (n literalNode) kind() exprKind                           { return n.k }
+func (n literalNode) eval(types.LogEntry, Options) interface{} { return n.v }
+
+// fieldNode reads level, message, timestamp, or (name "field") Fields[key].
+type fieldNode struct{ name, key string }
+
+func (n fieldNode) kind() exprKind {
+	if n.name == "timestamp" {
+		return kindTime
+	}
+	return kindString
+}
+
+func (n fieldNode) eval(e types.LogEntry, o Options) interface{} {
+	switch n.name {
+	case "level":
+		return e.Level
+	case "message":
+		return e.Message
+	case "field":
+		return e.Fields[n.key]
+	default:
+		return e.Timestamp
+	}
+}
+
+type lenNode struct{ arg exprNode }
+
+func (n lenNode) kind() exprKind { return kindNumber }
+func (n lenNode) eval(e types.LogEntry, o Options) interface{} {
+	return float64(len([]rune(n.arg.eval(e, o).(string))))
+}
+
+type notNode struct{ arg exprNode }
+
+func (n notNode) kind() exprKind                               { return kindBool }
+func (n notNode) eval(e types.LogEntry, o Options) interface{} { return !n.arg.eval(e, o).(bool) }
+
+type logicNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n logicNode) kind() exprKind { return kindBool }
+func (n logicNode) eval(e types.LogEntry, o Options) interface{} {
+	if n.op == "and" {
+		return n.left.eval(e, o).(bool) && n.right.eval(e, o).(bool)
+	}
+	return n.left.eval(e, o).(bool) || n.right.eval(e, o).(bool)
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+	byLevel     bool
+}
+
+func (n compareNode) kind() exprKind { return kindBool }
+
+func (n compareNode) eval(e types.LogEntry, o Options) interface{} {
+	l, r := n.left.eval(e, o), n.right.eval(e, o)
+	if n.op == "~" {
+		return strings.Contains(strings.ToLower(l.(string)), strings.ToLower(r.(string)))
+	}
+	var c int
+	switch lv := l.(type) {
+	case float64:
+		rv := r.(float64)
+		c = cmpOrdered(lv, rv)
+	case time.Time:
+		c = lv.Compare(r.(time.Time))
+	case string:
+		rv := r.(string)
+		if n.byLevel {
+			if n.op == "==" || n.op == "!=" {
+				c = 1
+				if strings.EqualFold(lv, rv) {
+					c = 0
+				}
+			} else {
+				c = cmpOrdered(o.LevelRank(lv), o.LevelRank(rv))
+			}
+		} else {
+			c = strings.Compare(lv, rv)
+		}
+	}
+	switch n.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func cmpOrdered[T int | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+type exprToken struct {
+	text   string
+	quoted bool
+}
+
+func lexExpr(src string) ([]exprToken, error) {
+	var toks []exprToken
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		ch := rs[i]
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch == '(' || ch == ')' || ch == '~':
+			toks = append(toks, exprToken{text: string(ch)})
+			i++
+		case strings.ContainsRune("=!<>", ch):
+			if i+1 < len(rs) && rs[i+1] == '=' {
+				toks = append(toks, exprToken{text: string(rs[i : i+2])})
+				i += 2
+			} else if ch == '<' || ch == '>' {
+				toks = append(toks, exprToken{text: string(ch)})
+				i++
+			} else {
+				return nil, fmt.Errorf("unexpected %q at offset %d (use == or !=)", ch, i)
+			}
+		case ch == '"' || ch == '\'':
+			end := i + 1
+			for end < len(rs) && rs[end] != ch {
+				end++
+			}
+			if end >= len(rs) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			toks = append(toks, exprToken{text: string(rs[i+1 : end]), quoted: true})
+			i = end + 1
+		default:
+			start := i
+			for i < len(rs) && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '.' || rs[i] == '_' || rs[i] == '-') {
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("unexpected %q at offset %d", ch, i)
+			}
+			toks = append(toks, exprToken{text: string(rs[start:i])})
+		}
+	}
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	return toks, nil
+}
+
+type exprParser struct {
+	toks []exprToken
+	pos  int
+}
+
+func (p *exprParser) peekWord(word string) bool {
+	return p.pos < len(p.toks) && !p.toks[p.pos].quoted && strings.EqualFold(p.toks[p.pos].text, word)
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.peekWord(text) {
+		if p.pos >= len(p.toks) {
+			return fmt.Errorf("expected %q at end of expression", text)
+		}
+		return fmt.Errorf("expected %q, got %q", text, p.toks[p.pos].text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicNode{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = logicNode{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.peekWord("not") {
+		p.pos++
+		arg, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{arg: arg}, nil
+	}
+	if p.peekWord("(") {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("expected comparison operator at end of expression")
+	}
+	op := p.toks[p.pos]
+	switch op.text {
+	case "==", "!=", "<", "<=", ">", ">=", "~":
+	default:
+		return nil, fmt.Errorf("expected comparison operator, got %q", op.text)
+	}
+	if op.quoted {
+		return nil, fmt.Errorf("expected comparison operator, got %q", op.text)
+	}
+	p.pos++
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	left, right, err = coerceTime(left, right)
+	if err != nil {
+		return nil, err
+	}
+	if left.kind() != right.kind() {
+		return nil, fmt.Errorf("cannot compare %s with %s", left.kind(), right.kind())
+	}
+	if op.text == "~" && left.kind() != kindString {
+		return nil, fmt.Errorf("~ needs string operands, got %s", left.kind())
+	}
+	if op.text != "~" {
+		if err := checkLevelLiteral(left, right); err != nil {
+			return nil, err
+		}
+	}
+	return compareNode{op: op.text, left: left, right: right, byLevel: isLevelField(left) || isLevelField(right)}, nil
+}
+
+func (p *exprParser) parseOperand() (exprNode, error) {
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("expected operand at end of expression")
+	}
+	tok := p.toks[p.pos]
+	p.pos++
+	if tok.quoted {
+		return literalNode{k: kindString, v: tok.text}, nil
+	}
+	switch word := strings.ToLower(tok.text); word {
+	case "level", "message", "timestamp":
+		return fieldNode{name: word}, nil
+	case "len":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		arg, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if arg.kind() != kindString {
+			return nil, fmt.Errorf("len() needs a string, got %s", arg.kind())
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return lenNode{arg: arg}, nil
+	}
+	if strings.HasPrefix(strings.ToLower(tok.text), "field.") {
+		key := tok.text[len("field."):]
+		if key == "" {
+			return nil, fmt.Errorf("field. needs a key, e.g. field.user_id")
+		}
+		return fieldNode{name: "field", key: key}, nil
+	}
+	if n, err := strconv.ParseFloat(tok.text, 64); err == nil {
+		return literalNode{k: kindNumber, v: n}, nil
+	}
+	return nil, fmt.Errorf("unknown field %q (use level, message, timestamp, field.<key>, or quote strings)", tok.text)
+}
+
+// coerceTime turns a string literal compared with a time operand into a time literal.
+func coerceTime(left, right exprNode) (exprNode, exprNode, error) {
+	convert := func(n exprNode) (exprNode, error) {
+		lit, ok := n.(literalNode)
+		if !ok || lit.k != kindString {
+			return n, nil
+		}
+		t, err := time.Parse(time.RFC3339, lit.v.(string))
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q: expected RFC3339", lit.v)
+		}
+		return literalNode{k: kindTime, v: t}, nil
+	}
+	var err error
+	if left.kind() == kindTime {
+		right, err = convert(right)
+	} else if right.kind() == kindTime {
+		left, err = convert(left)
+	}
+	return left, right, err
+}
+
+func isLevelField(n exprNode) bool {
+	f, ok := n.(fieldNode)
+	return ok && f.name == "level"
+}
+
+// checkLevelLiteral rejects a string literal compared with level that is not a
+// ranked level name, which would otherwise rank lowest and match everything.
+func checkLevelLiteral(left, right exprNode) error {
+	for _, pair := range [][2]exprNode{{left, right}, {right, left}} {
+		lit, ok := pair[1].(literalNode)
+		if !isLevelField(pair[0]) || !ok || lit.k != kindString {
+			continue
+		}
+		if err := CheckLevel(lit.v.(string)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+// HourRange selects hours of the day from From up to but not including To,
+// e.g. {9, 17} is 09:00-16:59. A range with From > To wraps past midnight.
+type HourRange struct {
+	From int
+	To   int
+}
+
+func (r HourRange) contains(hour int) bool {
+	if r.From <= r.To {
+		return hour >= r.From && hour < r.To
+	}
+	return hour >= r.From || hour < r.To
+}
+
+func (r HourRange) String() string {
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// ParsePeriodicZone parses a --periodic-tz value for Options.Zone: an IANA
+// name ("Europe/Berlin"), "UTC" or "Local" (the default, also for "").
+func ParsePeriodicZone(name string) (*time.Location, error) {
+	if strings.TrimSpace(name) == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(strings.TrimSpace(name))
+}
+
+// MatchesPeriodic reports whether e's timestamp, read in f.Options.Zone, falls
+// on one of f.Weekdays and in one of f.Hours. Empty lists match anything.
+func MatchesPeriodic(e types.LogEntry, f Filters) bool {
+	if len(f.Weekdays) == 0 && len(f.Hours) == 0 {
+		return true
+	}
+	zone := f.Options.Zone
+	if zone == nil {
+		zone = time.Local
+	}
+	ts := e.Timestamp.In(zone)
+	if len(f.Weekdays) > 0 {
+		ok := false
+		for _, d := range f.Weekdays {
+			if ts.Weekday() == d {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(f.Hours) > 0 {
+		for _, r := range f.Hours {
+			if r.contains(ts.Hour()) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// parseWeekdays parses "sat,sun" or "mon-fri" (ranges may wrap, e.g. "fri-mon").
+func parseWeekdays(val string) ([]time.Weekday, error) {
+	var out []time.Weekday
+	seen := make(map[time.Weekday]bool)
+	add := func(d time.Weekday) {
+		if !seen[d] {
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	for _, part := range strings.Split(val, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		from, to, isRange := strings.Cut(part, "-")
+		start, ok := weekdayNames[strings.TrimSpace(from)]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", from)
+		}
+		if !isRange {
+			add(start)
+			continue
+		}
+		end, ok := weekdayNames[strings.TrimSpace(to)]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", to)
+		}
+		for d := start; ; d = (d + 1) % 7 {
+			add(d)
+			if d == end {
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// parseHourRanges parses "9-17", "22-6" or a single hour "9", comma-separated.
+func parseHourRanges(val string) ([]HourRange, error) {
+	var out []HourRange
+	for _, part := range strings.Split(val, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		start, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil || start < 0 || start > 23 {
+			return nil, fmt.Errorf("invalid hour %q (want 0-23)", from)
+		}
+		end := start + 1
+		if isRange {
+			end, err = strconv.Atoi(strings.TrimSpace(to))
+			if err != nil || end < 0 || end > 24 {
+				return nil, fmt.Errorf("invalid hour %q (want 0-24)", to)
+			}
+			if end == start {
+				return nil, fmt.Errorf("empty hour range %q", part)
+			}
+		}
+		out = append(out, HourRange{From: start, To: end})
+	}
+	return out, nil
+}
+
+func formatWeekdays(days []time.Weekday) string {
+	names := make([]string, 0, len(days))
+	for _, d := range days {
+		names = append(names, strings.ToLower(d.String()[:3]))
+	}
+	return strings.Join(names, ",")
+}
+
+func formatHourRanges(ranges []HourRange) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+func sameWeekdays(a, b []time.Weekday) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameHourRanges(a, b []HourRange) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// intersectWeekdays keeps the days of a that also appear in b.
+func intersectWeekdays(a, b []time.Weekday) []time.Weekday {
+	var out []time.Weekday
+	for _, d := range a {
+		for _, e := range b {
+			if d == e {
+				out = append(out, d)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// intersectHourRanges returns the hours covered by both a and b as
+// non-wrapping ranges in hour order, e.g. 22-6 and 0-12 give 0-6.
+func intersectHourRanges(a, b []HourRange) []HourRange {
+	covered := func(ranges []HourRange, hour int) bool {
+		for _, r := range ranges {
+			if r.contains(hour) {
+				return true
+			}
+		}
+		return false
+	}
+	var out []HourRange
+	for hour := 0; hour < 24; hour++ {
+		if !covered(a, hour) || !covered(b, hour) {
+			continue
+		}
+		if n := len(out); n > 0 && out[n-1].To == hour {
+			out[n-1].To = hour + 1
+			continue
+		}
+		out = append(out, HourRange{From: hour, To: hour + 1})
+	}
+	return out
+}
@@ -2,6 +2,8 @@ package query
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -11,23 +13,174 @@ import (
 
 type Filters struct {
 	Level  string
-	Search string
+	Search []string
 	After  time.Time
 	Before time.Time
 	Or     []Filters
 	LevelIn []string
+	MinLevel string
+	// MessageEquals is a case-insensitive exact match (message=...), while
+	// Search holds substring matches (message~... or search~...), all of which
+	// must appear.
+	MessageEquals string
+	// MessageRegex (message=~...) is compiled once by Parse and matched against
+	// the whole message, case-sensitively unless the pattern starts with (?i).
+	// Every listed pattern must match.
+	MessageRegex []*regexp.Regexp
+	// Expr is an extra predicate from --expr, ANDed with the other fields.
+	Expr *Expr
+	// Weekdays (dow=) and Hours (hourofday=) are periodic filters on the
+	// timestamp read in Options.Zone.
+	Weekdays []time.Weekday
+	Hours    []HourRange
+	// FieldEq (field.<key>=value) and FieldContains (field.<key>~value) match
+	// LogEntry.Fields case-insensitively, like message= and message~. An entry
+	// without the key does not match.
+	FieldEq       map[string]string
+	FieldContains map[string][]string
+	// FieldCompare (field.<key>>500, >=, < and <=) compares LogEntry.Fields
+	// numerically. An entry whose field is missing or not a number does not
+	// match.
+	FieldCompare map[string][]Comparison
+	// HasFields (has(<key>)) requires each key in LogEntry.Fields with a
+	// non-empty value.
+	HasFields []string
+	// NotLevel (level!=) and NotSearch (message!~) exclude entries; every
+	// listed level and substring must be absent.
+	NotLevel  []string
+	NotSearch []string
+	// Options are the run's matching settings; see WithOptions.
+	Options Options
+}
+
+// Comparison is one numeric field.<key> condition, e.g. >= 500.
+type Comparison struct {
+	Op    string // ">", ">=", "<" or "<="
+	Value float64
+}
+
+// Matches reports whether v satisfies the comparison.
+func (c Comparison) Matches(v float64) bool {
+	switch c.Op {
+	case ">":
+		return v > c.Value
+	case ">=":
+		return v >= c.Value
+	case "<":
+		return v < c.Value
+	case "<=":
+		return v <= c.Value
+	}
+	return false
+}
+
+func (c Comparison) String() string {
+	return c.Op + strconv.FormatFloat(c.Value, 'g', -1, 64)
+}
+
+var levelRanks = map[string]int{
+	"DEBUG": 1,
+	"INFO":  2,
+	"WARN":  3,
+	"ERROR": 4,
+	"FATAL": 5,
+}
+
+const (
+	rankLowest  = 0
+	rankHighest = 6
+)
+
+// Options hold the matching settings chosen once per run (--unknown-level-rank,
+// --periodic-tz).
+// They travel on Filters (see WithOptions) rather than in package state, so
+// callers with different settings can share the package.
+type Options struct {
+	// UnknownLevelRank is the rank of levels missing from levelRanks in
+	// level>= comparisons; the zero value ranks them lowest.
+	UnknownLevelRank int
+	// Zone is the time zone dow= and hourofday= read timestamps in; nil means
+	// time.Local.
+	Zone *time.Location
+}
+
+// ParseUnknownLevelRank parses an --unknown-level-rank value: "lowest",
+// "highest", or a known level name to rank alongside.
+func ParseUnknownLevelRank(value string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "lowest":
+		return rankLowest, nil
+	case "highest":
+		return rankHighest, nil
+	}
+	rank, ok := levelRanks[strings.ToUpper(strings.TrimSpace(value))]
+	if !ok {
+		return 0, fmt.Errorf("expected lowest, highest, or one of DEBUG, INFO, WARN, ERROR, FATAL")
+	}
+	return rank, nil
+}
+
+// LevelRank returns the severity rank of a level under o; higher is more severe.
+func (o Options) LevelRank(level string) int {
+	if rank, ok := levelRanks[strings.ToUpper(level)]; ok {
+		return rank
+	}
+	return o.UnknownLevelRank
+}
+
+// MatchesMinLevel reports whether level is at least as severe as min under o.
+func (o Options) MatchesMinLevel(level string, min string) bool {
+	return min == "" || o.LevelRank(level) >= o.LevelRank(min)
+}
+
+// LevelRank returns the severity rank of a level, with unknown levels lowest.
+func LevelRank(level string) int {
+	return Options{}.LevelRank(level)
+}
+
+// CheckLevel returns an error unless level has a defined severity rank.
+func CheckLevel(level string) error {
+	if !IsKnownLevel(level) {
+		return fmt.Errorf("unknown level %q (use DEBUG, INFO, WARN, ERROR, FATAL)", level)
+	}
+	return nil
+}
+
+// IsKnownLevel reports whether level has a defined severity rank.
+func IsKnownLevel(level string) bool {
+	_, ok := levelRanks[strings.ToUpper(level)]
+	return ok
+}
+
+// WithOptions returns f with o set on it and on every OR branch.
+func (f Filters) WithOptions(o Options) Filters {
+	f.Options = o
+	if len(f.Or) > 0 {
+		or := make([]Filters, 0, len(f.Or))
+		for _, opt := range f.Or {
+			or = append(or, opt.WithOptions(o))
+		}
+		f.Or = or
+	}
+	return f
 }
 
 // Parse parses a simple query DSL with AND/OR.
 // Supported forms:
 // level=ERROR
-// message~"auth"
+// level>=WARN
+// message~"auth"     (contains)
+// message="login ok" (exact, case-insensitive)
 // search~timeout
 // since=10m
 // after=2026-02-08T16:00:00Z
 // before=2026-02-08T17:00:00Z
 // OR is specified with: OR
 // Example: level=ERROR OR level=WARN search~auth
+//
+// OR branches that differ only in their level (level=ERROR OR level=WARN) are
+// collapsed into one level in (ERROR,WARN) filter, which the index answers with
+// a single union.
 func Parse(input string) (Filters, error) {
 	tokens, err := tokenize(input)
 	if err != nil {
@@ -48,15 +201,141 @@ func Parse(input string) (Filters, error) {
 		}
 		root.Or = append(root.Or, f)
 	}
-	return root, nil
+	return collapseLevelOr(root), nil
+}
+
+// collapseLevelOr merges OR branches whose only difference is the level they
+// select into a single branch with LevelIn. A branch that fixes no level, or
+// both level= and level in, is left alone. If one branch remains it replaces
+// the OR.
+func collapseLevelOr(root Filters) Filters {
+	out := make([]Filters, 0, len(root.Or))
+	for _, opt := range root.Or {
+		levels := branchLevels(opt)
+		merged := false
+		if levels != nil {
+			for i := range out {
+				have := branchLevels(out[i])
+				if have == nil || !sameExceptLevel(out[i], opt) {
+					continue
+				}
+				for _, lvl := range levels {
+					if !containsFold(have, lvl) {
+						have = append(have, lvl)
+					}
+				}
+				out[i].Level = ""
+				out[i].LevelIn = have
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			out = append(out, opt)
+		}
+	}
+	if len(out) == 1 {
+		return out[0]
+	}
+	root.Or = out
+	return root
+}
+
+// branchLevels returns the levels a branch is restricted to, or nil if it is
+// not restricted by exactly one of level= and level in.
+func branchLevels(f Filters) []string {
+	switch {
+	case f.Level != "" && len(f.LevelIn) == 0:
+		return []string{f.Level}
+	case f.Level == "" && len(f.LevelIn) > 0:
+		return append([]string(nil), f.LevelIn...)
+	}
+	return nil
+}
+
+func sameExceptLevel(a, b Filters) bool {
+	return sameStringsFold(a.Search, b.Search) && a.After.Equal(b.After) && a.Before.Equal(b.Before) &&
+		strings.EqualFold(a.MinLevel, b.MinLevel) && strings.EqualFold(a.MessageEquals, b.MessageEquals) &&
+		sameRegexps(a.MessageRegex, b.MessageRegex) &&
+		a.Expr == b.Expr && sameWeekdays(a.Weekdays, b.Weekdays) && sameHourRanges(a.Hours, b.Hours) &&
+		sameFieldValues(a.FieldEq, b.FieldEq) && sameFieldLists(a.FieldContains, b.FieldContains) &&
+		sameComparisons(a.FieldCompare, b.FieldCompare) &&
+		sameStrings(a.HasFields, b.HasFields) && sameStringsFold(a.NotLevel, b.NotLevel) && sameStringsFold(a.NotSearch, b.NotSearch) &&
+		a.Options == b.Options && len(a.Or) == 0 && len(b.Or) == 0
+}
+
+func sameRegexps(a, b []*regexp.Regexp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+	return true
+}
+
+func containsRegexp(list []*regexp.Regexp, re *regexp.Regexp) bool {
+	for _, v := range list {
+		if v.String() == re.String() {
+			return true
+		}
+	}
+	return false
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameStringsFold(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
 }
 
 func BuildFilters(level string, cutoff time.Time, search string) Filters {
-	return Filters{
-		Level:  level,
-		Search: search,
-		After:  cutoff,
+	f := Filters{
+		Level: level,
+		After: cutoff,
 	}
+	if search != "" {
+		f.Search = []string{search}
+	}
+	return f
 }
 
 func MergeFilters(base Filters, extra Filters) (Filters, error) {
@@ -76,26 +355,107 @@ func MergeFilters(base Filters, extra Filters) (Filters, error) {
 	}
 
 	merged := base
+	// Level restrictions intersect; only an empty intersection is a conflict.
 	if len(extra.LevelIn) > 0 {
-		if merged.Level != "" || len(merged.LevelIn) > 0 {
-			return Filters{}, fmt.Errorf("conflicting level filters")
+		switch {
+		case merged.Level != "":
+			if !containsFold(extra.LevelIn, merged.Level) {
+				return Filters{}, fmt.Errorf("conflicting level filters")
+			}
+		case len(merged.LevelIn) > 0:
+			var both []string
+			for _, lvl := range merged.LevelIn {
+				if containsFold(extra.LevelIn, lvl) {
+					both = append(both, lvl)
+				}
+			}
+			switch len(both) {
+			case 0:
+				return Filters{}, fmt.Errorf("conflicting level filters")
+			case 1:
+				merged.Level, merged.LevelIn = both[0], nil
+			default:
+				merged.LevelIn = both
+			}
+		default:
+			merged.LevelIn = append([]string(nil), extra.LevelIn...)
 		}
-		merged.LevelIn = append(merged.LevelIn, extra.LevelIn...)
 	}
 	if extra.Level != "" {
 		if merged.Level != "" && !strings.EqualFold(merged.Level, extra.Level) {
 			return Filters{}, fmt.Errorf("conflicting level filters")
 		}
 		if len(merged.LevelIn) > 0 {
-			return Filters{}, fmt.Errorf("conflicting level filters")
+			if !containsFold(merged.LevelIn, extra.Level) {
+				return Filters{}, fmt.Errorf("conflicting level filters")
+			}
+			merged.LevelIn = nil
 		}
 		merged.Level = extra.Level
 	}
-	if extra.Search != "" {
-		if merged.Search != "" && merged.Search != extra.Search {
-			return Filters{}, fmt.Errorf("conflicting search filters")
+	if extra.MinLevel != "" {
+		if merged.MinLevel == "" || LevelRank(extra.MinLevel) > LevelRank(merged.MinLevel) {
+			merged.MinLevel = extra.MinLevel
+		}
+	}
+	for _, sub := range extra.Search {
+		if !containsFold(merged.Search, sub) {
+			merged.Search = append(merged.Search[:len(merged.Search):len(merged.Search)], sub)
+		}
+	}
+	if extra.MessageEquals != "" {
+		if merged.MessageEquals != "" && !strings.EqualFold(merged.MessageEquals, extra.MessageEquals) {
+			return Filters{}, fmt.Errorf("conflicting message filters")
+		}
+		merged.MessageEquals = extra.MessageEquals
+	}
+	for _, lvl := range extra.NotLevel {
+		if !containsFold(merged.NotLevel, lvl) {
+			merged.NotLevel = append(merged.NotLevel[:len(merged.NotLevel):len(merged.NotLevel)], lvl)
+		}
+	}
+	for _, sub := range extra.NotSearch {
+		if !containsFold(merged.NotSearch, sub) {
+			merged.NotSearch = append(merged.NotSearch[:len(merged.NotSearch):len(merged.NotSearch)], sub)
+		}
+	}
+	if err := checkNegated(merged); err != nil {
+		return Filters{}, err
+	}
+	for _, re := range extra.MessageRegex {
+		if !containsRegexp(merged.MessageRegex, re) {
+			merged.MessageRegex = append(merged.MessageRegex[:len(merged.MessageRegex):len(merged.MessageRegex)], re)
+		}
+	}
+	merged.Expr = andExpr(merged.Expr, extra.Expr)
+	var err error
+	if merged.FieldEq, err = mergeFieldValues(merged.FieldEq, extra.FieldEq, strings.EqualFold); err != nil {
+		return Filters{}, err
+	}
+	merged.FieldContains = mergeFieldLists(merged.FieldContains, extra.FieldContains)
+	merged.FieldCompare = mergeComparisons(merged.FieldCompare, extra.FieldCompare)
+	for _, key := range extra.HasFields {
+		if !containsString(merged.HasFields, key) {
+			merged.HasFields = append(merged.HasFields[:len(merged.HasFields):len(merged.HasFields)], key)
+		}
+	}
+	if len(extra.Weekdays) > 0 {
+		if len(merged.Weekdays) > 0 && !sameWeekdays(merged.Weekdays, extra.Weekdays) {
+			if merged.Weekdays = intersectWeekdays(merged.Weekdays, extra.Weekdays); len(merged.Weekdays) == 0 {
+				return Filters{}, fmt.Errorf("conflicting dow filters")
+			}
+		} else {
+			merged.Weekdays = extra.Weekdays
+		}
+	}
+	if len(extra.Hours) > 0 {
+		if len(merged.Hours) > 0 && !sameHourRanges(merged.Hours, extra.Hours) {
+			if merged.Hours = intersectHourRanges(merged.Hours, extra.Hours); len(merged.Hours) == 0 {
+				return Filters{}, fmt.Errorf("conflicting hourofday filters")
+			}
+		} else {
+			merged.Hours = extra.Hours
 		}
-		merged.Search = extra.Search
 	}
 	if !extra.After.IsZero() {
 		if !merged.After.IsZero() && extra.After.After(merged.After) {
@@ -114,8 +474,450 @@ func MergeFilters(base Filters, extra Filters) (Filters, error) {
 	return merged, nil
 }
 
+// MatchesNegated reports whether e avoids every level!= and message!~ in f.
+func MatchesNegated(e types.LogEntry, f Filters) bool {
+	if containsFold(f.NotLevel, e.Level) {
+		return false
+	}
+	if len(f.NotSearch) > 0 {
+		msg := strings.ToLower(e.Message)
+		for _, sub := range f.NotSearch {
+			if strings.Contains(msg, strings.ToLower(sub)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkNegated rejects filters whose positive and negated conditions cannot
+// both hold, such as level=ERROR with level!=ERROR.
+func checkNegated(f Filters) error {
+	if f.Level != "" && containsFold(f.NotLevel, f.Level) {
+		return fmt.Errorf("conflicting level filters")
+	}
+	if len(f.LevelIn) > 0 {
+		excluded := true
+		for _, lvl := range f.LevelIn {
+			if !containsFold(f.NotLevel, lvl) {
+				excluded = false
+				break
+			}
+		}
+		if excluded {
+			return fmt.Errorf("conflicting level filters")
+		}
+	}
+	for _, sub := range f.NotSearch {
+		for _, want := range f.Search {
+			if strings.Contains(strings.ToLower(want), strings.ToLower(sub)) {
+				return fmt.Errorf("conflicting message filters")
+			}
+		}
+	}
+	return nil
+}
+
+// MatchesFields reports whether e satisfies f's field.<key> and has(<key>)
+// conditions.
+func MatchesFields(e types.LogEntry, f Filters) bool {
+	for _, key := range f.HasFields {
+		if e.Fields[key] == "" {
+			return false
+		}
+	}
+	for key, want := range f.FieldEq {
+		got, ok := e.Fields[key]
+		if !ok || !strings.EqualFold(got, want) {
+			return false
+		}
+	}
+	for key, wants := range f.FieldContains {
+		got, ok := e.Fields[key]
+		if !ok {
+			return false
+		}
+		for _, want := range wants {
+			if !strings.Contains(strings.ToLower(got), strings.ToLower(want)) {
+				return false
+			}
+		}
+	}
+	for key, cmps := range f.FieldCompare {
+		v, ok := NumericField(e, key)
+		if !ok {
+			return false
+		}
+		for _, c := range cmps {
+			if !c.Matches(v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// NumericField parses e's field key as a float64; ok is false when the field
+// is missing or not a number.
+func NumericField(e types.LogEntry, key string) (float64, bool) {
+	got, ok := e.Fields[key]
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(got), 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// mergeComparisons ANDs two field.<key> comparison maps.
+func mergeComparisons(base, extra map[string][]Comparison) map[string][]Comparison {
+	if len(extra) == 0 {
+		return base
+	}
+	out := make(map[string][]Comparison, len(base)+len(extra))
+	for k, v := range base {
+		out[k] = append([]Comparison(nil), v...)
+	}
+	for k, cmps := range extra {
+		for _, c := range cmps {
+			if !containsComparison(out[k], c) {
+				out[k] = append(out[k], c)
+			}
+		}
+	}
+	return out
+}
+
+func containsComparison(list []Comparison, c Comparison) bool {
+	for _, v := range list {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+func sameComparisons(a, b map[string][]Comparison) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		w, ok := b[k]
+		if !ok || len(v) != len(w) {
+			return false
+		}
+		for i := range v {
+			if v[i] != w[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// MatchesSearch reports whether e's message contains every Search term and
+// matches every MessageRegex in f.
+func MatchesSearch(e types.LogEntry, f Filters) bool {
+	if len(f.Search) > 0 {
+		msg := strings.ToLower(e.Message)
+		for _, sub := range f.Search {
+			if !strings.Contains(msg, strings.ToLower(sub)) {
+				return false
+			}
+		}
+	}
+	for _, re := range f.MessageRegex {
+		if !re.MatchString(e.Message) {
+			return false
+		}
+	}
+	return true
+}
+
+func addFieldValue(m map[string][]string, key, val string) map[string][]string {
+	if m == nil {
+		m = make(map[string][]string)
+	}
+	if !containsFold(m[key], val) {
+		m[key] = append(m[key], val)
+	}
+	return m
+}
+
+// mergeFieldLists ANDs two field.<key>~ condition maps: every term from
+// either side must match.
+func mergeFieldLists(base, extra map[string][]string) map[string][]string {
+	if len(extra) == 0 {
+		return base
+	}
+	out := make(map[string][]string, len(base)+len(extra))
+	for k, v := range base {
+		out[k] = append([]string(nil), v...)
+	}
+	for k, vals := range extra {
+		for _, v := range vals {
+			out = addFieldValue(out, k, v)
+		}
+	}
+	return out
+}
+
+func sameFieldLists(a, b map[string][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || !sameStringsFold(v, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func setFieldValue(m map[string]string, key, val string) map[string]string {
+	if m == nil {
+		m = make(map[string]string)
+	}
+	m[key] = val
+	return m
+}
+
+// mergeFieldValues ANDs two field condition maps; the same key with values
+// that are not equal is a conflict.
+func mergeFieldValues(base, extra map[string]string, equal func(a, b string) bool) (map[string]string, error) {
+	if len(extra) == 0 {
+		return base, nil
+	}
+	out := make(map[string]string, len(base)+len(extra))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range extra {
+		if have, ok := out[k]; ok && !equal(have, v) {
+			return nil, fmt.Errorf("conflicting field.%s filters", k)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+func sameFieldValues(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// AndFilters combines a and b so an entry must match both. Unlike MergeFilters
+// it accepts OR on either side, expanding (a OR b) AND (c OR d) into the
+// pairwise branches. Branches that can never match, such as level=ERROR with
+// level=WARN or disjoint time ranges, are dropped; it is an error only if none
+// remain.
+func AndFilters(a, b Filters) (Filters, error) {
+	if len(a.Or) == 0 && len(b.Or) == 0 {
+		return MergeFilters(a, b)
+	}
+	if len(a.Or) == 0 {
+		a, b = b, a
+	}
+	root := Filters{}
+	var firstErr error
+	for _, opt := range a.Or {
+		merged, err := AndFilters(opt, b)
+		if err == nil && len(merged.Or) == 0 {
+			err = checkTimeRange(merged)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if len(merged.Or) > 0 {
+			root.Or = append(root.Or, merged.Or...)
+		} else {
+			root.Or = append(root.Or, merged)
+		}
+	}
+	if len(root.Or) == 0 {
+		return Filters{}, firstErr
+	}
+	return collapseLevelOr(root), nil
+}
+
+// checkTimeRange rejects a branch whose after= is not before its before=.
+func checkTimeRange(f Filters) error {
+	if !f.After.IsZero() && !f.Before.IsZero() && !f.After.Before(f.Before) {
+		return fmt.Errorf("empty time range")
+	}
+	return nil
+}
+
+// OrFilters combines fs so an entry matching any of them matches. Nested OR
+// branches are flattened, and an empty Filters (match everything) makes the
+// result empty too.
+func OrFilters(fs ...Filters) Filters {
+	if len(fs) == 1 {
+		return fs[0]
+	}
+	root := Filters{}
+	for _, f := range fs {
+		if isEmptyFilters(f) {
+			return Filters{}
+		}
+		if len(f.Or) > 0 {
+			root.Or = append(root.Or, f.Or...)
+		} else {
+			root.Or = append(root.Or, f)
+		}
+	}
+	return collapseLevelOr(root)
+}
+
+// TimeBounds returns the time range f can match: the envelope of its OR
+// branches. A zero bound is open.
+func TimeBounds(f Filters) (after time.Time, before time.Time) {
+	if len(f.Or) == 0 {
+		return f.After, f.Before
+	}
+	for i, opt := range f.Or {
+		a, b := TimeBounds(opt)
+		if i == 0 {
+			after, before = a, b
+			continue
+		}
+		if a.IsZero() || (!after.IsZero() && a.Before(after)) {
+			after = a
+		}
+		if b.IsZero() || (!before.IsZero() && b.After(before)) {
+			before = b
+		}
+	}
+	return after, before
+}
+
+// WidenBounds moves After earlier and Before later by tolerance, including OR branches.
+func WidenBounds(f Filters, tolerance time.Duration) Filters {
+	if tolerance <= 0 {
+		return f
+	}
+	if !f.After.IsZero() {
+		f.After = f.After.Add(-tolerance)
+	}
+	if !f.Before.IsZero() {
+		f.Before = f.Before.Add(tolerance)
+	}
+	if len(f.Or) > 0 {
+		or := make([]Filters, 0, len(f.Or))
+		for _, opt := range f.Or {
+			or = append(or, WidenBounds(opt, tolerance))
+		}
+		f.Or = or
+	}
+	return f
+}
+
 func isEmptyFilters(f Filters) bool {
-	return f.Level == "" && f.Search == "" && f.After.IsZero() && f.Before.IsZero() && len(f.LevelIn) == 0 && len(f.Or) == 0
+	return f.Level == "" && len(f.Search) == 0 && f.After.IsZero() && f.Before.IsZero() && len(f.LevelIn) == 0 && len(f.Or) == 0 && f.MinLevel == "" && f.MessageEquals == "" && len(f.MessageRegex) == 0 && f.Expr == nil && len(f.Weekdays) == 0 && len(f.Hours) == 0 &&
+		len(f.FieldEq) == 0 && len(f.FieldContains) == 0 && len(f.FieldCompare) == 0 && len(f.HasFields) == 0 && len(f.NotLevel) == 0 && len(f.NotSearch) == 0
+}
+
+// String renders f in the query DSL, e.g. `level=ERROR after=2026-02-08T16:00:00Z`.
+// Time bounds are absolute, so "since" appears as after=. An --expr predicate is
+// shown as expr="..." for information; Parse does not accept it. Empty filters
+// render as "".
+func (f Filters) String() string {
+	if len(f.Or) > 0 {
+		groups := make([]string, 0, len(f.Or))
+		for _, opt := range f.Or {
+			groups = append(groups, opt.String())
+		}
+		return strings.Join(groups, " OR ")
+	}
+	parts := make([]string, 0, 8)
+	if f.Level != "" {
+		parts = append(parts, "level="+strings.ToUpper(f.Level))
+	}
+	if len(f.LevelIn) > 0 {
+		parts = append(parts, "level in ("+strings.ToUpper(strings.Join(f.LevelIn, ","))+")")
+	}
+	if f.MinLevel != "" {
+		parts = append(parts, "level>="+strings.ToUpper(f.MinLevel))
+	}
+	for _, lvl := range f.NotLevel {
+		parts = append(parts, "level!="+strings.ToUpper(lvl))
+	}
+	if !f.After.IsZero() {
+		parts = append(parts, "after="+f.After.UTC().Format(time.RFC3339))
+	}
+	if !f.Before.IsZero() {
+		parts = append(parts, "before="+f.Before.UTC().Format(time.RFC3339))
+	}
+	for _, sub := range f.Search {
+		parts = append(parts, "message~"+quoteValue(sub))
+	}
+	if f.MessageEquals != "" {
+		parts = append(parts, "message="+quoteValue(f.MessageEquals))
+	}
+	for _, re := range f.MessageRegex {
+		parts = append(parts, "message=~"+quoteValue(re.String()))
+	}
+	for _, sub := range f.NotSearch {
+		parts = append(parts, "message!~"+quoteValue(sub))
+	}
+	for _, key := range sortedKeys(f.FieldEq) {
+		parts = append(parts, "field."+key+"="+quoteValue(f.FieldEq[key]))
+	}
+	for _, key := range sortedKeys(f.FieldContains) {
+		for _, sub := range f.FieldContains[key] {
+			parts = append(parts, "field."+key+"~"+quoteValue(sub))
+		}
+	}
+	for _, key := range sortedKeys(f.FieldCompare) {
+		for _, c := range f.FieldCompare[key] {
+			parts = append(parts, "field."+key+c.String())
+		}
+	}
+	for _, key := range f.HasFields {
+		parts = append(parts, "has("+key+")")
+	}
+	if len(f.Weekdays) > 0 {
+		parts = append(parts, "dow="+formatWeekdays(f.Weekdays))
+	}
+	if len(f.Hours) > 0 {
+		parts = append(parts, "hourofday="+formatHourRanges(f.Hours))
+	}
+	if f.Expr != nil {
+		parts = append(parts, fmt.Sprintf("expr=%q", f.Expr.String()))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteValue quotes v when tokenize would otherwise split it.
+func quoteValue(v string) string {
+	if !strings.ContainsAny(v, " \t\"'") {
+		return v
+	}
+	if !strings.Contains(v, `"`) {
+		return `"` + v + `"`
+	}
+	return "'" + v + "'"
 }
 
 func MatchesFilters(e types.LogEntry, f Filters) bool {
@@ -142,13 +944,31 @@ func MatchesFilters(e types.LogEntry, f Filters) bool {
 	if f.Level != "" && !strings.EqualFold(e.Level, f.Level) {
 		return false
 	}
+	if !f.Options.MatchesMinLevel(e.Level, f.MinLevel) {
+		return false
+	}
 	if !f.After.IsZero() && e.Timestamp.Before(f.After) {
 		return false
 	}
 	if !f.Before.IsZero() && !e.Timestamp.Before(f.Before) {
 		return false
 	}
-	if f.Search != "" && !strings.Contains(strings.ToLower(e.Message), strings.ToLower(f.Search)) {
+	if !MatchesSearch(e, f) {
+		return false
+	}
+	if f.MessageEquals != "" && !strings.EqualFold(e.Message, f.MessageEquals) {
+		return false
+	}
+	if !MatchesNegated(e, f) {
+		return false
+	}
+	if !MatchesFields(e, f) {
+		return false
+	}
+	if !MatchesPeriodic(e, f) {
+		return false
+	}
+	if !f.Expr.Match(e, f.Options) {
 		return false
 	}
 	return true
@@ -157,11 +977,45 @@ func MatchesFilters(e types.LogEntry, f Filters) bool {
 func parseAndGroup(tokens []string) (Filters, error) {
 	var f Filters
 	for _, t := range tokens {
+		if name, ok, err := parseHas(t); ok || err != nil {
+			if err != nil {
+				return Filters{}, err
+			}
+			if !containsString(f.HasFields, name) {
+				f.HasFields = append(f.HasFields, name)
+			}
+			continue
+		}
 		key, op, val, err := splitToken(t)
 		if err != nil {
 			return Filters{}, err
 		}
 
+		if len(key) > len("field.") && strings.EqualFold(key[:len("field.")], "field.") {
+			name := key[len("field."):]
+			switch op {
+			case "=":
+				f.FieldEq = setFieldValue(f.FieldEq, name, val)
+			case "~":
+				f.FieldContains = addFieldValue(f.FieldContains, name, val)
+			case ">", ">=", "<", "<=":
+				v, err := strconv.ParseFloat(val, 64)
+				if err != nil {
+					return Filters{}, fmt.Errorf("field.%s%s needs a number, got %q", name, op, val)
+				}
+				c := Comparison{Op: op, Value: v}
+				if f.FieldCompare == nil {
+					f.FieldCompare = make(map[string][]Comparison)
+				}
+				if !containsComparison(f.FieldCompare[name], c) {
+					f.FieldCompare[name] = append(f.FieldCompare[name], c)
+				}
+			default:
+				return Filters{}, fmt.Errorf("field.%s supports '=', '~', '>', '>=', '<' or '<='", name)
+			}
+			continue
+		}
+
 		switch strings.ToLower(key) {
 		case "level":
 			if op == "in" {
@@ -172,15 +1026,46 @@ func parseAndGroup(tokens []string) (Filters, error) {
 				f.LevelIn = append(f.LevelIn, levels...)
 				continue
 			}
+			if op == ">=" {
+				if err := CheckLevel(val); err != nil {
+					return Filters{}, fmt.Errorf("level>=: %v", err)
+				}
+				f.MinLevel = val
+				continue
+			}
+			if op == "!=" {
+				f.NotLevel = append(f.NotLevel, val)
+				continue
+			}
 			if op != "=" {
-				return Filters{}, fmt.Errorf("level supports only '=' or 'in'")
+				return Filters{}, fmt.Errorf("level supports only '=', '!=', '>=' or 'in'")
 			}
 			f.Level = val
 		case "message", "search":
+			if op == "!~" {
+				f.NotSearch = append(f.NotSearch, val)
+				continue
+			}
+			if op == "=~" && strings.EqualFold(key, "message") {
+				re, err := regexp.Compile(val)
+				if err != nil {
+					return Filters{}, fmt.Errorf("invalid message regex %q: %v", val, err)
+				}
+				if !containsRegexp(f.MessageRegex, re) {
+					f.MessageRegex = append(f.MessageRegex, re)
+				}
+				continue
+			}
 			if op != "~" && op != "=" {
-				return Filters{}, fmt.Errorf("message/search supports '~' or '='")
+				return Filters{}, fmt.Errorf("message/search supports '~', '!~', '=' or (message only) '=~'")
+			}
+			if op == "=" && strings.EqualFold(key, "message") {
+				f.MessageEquals = val
+				continue
+			}
+			if !containsFold(f.Search, val) {
+				f.Search = append(f.Search, val)
 			}
-			f.Search = val
         case "since":
             if op != "=" {
                 return Filters{}, fmt.Errorf("since supports only '='")
@@ -208,13 +1093,46 @@ func parseAndGroup(tokens []string) (Filters, error) {
 				return Filters{}, fmt.Errorf("invalid before timestamp")
 			}
 			f.Before = tm
+		case "dow":
+			if op != "=" {
+				return Filters{}, fmt.Errorf("dow supports only '='")
+			}
+			days, err := parseWeekdays(val)
+			if err != nil {
+				return Filters{}, fmt.Errorf("invalid dow: %v", err)
+			}
+			f.Weekdays = days
+		case "hourofday":
+			if op != "=" {
+				return Filters{}, fmt.Errorf("hourofday supports only '='")
+			}
+			hours, err := parseHourRanges(val)
+			if err != nil {
+				return Filters{}, fmt.Errorf("invalid hourofday: %v", err)
+			}
+			f.Hours = hours
 		default:
 			return Filters{}, fmt.Errorf("unknown filter: %s", key)
 		}
 	}
+	if err := checkNegated(f); err != nil {
+		return Filters{}, err
+	}
 	return f, nil
 }
 
+// parseHas recognizes a has(<key>) token. ok is false for any other token.
+func parseHas(token string) (string, bool, error) {
+	if len(token) < len("has(") || !strings.EqualFold(token[:len("has(")], "has(") {
+		return "", false, nil
+	}
+	name := strings.TrimSuffix(token[len("has("):], ")")
+	if name == token[len("has("):] || strings.TrimSpace(name) == "" || strings.ContainsAny(name, "()") {
+		return "", false, fmt.Errorf("invalid filter %q: want has(<key>)", token)
+	}
+	return strings.TrimSpace(name), true, nil
+}
+
 func parseFlexibleDuration(value string) (time.Duration, error) {
     value = strings.TrimSpace(value)
     if value == "" {
@@ -267,20 +1185,34 @@ func splitToken(token string) (string, string, string, error) {
 		return key, "in", strings.TrimSpace(val), nil
 	}
 
-	var op string
-	var idx int
-	if strings.Contains(token, "~") {
-		op = "~"
-		idx = strings.Index(token, "~")
-	} else if strings.Contains(token, "=") {
-		op = "="
-		idx = strings.Index(token, "=")
-	} else {
+	// The operator is the leftmost one in the token, so values may contain
+	// operator characters (message="wait!=ok", message=a=~b).
+	op, idx := "", -1
+	for i := 0; i < len(token) && op == ""; i++ {
+		next := byte(0)
+		if i+1 < len(token) {
+			next = token[i+1]
+		}
+		switch {
+		case token[i] == '!' && (next == '=' || next == '~'):
+			op = token[i : i+2]
+		case (token[i] == '>' || token[i] == '<') && next == '=':
+			op = token[i : i+2]
+		case token[i] == '>' || token[i] == '<':
+			op = token[i : i+1]
+		case token[i] == '=' && next == '~':
+			op = "=~"
+		case token[i] == '=' || token[i] == '~':
+			op = token[i : i+1]
+		}
+		idx = i
+	}
+	if op == "" {
 		return "", "", "", fmt.Errorf("expected key=value or key~value")
 	}
 
 	key := strings.TrimSpace(token[:idx])
-	val := strings.TrimSpace(token[idx+1:])
+	val := strings.TrimSpace(token[idx+len(op):])
 	if key == "" || val == "" {
 		return "", "", "", fmt.Errorf("invalid token: %s", token)
 	}
@@ -351,6 +1283,11 @@ func splitOnOR(tokens []string) [][]string {
 			i++
 			continue
 		}
+		// Conditions are ANDed by default; an explicit AND is accepted and dropped.
+		if strings.EqualFold(t, "AND") {
+			i++
+			continue
+		}
 
 		if i+2 < len(tokens) && strings.EqualFold(tokens[i+1], "in") {
 			current = append(current, t+" in "+tokens[i+2])
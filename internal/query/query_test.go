@@ -0,0 +1,592 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+func TestMinLevelUnknownRank(t *testing.T) {
+	critical := types.LogEntry{Timestamp: time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC), Level: "CRITICAL", Message: "disk on fire"}
+	info := types.LogEntry{Timestamp: time.Date(2026, 2, 8, 10, 0, 1, 0, time.UTC), Level: "INFO", Message: "ok"}
+
+	f, err := Parse("level>=WARN")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if f.MinLevel != "WARN" {
+		t.Fatalf("Parse() MinLevel = %q, want WARN", f.MinLevel)
+	}
+
+	tests := []struct {
+		name string
+		rank string
+		want bool
+	}{
+		{name: "lowest", rank: "lowest", want: false},
+		{name: "highest", rank: "highest", want: true},
+		{name: "named fallback", rank: "ERROR", want: true},
+		{name: "named fallback below min", rank: "DEBUG", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rank, err := ParseUnknownLevelRank(tt.rank)
+			if err != nil {
+				t.Fatalf("ParseUnknownLevelRank() error = %v", err)
+			}
+			f := f.WithOptions(Options{UnknownLevelRank: rank})
+			if got := MatchesFilters(critical, f); got != tt.want {
+				t.Errorf("MatchesFilters(CRITICAL) = %v, want %v", got, tt.want)
+			}
+			if MatchesFilters(info, f) {
+				t.Errorf("MatchesFilters(INFO) = true, want false")
+			}
+		})
+	}
+
+	if _, err := ParseUnknownLevelRank("bogus"); err == nil {
+		t.Errorf("ParseUnknownLevelRank(bogus) error = nil, want error")
+	}
+	for _, q := range []string{"level>=WRAN", "level>=CRITICAL"} {
+		if _, err := Parse(q); err == nil {
+			t.Errorf("Parse(%q) error = nil, want unknown level", q)
+		}
+	}
+}
+
+func TestMessageEqualsVsContains(t *testing.T) {
+	e := types.LogEntry{Timestamp: time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC), Level: "INFO", Message: "User login"}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{query: `message="user login"`, want: true},
+		{query: `message=login`, want: false},
+		{query: `message~login`, want: true},
+		{query: `search=login`, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			f, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := MatchesFilters(e, f); got != tt.want {
+				t.Errorf("MatchesFilters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuilderTimeRange(t *testing.T) {
+	now := time.Date(2026, 2, 8, 12, 0, 0, 0, time.UTC)
+	b := NewBuilder()
+	b.now = func() time.Time { return now }
+	f, err := b.Since(time.Hour).Before(now).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if !f.After.Equal(now.Add(-time.Hour)) || !f.Before.Equal(now) {
+		t.Errorf("Build() = %+v, want one-hour window ending at %s", f, now)
+	}
+
+	if _, err := NewBuilder().After(now).Before(now.Add(-time.Minute)).Build(); err == nil {
+		t.Error("Build() with inverted range: expected error")
+	}
+	if _, err := NewBuilder().MinLevel("LOUD").Build(); err == nil {
+		t.Error("Build() with unknown min level: expected error")
+	}
+}
+
+func TestCompileExpr(t *testing.T) {
+	e := types.LogEntry{
+		Timestamp: time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC),
+		Level:     "ERROR",
+		Message:   "Database connection failed",
+		Fields:    map[string]string{"user_id": "42", "region": "eu-west"},
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`level == "error"`, true},
+		{`field.user_id == "42" and field.region ~ "EU"`, true},
+		{`field.missing == ""`, true},
+		{`len(field.region) > 7`, false},
+		{`level >= "WARN"`, true},
+		{`level < "WARN"`, false},
+		{`len(message) > 20 and level == "ERROR"`, true},
+		{`len(message) > 100 or message ~ "CONNECTION"`, true},
+		{`not (message ~ "database")`, false},
+		{`timestamp >= "2026-02-08T10:00:00Z" and timestamp < "2026-02-08T11:00:00Z"`, true},
+		{`message != 'Database connection failed'`, false},
+	}
+	for _, tt := range tests {
+		x, err := CompileExpr(tt.expr)
+		if err != nil {
+			t.Errorf("CompileExpr(%q) error = %v", tt.expr, err)
+			continue
+		}
+		if got := x.Match(e, Options{}); got != tt.want {
+			t.Errorf("CompileExpr(%q).Match() = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{
+		``,
+		`level = "ERROR"`,
+		`len(message) > "x"`,
+		`timestamp > "yesterday"`,
+		`len(timestamp) > 1`,
+		`size > 1`,
+		`level == "ERROR" and`,
+		`(level == "ERROR"`,
+		`message ~ 3`,
+		`level >= "WARNING"`,
+		`"EROR" == level`,
+		`field. == "x"`,
+	} {
+		if _, err := CompileExpr(bad); err == nil {
+			t.Errorf("CompileExpr(%q) error = nil, want error", bad)
+		}
+	}
+}
+
+func TestMergeFiltersExprIntoOr(t *testing.T) {
+	x, err := CompileExpr(`len(message) > 5`)
+	if err != nil {
+		t.Fatalf("CompileExpr() error = %v", err)
+	}
+	or, err := Parse("level=ERROR OR level=WARN")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	f, err := MergeFilters(Filters{Expr: x}, or)
+	if err != nil {
+		t.Fatalf("MergeFilters() error = %v", err)
+	}
+	short := types.LogEntry{Level: "ERROR", Message: "oops"}
+	long := types.LogEntry{Level: "WARN", Message: "disk nearly full"}
+	if MatchesFilters(short, f) || !MatchesFilters(long, f) {
+		t.Errorf("expr was not applied to every OR branch: %+v", f)
+	}
+}
+
+func TestFiltersStringRoundTrip(t *testing.T) {
+	for _, in := range []string{
+		"level=ERROR after=2026-02-08T16:00:00Z",
+		`level>=WARN before=2026-02-08T17:00:00Z message~"disk full"`,
+		"level in (ERROR,WARN) OR message=timeout",
+	} {
+		f, err := Parse(in)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", in, err)
+		}
+		if got := f.String(); got != in {
+			t.Errorf("Parse(%q).String() = %q", in, got)
+		}
+	}
+	if got := (Filters{}).String(); got != "" {
+		t.Errorf("empty Filters.String() = %q, want empty", got)
+	}
+}
+
+func TestParseCollapsesLevelOr(t *testing.T) {
+	f, err := Parse("level=ERROR OR level=WARN OR level in (FATAL,error)")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(f.Or) != 0 || f.Level != "" || !reflect.DeepEqual(f.LevelIn, []string{"ERROR", "WARN", "FATAL"}) {
+		t.Errorf("Parse() = %+v, want a single level in (ERROR,WARN,FATAL)", f)
+	}
+
+	f, err = Parse("level=ERROR search~db OR level=WARN search~db OR level=INFO")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got, want := f.String(), "level in (ERROR,WARN) message~db OR level=INFO"; got != want {
+		t.Errorf("Parse().String() = %q, want %q", got, want)
+	}
+
+	f, err = Parse("level=ERROR OR search~timeout")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(f.Or) != 2 {
+		t.Errorf("mixed-attribute OR was collapsed: %+v", f)
+	}
+}
+
+func TestTimeBounds(t *testing.T) {
+	f, err := Parse("level=ERROR after=2026-02-08T10:00:00Z before=2026-02-08T12:00:00Z OR level=WARN after=2026-02-08T09:00:00Z before=2026-02-08T11:00:00Z")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	after, before := TimeBounds(f)
+	if !after.Equal(time.Date(2026, 2, 8, 9, 0, 0, 0, time.UTC)) || !before.Equal(time.Date(2026, 2, 8, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("TimeBounds() = %v, %v; want 09:00 to 12:00", after, before)
+	}
+
+	f, _ = Parse("level=ERROR after=2026-02-08T10:00:00Z OR level=WARN")
+	if after, _ := TimeBounds(f); !after.IsZero() {
+		t.Errorf("TimeBounds() after = %v, want open when a branch is unbounded", after)
+	}
+}
+
+func TestPeriodicFilters(t *testing.T) {
+	utc := Options{Zone: time.UTC}
+	at := func(day, hour int) types.LogEntry {
+		// February 2026: the 7th is a Saturday, the 9th a Monday.
+		return types.LogEntry{Timestamp: time.Date(2026, 2, day, hour, 30, 0, 0, time.UTC), Level: "INFO"}
+	}
+	cases := []struct {
+		query string
+		entry types.LogEntry
+		want  bool
+	}{
+		{"dow=sat,sun", at(7, 12), true},
+		{"dow=sat,sun", at(9, 12), false},
+		{"dow=mon-fri", at(9, 12), true},
+		{"dow=fri-mon", at(8, 12), true},
+		{"hourofday=9-17", at(9, 9), true},
+		{"hourofday=9-17", at(9, 17), false},
+		{"hourofday=22-6", at(9, 23), true},
+		{"hourofday=22-6", at(9, 3), true},
+		{"hourofday=22-6", at(9, 12), false},
+		{"hourofday=8,12-13", at(9, 12), true},
+		{"dow=mon-fri hourofday=9-17", at(7, 10), false},
+	}
+	for _, tc := range cases {
+		f, err := Parse(tc.query)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tc.query, err)
+		}
+		if got := MatchesFilters(tc.entry, f.WithOptions(utc)); got != tc.want {
+			t.Errorf("%q on %s = %v, want %v", tc.query, tc.entry.Timestamp.Format(time.RFC3339), got, tc.want)
+		}
+	}
+
+	// Read in another zone, Saturday 23:30 UTC is already Sunday morning.
+	tokyo, err := ParsePeriodicZone("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("no tzdata: %v", err)
+	}
+	f, _ := Parse("dow=sun hourofday=8-9")
+	if !MatchesFilters(at(7, 23), f.WithOptions(Options{Zone: tokyo})) {
+		t.Error("dow/hourofday did not use the periodic zone")
+	}
+
+	for _, bad := range []string{"dow=funday", "hourofday=25", "hourofday=9-9", "dow>sat"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) error = nil, want an error", bad)
+		}
+	}
+	if f, _ := Parse("dow=sat,sun hourofday=9-17"); f.String() != "dow=sat,sun hourofday=9-17" {
+		t.Errorf("String() = %q", f.String())
+	}
+
+	// Merging overlapping periodic filters keeps the overlap.
+	night, _ := Parse("dow=fri-mon hourofday=22-6")
+	early, _ := Parse("dow=mon-wed hourofday=0-12")
+	merged, err := MergeFilters(night, early)
+	if err != nil {
+		t.Fatalf("MergeFilters() error = %v", err)
+	}
+	if got, want := merged.String(), "dow=mon hourofday=0-6"; got != want {
+		t.Errorf("MergeFilters() = %q, want %q", got, want)
+	}
+	weekend, _ := Parse("dow=sat,sun")
+	if _, err := MergeFilters(weekend, early); err == nil {
+		t.Error("MergeFilters(dow=sat,sun, dow=mon-wed) error = nil, want conflict")
+	}
+}
+
+func TestParseExplicitAnd(t *testing.T) {
+	f, err := Parse("level=ERROR AND message~db OR level=WARN and message~disk")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got, want := f.String(), "level=ERROR message~db OR level=WARN message~disk"; got != want {
+		t.Errorf("Parse().String() = %q, want %q", got, want)
+	}
+}
+
+func TestAndOrFilters(t *testing.T) {
+	parse := func(s string) Filters {
+		t.Helper()
+		f, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", s, err)
+		}
+		return f
+	}
+
+	got, err := AndFilters(parse("level=ERROR OR message~db"), parse("message~timeout OR level=WARN"))
+	if err != nil {
+		t.Fatalf("AndFilters() error = %v", err)
+	}
+	// level=ERROR with level=WARN can never match and is dropped; message~db
+	// with message~timeout is kept since one message can contain both.
+	if want := "level=ERROR message~timeout OR message~timeout message~db OR level=WARN message~db"; got.String() != want {
+		t.Errorf("AndFilters() = %q, want %q", got.String(), want)
+	}
+	if _, err := AndFilters(parse("level=ERROR"), parse("level=WARN OR level=INFO")); err == nil {
+		t.Error("AndFilters() with no satisfiable branch: error = nil")
+	}
+	got, err = AndFilters(parse("message~db OR level=ERROR"), parse("message~timeout"))
+	if err != nil {
+		t.Fatalf("AndFilters() error = %v", err)
+	}
+	if !MatchesFilters(types.LogEntry{Level: "INFO", Message: "db timeout"}, got) || MatchesFilters(types.LogEntry{Level: "INFO", Message: "db down"}, got) {
+		t.Errorf("AndFilters() = %q, want message~db message~timeout to need both terms", got.String())
+	}
+	got, err = AndFilters(parse("field.svc~api OR level=ERROR"), parse("field.svc~auth"))
+	if err != nil {
+		t.Fatalf("AndFilters() error = %v", err)
+	}
+	if len(got.Or) != 2 || !MatchesFilters(types.LogEntry{Message: "x", Fields: map[string]string{"svc": "auth-api"}}, got) {
+		t.Errorf("AndFilters() = %q, want both field.svc~ branches kept", got.String())
+	}
+	got, err = AndFilters(parse("after=2024-01-02T00:00:00Z OR level=ERROR"), parse("before=2024-01-01T00:00:00Z"))
+	if err != nil {
+		t.Fatalf("AndFilters() error = %v", err)
+	}
+	if want := "level=ERROR before=2024-01-01T00:00:00Z"; got.String() != want {
+		t.Errorf("AndFilters() = %q, want disjoint time range dropped (%q)", got.String(), want)
+	}
+	got, err = AndFilters(parse("level=ERROR OR level=WARN"), parse("level=WARN OR level=INFO"))
+	if err != nil {
+		t.Fatalf("AndFilters() error = %v", err)
+	}
+	if want := "level=WARN"; got.String() != want {
+		t.Errorf("AndFilters() = %q, want %q", got.String(), want)
+	}
+
+	if got, want := OrFilters(parse("level=ERROR"), parse("level=WARN OR message~db")).String(), "level in (ERROR,WARN) OR message~db"; got != want {
+		t.Errorf("OrFilters() = %q, want %q", got, want)
+	}
+	if got := OrFilters(parse("level=ERROR"), Filters{}); got.String() != "" {
+		t.Errorf("OrFilters() with a match-all operand = %q, want empty", got.String())
+	}
+}
+
+func TestFieldFilters(t *testing.T) {
+	e := types.LogEntry{Level: "INFO", Message: "login", Fields: map[string]string{"user_id": "42", "region": "US-East-1"}}
+	cases := []struct {
+		query string
+		want  bool
+	}{
+		{"field.user_id=42", true},
+		{"field.user_id=7", false},
+		{"field.region~us-east", true},
+		{"field.region=us-east", false},
+		{"field.missing=42", false},
+		{"level=INFO field.user_id=42 field.region~east", true},
+		{"field.user_id=7 OR field.region~east", true},
+		{"has(user_id)", true},
+		{"has(trace_id)", false},
+		{"level=INFO has(region) has(user_id)", true},
+		{"has(trace_id) OR field.user_id=42", true},
+	}
+	for _, tc := range cases {
+		f, err := Parse(tc.query)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tc.query, err)
+		}
+		if got := MatchesFilters(e, f); got != tc.want {
+			t.Errorf("%q = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+
+	if _, err := Parse("field.user_id!~42"); err == nil {
+		t.Error(`Parse("field.user_id!~42") error = nil, want unsupported operator`)
+	}
+	f, err := Parse("field.user_id=42 field.region~east")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.String(), "field.user_id=42 field.region~east"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if _, err := MergeFilters(f, Filters{FieldEq: map[string]string{"user_id": "7"}}); err == nil {
+		t.Error("MergeFilters() error = nil, want conflicting field filters")
+	}
+
+	// has() needs a non-empty value and round-trips through String.
+	if MatchesFilters(types.LogEntry{Fields: map[string]string{"trace_id": ""}}, Filters{HasFields: []string{"trace_id"}}) {
+		t.Error("has(trace_id) matched an empty value")
+	}
+	f, err = Parse("has(trace_id) level=ERROR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.String(), "level=ERROR has(trace_id)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	for _, bad := range []string{"has()", "has(trace_id", "has(a(b))"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) error = nil, want an error", bad)
+		}
+	}
+}
+
+func TestFieldComparisons(t *testing.T) {
+	entry := func(status string) types.LogEntry {
+		return types.LogEntry{Level: "INFO", Message: "req", Fields: map[string]string{"status": status}}
+	}
+	cases := []struct {
+		query string
+		e     types.LogEntry
+		want  bool
+	}{
+		{"field.status>500", entry("503"), true},
+		{"field.status>500", entry("500"), false},
+		{"field.status>=500", entry("500"), true},
+		{"field.status>=500", entry("499"), false},
+		{"field.status<400", entry("399.5"), true},
+		{"field.status<400", entry("400"), false},
+		{"field.status<=400", entry("400"), true},
+		{"field.status<=400", entry("1e3"), false},
+		{"field.status>=200 field.status<300", entry("204"), true},
+		{"field.status>=200 field.status<300", entry("302"), false},
+		// A missing or non-numeric field never matches, whichever way it compares.
+		{"field.status>=0", types.LogEntry{Level: "INFO", Message: "req"}, false},
+		{"field.status<=0", types.LogEntry{Level: "INFO", Message: "req"}, false},
+		{"field.status>=0", entry("ok"), false},
+		{"field.status<1000", entry(""), false},
+	}
+	for _, tc := range cases {
+		f, err := Parse(tc.query)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tc.query, err)
+		}
+		if got := MatchesFilters(tc.e, f); got != tc.want {
+			t.Errorf("%q on status=%q = %v, want %v", tc.query, tc.e.Fields["status"], got, tc.want)
+		}
+	}
+
+	f, err := Parse("field.latency_ms>1000 field.status>=500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.String(), "field.latency_ms>1000 field.status>=500"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	for _, bad := range []string{"field.status>=abc", "field.status<", "level<WARN"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) error = nil, want an error", bad)
+		}
+	}
+}
+
+func TestNegatedFilters(t *testing.T) {
+	entries := []types.LogEntry{
+		{Level: "DEBUG", Message: "cache warm"},
+		{Level: "INFO", Message: "GET /healthcheck 200"},
+		{Level: "INFO", Message: "user login"},
+		{Level: "ERROR", Message: "db timeout"},
+	}
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"level!=DEBUG", []string{"GET /healthcheck 200", "user login", "db timeout"}},
+		{"message!~HealthCheck", []string{"cache warm", "user login", "db timeout"}},
+		{"level!=debug message!~healthcheck", []string{"user login", "db timeout"}},
+		{"level!=DEBUG level!=INFO", []string{"db timeout"}},
+		{"level=INFO message!~health", []string{"user login"}},
+		{"level!=ERROR OR message~timeout", []string{"cache warm", "GET /healthcheck 200", "user login", "db timeout"}},
+	}
+	for _, tc := range cases {
+		f, err := Parse(tc.query)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tc.query, err)
+		}
+		var got []string
+		for _, e := range entries {
+			if MatchesFilters(e, f) {
+				got = append(got, e.Message)
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q matched %v, want %v", tc.query, got, tc.want)
+		}
+	}
+
+	// Operator characters after the first '=' belong to the value.
+	for query, want := range map[string]string{`message="wait!=ok"`: "wait!=ok", "message=a!=b": "a!=b", "message=x!~y": "x!~y"} {
+		f, err := Parse(query)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", query, err)
+			continue
+		}
+		if f.MessageEquals != want || len(f.NotSearch) > 0 || len(f.MessageRegex) > 0 {
+			t.Errorf("Parse(%q) = %q, want message=%q", query, f.String(), want)
+		}
+	}
+
+	f, err := Parse("level!=DEBUG message!~healthcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.String(), "level!=DEBUG message!~healthcheck"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	for _, q := range []string{"level=ERROR level!=ERROR", "level in (ERROR,WARN) level!=ERROR level!=WARN", "message!=x"} {
+		if _, err := Parse(q); err == nil {
+			t.Errorf("Parse(%q) error = nil, want error", q)
+		}
+	}
+	if _, err := MergeFilters(Filters{Level: "ERROR"}, Filters{NotLevel: []string{"error"}}); err == nil {
+		t.Error("MergeFilters(level=ERROR, level!=ERROR) error = nil, want conflict")
+	}
+}
+
+func TestMessageRegex(t *testing.T) {
+	f, err := Parse(`level=INFO message=~"^GET /api/(users|orders) [45]\d\d$"`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	cases := []struct {
+		msg  string
+		want bool
+	}{
+		{"GET /api/users 404", true},
+		{"GET /api/orders 503", true},
+		{"GET /api/users 200", false},
+		{"POST /api/users 404", false},
+		{"get /api/users 404", false},
+	}
+	for _, tc := range cases {
+		if got := MatchesFilters(types.LogEntry{Level: "INFO", Message: tc.msg}, f); got != tc.want {
+			t.Errorf("%q = %v, want %v", tc.msg, got, tc.want)
+		}
+	}
+	if got, want := f.String(), `level=INFO message=~"^GET /api/(users|orders) [45]\d\d$"`; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	// =~ later in the token is part of the value, not the operator.
+	if eq, _ := Parse("message=a=~b"); eq.MessageEquals != "a=~b" || len(eq.MessageRegex) > 0 {
+		t.Errorf("Parse(message=a=~b) = %q, want message=\"a=~b\"", eq.String())
+	}
+	if sub, _ := Parse("message~x=~y"); len(sub.Search) != 1 || sub.Search[0] != "x=~y" {
+		t.Errorf("Parse(message~x=~y) = %q, want message~\"x=~y\"", sub.String())
+	}
+
+	if _, err := Parse("message=~(unclosed"); err == nil {
+		t.Error("Parse(bad regex) error = nil, want invalid message regex")
+	}
+	other, _ := Parse("message=~404$")
+	merged, err := MergeFilters(f, other)
+	if err != nil {
+		t.Fatalf("MergeFilters() error = %v", err)
+	}
+	if !MatchesFilters(types.LogEntry{Level: "INFO", Message: "GET /api/users 404"}, merged) || MatchesFilters(types.LogEntry{Level: "INFO", Message: "GET /api/users 500"}, merged) {
+		t.Errorf("MergeFilters() = %q, want both regexes required", merged.String())
+	}
+}
@@ -0,0 +1,167 @@
+package report
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/query"
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+// Pattern is a group of entries whose messages normalize to the same text.
+type Pattern struct {
+	Pattern   string    `json:"pattern"`
+	Level     string    `json:"level"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Example   string    `json:"example"`
+}
+
+var (
+	uuidPattern   = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	ipPattern     = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`)
+	emailPattern  = regexp.MustCompile(`\b[\w.+-]+@[\w-]+(?:\.[\w-]+)+\b`)
+	hexPattern    = regexp.MustCompile(`(?i)\b(?:0x)?[0-9a-f]{8,}\b`)
+	numberPattern = regexp.MustCompile(`\d+(?:\.\d+)?`)
+)
+
+// NormalizeMessage masks the variable parts of a message so that occurrences of
+// the same problem group together: UUIDs, IP addresses, emails, hex IDs (8+
+// characters mixing digits and letters) and numbers become placeholders.
+func NormalizeMessage(msg string) string {
+	msg = uuidPattern.ReplaceAllString(msg, "<uuid>")
+	msg = ipPattern.ReplaceAllString(msg, "<ip>")
+	msg = emailPattern.ReplaceAllString(msg, "<email>")
+	msg = hexPattern.ReplaceAllStringFunc(msg, func(m string) string {
+		digits := strings.TrimPrefix(strings.ToLower(m), "0x")
+		if strings.Trim(digits, "0123456789") == "" || strings.Trim(digits, "abcdef") == "" {
+			return m // all digits (a number) or all letters (a word)
+		}
+		return "<hex>"
+	})
+	return numberPattern.ReplaceAllString(msg, "<n>")
+}
+
+// GroupPatterns groups entries at or above minLevel (ranked under opts) by level
+// and normalized message, ordered by count (then most recent). top > 0 keeps
+// only the first top.
+func GroupPatterns(entries []types.LogEntry, minLevel string, top int, opts query.Options) []Pattern {
+	byKey := make(map[string]*Pattern)
+	for _, e := range entries {
+		if !opts.MatchesMinLevel(e.Level, minLevel) {
+			continue
+		}
+		level := strings.ToUpper(e.Level)
+		norm := NormalizeMessage(e.Message)
+		key := level + "|" + norm
+		p, ok := byKey[key]
+		if !ok {
+			p = &Pattern{Pattern: norm, Level: level, FirstSeen: e.Timestamp, LastSeen: e.Timestamp, Example: e.Message}
+			byKey[key] = p
+		}
+		p.Count++
+		if e.Timestamp.Before(p.FirstSeen) {
+			p.FirstSeen = e.Timestamp
+		}
+		if e.Timestamp.After(p.LastSeen) {
+			p.LastSeen = e.Timestamp
+		}
+	}
+
+	out := make([]Pattern, 0, len(byKey))
+	for _, p := range byKey {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		if !out[i].LastSeen.Equal(out[j].LastSeen) {
+			return out[i].LastSeen.After(out[j].LastSeen)
+		}
+		return out[i].Pattern < out[j].Pattern
+	})
+	if top > 0 && len(out) > top {
+		out = out[:top]
+	}
+	return out
+}
+
+// Distinct is one exact message and how often it occurred.
+type Distinct struct {
+	Message   string    `json:"message"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// DistinctMessages counts each exact message in entries, without normalization,
+// ordered by count (then earliest first seen).
+func DistinctMessages(entries []types.LogEntry) []Distinct {
+	byMsg := make(map[string]*Distinct)
+	for _, e := range entries {
+		d, ok := byMsg[e.Message]
+		if !ok {
+			d = &Distinct{Message: e.Message, FirstSeen: e.Timestamp, LastSeen: e.Timestamp}
+			byMsg[e.Message] = d
+		}
+		d.Count++
+		if e.Timestamp.Before(d.FirstSeen) {
+			d.FirstSeen = e.Timestamp
+		}
+		if e.Timestamp.After(d.LastSeen) {
+			d.LastSeen = e.Timestamp
+		}
+	}
+	out := make([]Distinct, 0, len(byMsg))
+	for _, d := range byMsg {
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		if !out[i].FirstSeen.Equal(out[j].FirstSeen) {
+			return out[i].FirstSeen.Before(out[j].FirstSeen)
+		}
+		return out[i].Message < out[j].Message
+	})
+	return out
+}
+
+// LevelCount is one raw level spelling and how often it occurred.
+type LevelCount struct {
+	Level string `json:"level"`
+	Count int    `json:"count"`
+	// Bucket is the case-folded index key the spelling falls under.
+	Bucket string `json:"bucket"`
+	// Known is false for spellings that aren't DEBUG/INFO/WARN/ERROR/FATAL in
+	// any case; those are the candidates for --level-map.
+	Known bool `json:"known"`
+}
+
+// LevelVocabulary counts every raw Level value in an index's ByLevel buckets.
+// Bucket keys are case-folded, so "warn" and "WARN" share a bucket but are
+// counted as separate spellings. Ordered by count, then spelling.
+func LevelVocabulary(byLevel map[string][]types.LogEntry) []LevelCount {
+	out := make([]LevelCount, 0, len(byLevel))
+	for bucket, entries := range byLevel {
+		counts := make(map[string]int)
+		for _, e := range entries {
+			counts[e.Level]++
+		}
+		for level, n := range counts {
+			out = append(out, LevelCount{Level: level, Count: n, Bucket: bucket, Known: query.IsKnownLevel(level)})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Level < out[j].Level
+	})
+	return out
+}
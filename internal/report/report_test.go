@@ -0,0 +1,89 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/query"
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+func TestNormalizeMessage(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Retrying failed query (attempt 2/3)", "Retrying failed query (attempt <n>/<n>)"},
+		{"request 3f2b8c1e-9d4a-4b7e-8f00-1234567890ab failed", "request <uuid> failed"},
+		{"Multiple failed login attempts detected: IP=192.168.1.100", "Multiple failed login attempts detected: IP=<ip>"},
+		{"Authentication failed for user: unknown@example.com", "Authentication failed for user: <email>"},
+		{"commit deadbeef42 not found", "commit <hex> not found"},
+		{"cafe is open", "cafe is open"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeMessage(tt.in); got != tt.want {
+			t.Errorf("NormalizeMessage(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGroupPatterns(t *testing.T) {
+	at := func(min int) time.Time { return time.Date(2026, 2, 8, 10, min, 0, 0, time.UTC) }
+	entries := []types.LogEntry{
+		{Timestamp: at(1), Level: "ERROR", Message: "timeout after 30s"},
+		{Timestamp: at(5), Level: "ERROR", Message: "timeout after 45s"},
+		{Timestamp: at(3), Level: "error", Message: "timeout after 10s"},
+		{Timestamp: at(2), Level: "WARN", Message: "disk 91% full"},
+		{Timestamp: at(4), Level: "INFO", Message: "started in 3s"},
+	}
+	got := GroupPatterns(entries, "WARN", 0, query.Options{})
+	if len(got) != 2 {
+		t.Fatalf("GroupPatterns() returned %d patterns, want 2: %+v", len(got), got)
+	}
+	first := got[0]
+	if first.Pattern != "timeout after <n>s" || first.Count != 3 || !first.FirstSeen.Equal(at(1)) || !first.LastSeen.Equal(at(5)) {
+		t.Errorf("top pattern = %+v", first)
+	}
+	if top := GroupPatterns(entries, "WARN", 1, query.Options{}); len(top) != 1 {
+		t.Errorf("GroupPatterns(top=1) returned %d patterns", len(top))
+	}
+}
+
+func TestDistinctMessages(t *testing.T) {
+	at := func(min int, msg string) types.LogEntry {
+		return types.LogEntry{Timestamp: time.Date(2026, 2, 8, 10, min, 0, 0, time.UTC), Level: "ERROR", Message: msg}
+	}
+	got := DistinctMessages([]types.LogEntry{
+		at(1, "timeout after 5s"), at(2, "disk full"), at(3, "timeout after 5s"),
+		at(4, "timeout after 6s"), at(9, "timeout after 5s"),
+	})
+	if len(got) != 3 {
+		t.Fatalf("DistinctMessages() returned %d messages, want 3 (no normalization)", len(got))
+	}
+	first := got[0]
+	if first.Message != "timeout after 5s" || first.Count != 3 || first.FirstSeen.Minute() != 1 || first.LastSeen.Minute() != 9 {
+		t.Errorf("top message = %+v, want timeout after 5s x3 from :01 to :09", first)
+	}
+	if got[1].Message != "disk full" || got[2].Message != "timeout after 6s" {
+		t.Errorf("ties ordered %q, %q; want earliest first seen first", got[1].Message, got[2].Message)
+	}
+}
+
+func TestLevelVocabulary(t *testing.T) {
+	byLevel := map[string][]types.LogEntry{
+		"WARN":    {{Level: "WARN"}, {Level: "warn"}, {Level: "WARN"}},
+		"WARNING": {{Level: "warning"}},
+		"ERROR":   {{Level: "ERROR"}, {Level: "ERROR"}},
+	}
+	got := LevelVocabulary(byLevel)
+	want := []LevelCount{
+		{Level: "ERROR", Count: 2, Bucket: "ERROR", Known: true},
+		{Level: "WARN", Count: 2, Bucket: "WARN", Known: true},
+		{Level: "warn", Count: 1, Bucket: "WARN", Known: true},
+		{Level: "warning", Count: 1, Bucket: "WARNING", Known: false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("LevelVocabulary() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// canWrite reports whether path's permission bits allow writing; without
+// access(2) ownership is not taken into account.
+func canWrite(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0222 == 0 {
+		return errors.New("permission denied")
+	}
+	return nil
+}
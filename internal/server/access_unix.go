@@ -0,0 +1,14 @@
+//go:build unix
+
+package server
+
+import "syscall"
+
+// accessWrite is W_OK from <unistd.h>.
+const accessWrite = 0x2
+
+// canWrite reports whether this process may write to path, checking
+// permissions without opening it.
+func canWrite(path string) error {
+	return syscall.Access(path, accessWrite)
+}
@@ -1,147 +1,389 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	"container/list"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/armash/log-pipeline/internal/engine"
 	"github.com/armash/log-pipeline/internal/ingest"
 	"github.com/armash/log-pipeline/internal/index"
 	"github.com/armash/log-pipeline/internal/query"
+	"github.com/armash/log-pipeline/internal/store"
 	"github.com/armash/log-pipeline/internal/types"
 )
 
 type Server struct {
-	mu         sync.RWMutex
-	entries    []types.LogEntry
-	loadStats  engine.LoadStats
-	useIndex   bool
-	baseIndex  *index.Index
-	lastMetric engine.Metrics
-	hasMetric  bool
-	storePath  string
-	shardDir   string
-	apiKey     string
-}
-
-func New(entries []types.LogEntry, stats engine.LoadStats, useIndex bool, baseIndex *index.Index, storePath string, shardDir string, apiKey string) *Server {
-	return &Server{
-		entries:   entries,
-		loadStats: stats,
-		useIndex:  useIndex,
-		baseIndex: baseIndex,
-		storePath: storePath,
-		shardDir:  shardDir,
-		apiKey:    apiKey,
+	mu           sync.RWMutex
+	entries      []types.LogEntry
+	loadStats    engine.LoadStats
+	useIndex     bool
+	baseIndex    *index.Index
+	lastMetric   engine.Metrics
+	hasMetric    bool
+	storePath    string
+	backend      store.Store
+	shardDir     string
+	apiKey       string
+	maxEntries   int
+	evicted      int
+	idem         *idempotencyCache
+	shards       store.ShardOptions
+	uiBasePath   string
+	defaultLimit int
+	maxLimit     int
+	utc          bool
+	stampIngest  bool
+	queryOpts    query.Options
+	ioSem        chan struct{}
+
+	// drainCtx is cancelled when shutdown begins; streaming handlers check it
+	// between writes and stop at a clean boundary.
+	drainCtx        context.Context
+	drain           context.CancelFunc
+	shutdownTimeout time.Duration
+
+	// Cumulative counters are atomic so the query path doesn't take the write lock for them.
+	totalQueries  atomic.Int64
+	totalFiltered atomic.Int64
+	bytesServed   atomic.Int64
+}
+
+// Options configures a Server.
+type Options struct {
+	UseIndex  bool
+	StorePath string
+	ShardDir  string
+	APIKey    string
+	// MaxEntries caps the in-memory entries; the oldest are evicted once exceeded
+	// (0 = unbounded). Evicted entries remain in the store/shards if configured.
+	MaxEntries int
+	// IdempotencyKeys is how many recent Idempotency-Key values /ingest remembers
+	// (0 = DefaultIdempotencyKeys).
+	IdempotencyKeys int
+	// Shards controls how ingested entries are appended to ShardDir.
+	Shards store.ShardOptions
+	// UIBasePath is where the web UI is mounted and where / redirects
+	// (default DefaultUIBasePath). See NormalizeUIBasePath.
+	UIBasePath string
+	// DefaultLimit applies to queries that omit limit (0 = unlimited). MaxLimit caps
+	// every query, including limit=0 (0 = no cap); clamped responses carry X-Limit-Clamped.
+	DefaultLimit int
+	MaxLimit     int
+	// UTC converts ingested timestamps to UTC before they are stored.
+	UTC bool
+	// StampIngest sets IngestedAt on posted entries that lack one.
+	StampIngest bool
+	// MaxIOConcurrency caps handlers reading from disk (/raw and the web UI files)
+	// running at once; extra requests get 503 (0 = unlimited).
+	MaxIOConcurrency int
+	// ShutdownTimeout is how long Start waits for in-flight requests to finish
+	// once ctx is cancelled (0 = DefaultShutdownTimeout).
+	ShutdownTimeout time.Duration
+	// Query holds the matching settings applied to every request's filters.
+	Query query.Options
+}
+
+// DefaultShutdownTimeout is the default grace period for in-flight requests.
+const DefaultShutdownTimeout = 5 * time.Second
+
+// DefaultUIBasePath is the default mount point of the web UI.
+const DefaultUIBasePath = "/ui/"
+
+// NormalizeUIBasePath returns path with a leading and trailing slash, e.g. "logs" -> "/logs/".
+// Empty means DefaultUIBasePath; "/" is rejected because it would shadow the API routes.
+func NormalizeUIBasePath(path string) (string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return DefaultUIBasePath, nil
+	}
+	path = "/" + strings.Trim(path, "/") + "/"
+	if path == "//" {
+		return "", fmt.Errorf("UI base path cannot be /")
 	}
+	return path, nil
 }
 
-func (s *Server) Start(ctx context.Context, addr string) error {
+// DefaultIdempotencyKeys is the default number of remembered Idempotency-Key values.
+const DefaultIdempotencyKeys = 1024
+
+func New(entries []types.LogEntry, stats engine.LoadStats, baseIndex *index.Index, opts Options) *Server {
+	s := &Server{
+		entries:      entries,
+		loadStats:    stats,
+		useIndex:     opts.UseIndex,
+		baseIndex:    baseIndex,
+		storePath:    opts.StorePath,
+		shardDir:     opts.ShardDir,
+		apiKey:       opts.APIKey,
+		maxEntries:   opts.MaxEntries,
+		idem:         newIdempotencyCache(opts.IdempotencyKeys),
+		shards:       opts.Shards,
+		uiBasePath:   opts.UIBasePath,
+		defaultLimit: opts.DefaultLimit,
+		maxLimit:     opts.MaxLimit,
+		utc:          opts.UTC,
+		stampIngest:  opts.StampIngest,
+		queryOpts:    opts.Query,
+	}
+	if s.uiBasePath == "" {
+		s.uiBasePath = DefaultUIBasePath
+	}
+	if opts.StorePath != "" {
+		s.backend = store.NewJSONL(opts.StorePath)
+	}
+	if opts.MaxIOConcurrency > 0 {
+		s.ioSem = make(chan struct{}, opts.MaxIOConcurrency)
+	}
+	s.drainCtx, s.drain = context.WithCancel(context.Background())
+	s.shutdownTimeout = opts.ShutdownTimeout
+	if s.shutdownTimeout <= 0 {
+		s.shutdownTimeout = DefaultShutdownTimeout
+	}
+	s.evictLocked()
+	return s
+}
+
+// evictLocked drops the oldest in-memory entries beyond maxEntries. Callers hold s.mu.
+func (s *Server) evictLocked() {
+	if s.maxEntries <= 0 || len(s.entries) <= s.maxEntries {
+		return
+	}
+	drop := len(s.entries) - s.maxEntries
+	kept := make([]types.LogEntry, s.maxEntries)
+	copy(kept, s.entries[drop:])
+	s.entries = kept
+	s.evicted += drop
+	s.baseIndex = nil
+}
+
+// Handler returns the HTTP handler with all routes registered.
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/readyz", s.handleReady)
 	mux.HandleFunc("/query", s.handleQuery)
+	mux.HandleFunc("/query/batch", s.handleQueryBatch)
 	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/index/stats", s.handleIndexStats)
+	mux.HandleFunc("/aggregate", s.handleAggregate)
+	mux.HandleFunc("/entries", s.handleEntries)
 	mux.HandleFunc("/ingest", s.handleIngest)
 	mux.HandleFunc("/ingest/file", s.handleIngestFile)
+	mux.HandleFunc("/ingest/ndjson", s.handleIngestNDJSON)
+	mux.Handle("/raw", s.limitIO(http.HandlerFunc(s.handleRaw)))
 	mux.HandleFunc("/", s.handleRoot)
-	mux.Handle("/ui/", http.StripPrefix("/ui/", http.FileServer(http.Dir(webDir()))))
+	mux.Handle(s.uiBasePath, s.limitIO(http.StripPrefix(s.uiBasePath, http.FileServer(http.Dir(webDir())))))
+	return s.countBytes(mux)
+}
 
+// Start serves until ctx is cancelled. addr is a TCP address such as ":8080", or
+// "unix:/path/to.sock" to listen on a Unix domain socket; a stale socket file at
+// that path is removed first, and the socket is removed again on shutdown.
+// On cancellation the server drains: streaming handlers are told to wrap up,
+// /readyz reports not ready, and in-flight requests get ShutdownTimeout to finish.
+func (s *Server) Start(ctx context.Context, addr string) error {
 	srv := &http.Server{
 		Addr:    addr,
-		Handler: mux,
+		Handler: s.Handler(),
+	}
+
+	ln, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		defer os.Remove(path)
 	}
 
 	go func() {
 		<-ctx.Done()
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		s.drain()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
 		defer cancel()
 		_ = srv.Shutdown(shutdownCtx)
 	}()
 
-	err := srv.ListenAndServe()
+	err = srv.Serve(ln)
 	if err == http.ErrServerClosed {
 		return nil
 	}
 	return err
 }
 
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("empty unix socket path")
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// limitIO rejects a request with 503 when MaxIOConcurrency disk-reading
+// handlers are already running, instead of queueing it.
+func (s *Server) limitIO(h http.Handler) http.Handler {
+	if s.ioSem == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case s.ioSem <- struct{}{}:
+			defer func() { <-s.ioSem }()
+			h.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many concurrent file reads", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// draining reports whether shutdown has begun.
+func (s *Server) draining() bool {
+	return s.drainCtx.Err() != nil
+}
+
 func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
 		http.NotFound(w, r)
 		return
 	}
-	http.Redirect(w, r, "/ui/", http.StatusFound)
+	http.Redirect(w, r, s.uiBasePath, http.StatusFound)
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
-func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
-	level := r.URL.Query().Get("level")
-	search := r.URL.Query().Get("search")
-	since := r.URL.Query().Get("since")
-	after := r.URL.Query().Get("after")
-	before := r.URL.Query().Get("before")
-	limitStr := r.URL.Query().Get("limit")
-	q := r.URL.Query().Get("q")
-
-	var cutoff time.Time
-	if since != "" {
-		d, err := parseFlexibleDuration(since)
-		if err != nil {
-			http.Error(w, "invalid since duration", http.StatusBadRequest)
-			return
+// handleReady reports whether the server can serve and persist ingest: the store
+// file must open for append and the shard directory must accept new files.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	checks := make(map[string]string)
+	var reasons []string
+	if s.storePath != "" {
+		if err := checkStoreWritable(s.storePath); err != nil {
+			checks["store"] = "error"
+			reasons = append(reasons, fmt.Sprintf("store %s is not writable: %v", s.storePath, err))
+		} else {
+			checks["store"] = "ok"
 		}
-		cutoff = time.Now().Add(-d)
 	}
-
-	filters := query.BuildFilters(level, cutoff, search)
-	if after != "" {
-		tm, err := time.Parse(time.RFC3339, after)
-		if err != nil {
-			http.Error(w, "invalid after timestamp", http.StatusBadRequest)
-			return
+	if s.shardDir != "" {
+		if err := checkDirWritable(s.shardDir); err != nil {
+			checks["shards"] = "error"
+			reasons = append(reasons, fmt.Sprintf("shard dir %s is not writable: %v", s.shardDir, err))
+		} else {
+			checks["shards"] = "ok"
 		}
-		filters.After = tm
 	}
-	if before != "" {
-		tm, err := time.Parse(time.RFC3339, before)
-		if err != nil {
-			http.Error(w, "invalid before timestamp", http.StatusBadRequest)
-			return
+
+	if s.draining() {
+		checks["drain"] = "draining"
+		reasons = append(reasons, "server is shutting down")
+	}
+
+	status := http.StatusOK
+	payload := map[string]interface{}{
+		"ready":  len(reasons) == 0,
+		"checks": checks,
+	}
+	if len(reasons) > 0 {
+		status = http.StatusServiceUnavailable
+		payload["reason"] = strings.Join(reasons, "; ")
+	}
+	writeJSON(w, status, payload)
+}
+
+// checkStoreWritable reports whether the store file could be appended to
+// without touching the filesystem: an existing file must be writable, and a
+// missing one needs a directory it could be created in.
+func checkStoreWritable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return checkDirWritable(filepath.Dir(path))
 		}
-		filters.Before = tm
+		return err
 	}
-	if q != "" {
-		parsed, err := query.Parse(q)
-		if err != nil {
-			http.Error(w, "invalid query", http.StatusBadRequest)
-			return
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return canWrite(path)
+}
+
+// checkDirWritable reports whether files could be created in dir, or in its
+// nearest existing parent when dir is still to be created. Nothing is created.
+func checkDirWritable(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			return canWrite(dir)
 		}
-		merged, err := query.MergeFilters(filters, parsed)
-		if err != nil {
-			http.Error(w, "conflicting query filters", http.StatusBadRequest)
-			return
+		parent := filepath.Dir(dir)
+		if !os.IsNotExist(err) || parent == dir {
+			return err
 		}
-		filters = merged
+		dir = parent
 	}
+}
 
-	limit := 0
-	if limitStr != "" {
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	spec := querySpec{
+		Level:    r.URL.Query().Get("level"),
+		MinLevel: r.URL.Query().Get("min_level"),
+		Search:   r.URL.Query().Get("search"),
+		Since:    r.URL.Query().Get("since"),
+		After:    r.URL.Query().Get("after"),
+		Before:   r.URL.Query().Get("before"),
+		Q:        r.URL.Query().Get("q"),
+	}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
 		n, err := strconv.Atoi(limitStr)
-		if err != nil || n < 0 {
+		if err != nil {
 			http.Error(w, "invalid limit", http.StatusBadRequest)
 			return
 		}
-		limit = n
+		spec.Limit = &n
+	}
+
+	filters, err := spec.filters(s.queryOpts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, clamped := s.effectiveLimit(spec.Limit)
+	if clamped {
+		w.Header().Set("X-Limit-Clamped", strconv.Itoa(limit))
 	}
 
 	s.mu.RLock()
@@ -158,23 +400,96 @@ func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 		Index:    baseIndex,
 	})
 
+	s.totalQueries.Add(1)
+	s.totalFiltered.Add(int64(metrics.LogsFilteredOut))
+
 	s.mu.Lock()
 	s.lastMetric = metrics
 	s.hasMetric = true
 	s.mu.Unlock()
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
+	writeJSONWithETag(w, r, map[string]interface{}{
 		"count": len(results),
 		"logs":  results,
 	})
 }
 
+func (s *Server) handleQueryBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var specs []querySpec
+	if err := json.NewDecoder(r.Body).Decode(&specs); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	filters := make([]query.Filters, 0, len(specs))
+	for i, spec := range specs {
+		f, err := spec.filters(s.queryOpts)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("query %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		filters = append(filters, f)
+	}
+
+	// One read of the shared state so every query sees the same data version.
+	s.mu.RLock()
+	entries := s.entries
+	stats := s.loadStats
+	useIndex := s.useIndex
+	baseIndex := s.baseIndex
+	s.mu.RUnlock()
+
+	if useIndex && baseIndex == nil && len(specs) > 1 {
+		baseIndex = index.Build(entries)
+	}
+
+	results := make([]map[string]interface{}, 0, len(specs))
+	var last engine.Metrics
+	for i, f := range filters {
+		limit, clamped := s.effectiveLimit(specs[i].Limit)
+		if clamped {
+			w.Header().Set("X-Limit-Clamped", strconv.Itoa(limit))
+		}
+		logs, metrics := engine.QueryEntries(entries, stats, engine.QueryOptions{
+			Filters:  f,
+			UseIndex: useIndex,
+			Limit:    limit,
+			Index:    baseIndex,
+		})
+		s.totalQueries.Add(1)
+		s.totalFiltered.Add(int64(metrics.LogsFilteredOut))
+		last = metrics
+		results = append(results, map[string]interface{}{
+			"count": len(logs),
+			"logs":  logs,
+		})
+	}
+
+	if len(specs) > 0 {
+		s.mu.Lock()
+		s.lastMetric = last
+		s.hasMetric = true
+		s.mu.Unlock()
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"count":   len(results),
+		"results": results,
+	})
+}
+
 func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	s.mu.RLock()
 	metrics := s.lastMetric
 	hasMetric := s.hasMetric
 	stats := s.loadStats
 	useIndex := s.useIndex
+	memoryEntries := len(s.entries)
+	evicted := s.evicted
 	s.mu.RUnlock()
 
 	if !hasMetric {
@@ -186,10 +501,147 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 			LogsFilteredOut: 0,
 			LogsReturned:    stats.LogsIngested,
 			IndexEnabled:    useIndex,
+			Truncated:       stats.Truncated,
+			SourceCounts:    stats.SourceCounts,
 		}
 	}
 
-	writeJSON(w, http.StatusOK, metricsToMap(metrics))
+	out := MetricsToMap(metrics)
+	out["metrics.total_queries"] = s.totalQueries.Load()
+	out["metrics.total_filtered"] = s.totalFiltered.Load()
+	out["metrics.total_bytes_served"] = s.bytesServed.Load()
+	out["metrics.memory_entries"] = memoryEntries
+	out["metrics.max_memory_entries"] = s.maxEntries
+	out["metrics.evicted_entries"] = evicted
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleIndexStats(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	entries := s.entries
+	idx := s.baseIndex
+	useIndex := s.useIndex
+	s.mu.RUnlock()
+
+	if idx == nil {
+		idx = index.Build(entries)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"index_enabled": useIndex,
+		"stats":         idx.Stats(),
+	})
+}
+
+func (s *Server) handleAggregate(w http.ResponseWriter, r *http.Request) {
+	spec := querySpec{
+		Level:    r.URL.Query().Get("level"),
+		MinLevel: r.URL.Query().Get("min_level"),
+		Search:   r.URL.Query().Get("search"),
+		Since:    r.URL.Query().Get("since"),
+		After:    r.URL.Query().Get("after"),
+		Before:   r.URL.Query().Get("before"),
+		Q:        r.URL.Query().Get("q"),
+	}
+	filters, err := spec.filters(s.queryOpts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bucket := time.Hour
+	if v := r.URL.Query().Get("bucket"); v != "" {
+		d, err := parseFlexibleDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid bucket duration", http.StatusBadRequest)
+			return
+		}
+		bucket = d
+	}
+
+	s.mu.RLock()
+	entries := s.entries
+	s.mu.RUnlock()
+
+	buckets, err := engine.Aggregate(entries, filters, bucket)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSONWithETag(w, r, map[string]interface{}{
+		"bucket":  bucket.String(),
+		"buckets": buckets,
+	})
+}
+
+// handleEntries returns a window of the matching entries by position in their
+// time order, for virtualized scrolling. Entries with equal timestamps keep
+// ingest order, so positions stay stable while new entries are only appended
+// later in time.
+func (s *Server) handleEntries(w http.ResponseWriter, r *http.Request) {
+	spec := querySpec{
+		Level:    r.URL.Query().Get("level"),
+		MinLevel: r.URL.Query().Get("min_level"),
+		Search:   r.URL.Query().Get("search"),
+		Since:    r.URL.Query().Get("since"),
+		After:    r.URL.Query().Get("after"),
+		Before:   r.URL.Query().Get("before"),
+		Q:        r.URL.Query().Get("q"),
+	}
+	filters, err := spec.filters(s.queryOpts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from := 0
+	if v := r.URL.Query().Get("from"); v != "" {
+		from, err = strconv.Atoi(v)
+		if err != nil || from < 0 {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+	}
+	var requested *int
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid count", http.StatusBadRequest)
+			return
+		}
+		requested = &n
+	}
+	count, clamped := s.effectiveLimit(requested)
+	if clamped {
+		w.Header().Set("X-Limit-Clamped", strconv.Itoa(count))
+	}
+
+	s.mu.RLock()
+	entries := s.entries
+	stats := s.loadStats
+	s.mu.RUnlock()
+
+	// A scan (not the index) keeps matches in ingest order for the stable sort.
+	matched, metrics := engine.QueryEntries(entries, stats, engine.QueryOptions{Filters: filters})
+	ordered := make([]types.LogEntry, len(matched))
+	copy(ordered, matched)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Timestamp.Before(ordered[j].Timestamp)
+	})
+	s.totalQueries.Add(1)
+	s.totalFiltered.Add(int64(metrics.LogsFilteredOut))
+
+	window := []types.LogEntry{}
+	if from < len(ordered) {
+		end := len(ordered)
+		if count > 0 && from+count < end {
+			end = from + count
+		}
+		window = ordered[from:end]
+	}
+	writeJSONWithETag(w, r, map[string]interface{}{
+		"from":  from,
+		"count": len(window),
+		"total": len(ordered),
+		"logs":  window,
+	})
 }
 
 func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
@@ -197,11 +649,9 @@ func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if s.apiKey != "" {
-		if r.Header.Get("X-API-Key") != s.apiKey {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
 	}
 
 	var payload ingestPayload
@@ -232,17 +682,22 @@ func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	key := r.Header.Get("Idempotency-Key")
 	s.mu.Lock()
-	combined, stats, err := engine.IngestEntries(s.entries, entries, s.storePath, s.shardDir, "")
-	if err != nil {
+	if ingested, ok := s.idem.get(key); ok {
+		s.mu.Unlock()
+		w.Header().Set("Idempotent-Replayed", "true")
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"ingested": ingested,
+		})
+		return
+	}
+	if err := s.ingestLocked(entries); err != nil {
 		s.mu.Unlock()
 		http.Error(w, "failed to ingest", http.StatusInternalServerError)
 		return
 	}
-	s.entries = combined
-	s.loadStats.LogsRead += stats.LogsIngested
-	s.loadStats.LogsIngested += stats.LogsIngested
-	s.baseIndex = nil
+	s.idem.put(key, len(entries))
 	s.mu.Unlock()
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
@@ -250,16 +705,62 @@ func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// idempotencyCache remembers the result of recent /ingest requests by
+// Idempotency-Key, evicting the least recently used key once full. Callers hold s.mu.
+type idempotencyCache struct {
+	capacity int
+	order    *list.List // front = most recently used
+	items    map[string]*list.Element
+}
+
+type idempotencyItem struct {
+	key      string
+	ingested int
+}
+
+func newIdempotencyCache(capacity int) *idempotencyCache {
+	if capacity <= 0 {
+		capacity = DefaultIdempotencyKeys
+	}
+	return &idempotencyCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *idempotencyCache) get(key string) (int, bool) {
+	if key == "" {
+		return 0, false
+	}
+	el, ok := c.items[key]
+	if !ok {
+		return 0, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(idempotencyItem).ingested, true
+}
+
+func (c *idempotencyCache) put(key string, ingested int) {
+	if key == "" {
+		return
+	}
+	c.items[key] = c.order.PushFront(idempotencyItem{key: key, ingested: ingested})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(idempotencyItem).key)
+	}
+}
+
 func (s *Server) handleIngestFile(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if s.apiKey != "" {
-		if r.Header.Get("X-API-Key") != s.apiKey {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
 	}
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
@@ -295,10 +796,15 @@ func (s *Server) handleIngestFile(w http.ResponseWriter, r *http.Request) {
 
 	s.mu.Lock()
 	if strings.EqualFold(mode, "replace") {
+		if s.utc {
+			ingest.NormalizeUTC(entries)
+		}
+		s.stampLocked(entries)
 		s.entries = entries
 		s.loadStats.LogsRead = len(entries)
 		s.loadStats.LogsIngested = len(entries)
 		s.baseIndex = nil
+		s.evictLocked()
 		s.mu.Unlock()
 		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"ingested": len(entries),
@@ -306,31 +812,297 @@ func (s *Server) handleIngestFile(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	combined, stats, err := engine.IngestEntries(s.entries, entries, s.storePath, s.shardDir, "")
-	if err != nil {
+	if err := s.ingestLocked(entries); err != nil {
 		s.mu.Unlock()
 		http.Error(w, "failed to ingest", http.StatusInternalServerError)
 		return
 	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ingested": len(entries),
+		"mode":     "append",
+	})
+}
+
+// stampLocked applies Options.StampIngest to entries about to be ingested.
+func (s *Server) stampLocked(entries []types.LogEntry) {
+	if !s.stampIngest {
+		return
+	}
+	now := time.Now()
+	if s.utc {
+		now = now.UTC()
+	}
+	ingest.StampIngested(entries, now)
+}
+
+// effectiveLimit applies the server's default when the client sent no limit and
+// clamps to maxLimit, where an explicit 0 ("no limit") is only honored without a cap.
+// clamped reports that the client's explicit request was reduced.
+func (s *Server) effectiveLimit(requested *int) (limit int, clamped bool) {
+	if requested == nil {
+		limit = s.defaultLimit
+	} else {
+		limit = *requested
+	}
+	if s.maxLimit > 0 && (limit == 0 || limit > s.maxLimit) {
+		return s.maxLimit, requested != nil
+	}
+	return limit, false
+}
+
+// ingestLocked persists entries and appends them in memory. Callers hold s.mu.
+func (s *Server) ingestLocked(entries []types.LogEntry) error {
+	if s.utc {
+		ingest.NormalizeUTC(entries)
+	}
+	s.stampLocked(entries)
+	combined, stats, err := engine.IngestEntries(s.entries, entries, s.backend, s.shardDir, "", s.shards)
+	if err != nil {
+		return err
+	}
 	s.entries = combined
 	s.loadStats.LogsRead += stats.LogsIngested
 	s.loadStats.LogsIngested += stats.LogsIngested
 	s.baseIndex = nil
-	s.mu.Unlock()
+	s.evictLocked()
+	return nil
+}
+
+// ndjsonBatchSize is how many NDJSON entries are ingested per lock acquisition.
+const ndjsonBatchSize = 1000
+
+// handleIngestNDJSON ingests one entry object per line, in batches, so large
+// uploads are never held in memory at once. Lines that fail to decode or lack
+// fields are counted and skipped. If a batch fails to ingest, the earlier
+// batches are kept and the 500 response carries resume_from, the 1-based line
+// to resend from, so a retry does not ingest them twice.
+func (s *Server) handleIngestNDJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ingested, parseErrors := 0, 0
+	lineNo, resumeFrom := 0, 1
+	batch := make([]types.LogEntry, 0, ndjsonBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		s.mu.Lock()
+		err := s.ingestLocked(batch)
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		ingested += len(batch)
+		resumeFrom = lineNo + 1
+		batch = make([]types.LogEntry, 0, ndjsonBatchSize)
+		return nil
+	}
+	failed := func(err error) {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+			"ingested":    ingested,
+			"errors":      parseErrors,
+			"resume_from": resumeFrom,
+			"error":       fmt.Sprintf("failed to ingest: %v", err),
+		})
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var item ingestEntry
+		if err := json.Unmarshal(line, &item); err != nil {
+			parseErrors++
+			continue
+		}
+		entry, err := item.toEntry()
+		if err != nil {
+			parseErrors++
+			continue
+		}
+		batch = append(batch, entry)
+		if len(batch) == ndjsonBatchSize {
+			if err := flush(); err != nil {
+				failed(err)
+				return
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		failed(err)
+		return
+	}
+	if err := scanner.Err(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"ingested":    ingested,
+			"errors":      parseErrors,
+			"resume_from": resumeFrom,
+			"error":       err.Error(),
+		})
+		return
+	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"ingested": len(entries),
-		"mode":     "append",
+		"ingested": ingested,
+		"errors":   parseErrors,
+	})
+}
+
+// countBytes wraps a handler and adds response body sizes to bytesServed.
+func (s *Server) countBytes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &countingWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		s.bytesServed.Add(cw.n)
 	})
 }
 
-func metricsToMap(m engine.Metrics) map[string]interface{} {
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// authorized reports whether the request carries the configured API key.
+// Both keys are hashed first so the comparison does not leak their lengths.
+func (s *Server) authorized(r *http.Request) bool {
+	if s.apiKey == "" {
+		return true
+	}
+	got := sha256.Sum256([]byte(r.Header.Get("X-API-Key")))
+	want := sha256.Sum256([]byte(s.apiKey))
+	return subtle.ConstantTimeCompare(got[:], want[:]) == 1
+}
+
+func (s *Server) handleRaw(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if s.storePath == "" {
+		http.Error(w, "no store configured", http.StatusNotFound)
+		return
+	}
+
+	from, err := parseLineParam(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	to, err := parseLineParam(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+	if to > 0 && from > to {
+		http.Error(w, "invalid line range", http.StatusBadRequest)
+		return
+	}
+
+	// Ingest appends whole lines under the write lock, so the size read under
+	// the read lock ends on a line boundary. Stream up to it without the lock,
+	// so a slow client doesn't hold up ingest; later appends are left out.
+	f, size, err := s.openStoreSnapshot()
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "store not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to open store", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	// If the server starts draining mid-copy, the response ends after a whole
+	// line and this trailer gives the from= value to resume with.
+	w.Header().Set("Trailer", "X-Resume-From")
+
+	reader := bufio.NewReader(io.LimitReader(f, size))
+	lineNo := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lineNo++
+			if lineNo >= from && (to == 0 || lineNo <= to) {
+				if s.draining() {
+					w.Header().Set("X-Resume-From", strconv.Itoa(lineNo))
+					return
+				}
+				if _, werr := w.Write(line); werr != nil {
+					return
+				}
+			}
+			if to > 0 && lineNo >= to {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// openStoreSnapshot opens the store and returns its size at a moment when no
+// ingest append is in progress.
+func (s *Server) openStoreSnapshot() (*os.File, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, err := os.Open(s.storePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// parseLineParam parses a 1-based line number; empty means unset (0).
+func parseLineParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid line number")
+	}
+	return n, nil
+}
+
+// MetricsToMap returns query metrics keyed by the names used in /metrics, so the
+// CLI's --metrics-json output matches the server.
+func MetricsToMap(m engine.Metrics) map[string]interface{} {
 	rate, ok := m.RatePerSec()
 	rateText := "NA"
 	if ok {
 		rateText = formatRate(rate)
 	}
-	return map[string]interface{}{
+	out := map[string]interface{}{
 		"metrics.started_at":        m.StartedAt.UTC().Format(time.RFC3339),
 		"metrics.finished_at":       m.FinishedAt.UTC().Format(time.RFC3339),
 		"metrics.duration_ms":       m.Duration().Milliseconds(),
@@ -340,7 +1112,24 @@ func metricsToMap(m engine.Metrics) map[string]interface{} {
 		"metrics.logs_returned":     m.LogsReturned,
 		"metrics.rate_per_sec":      rateText,
 		"metrics.index_enabled":     m.IndexEnabled,
+		"metrics.truncated":         m.Truncated,
+		"metrics.early_terminated":  m.EarlyTerminated,
+		"metrics.shards_skipped":    m.ShardsSkipped,
+	}
+	for src, n := range m.SourceCounts {
+		out["metrics.source."+src] = n
+	}
+	if b := m.Baseline; b != nil {
+		out["metrics.anomaly"] = b.Anomaly
+		out["metrics.baseline_runs"] = b.Runs
+		for _, d := range b.Deltas {
+			prefix := "metrics.baseline." + d.Level
+			out[prefix+".count"] = d.Count
+			out[prefix+".mean"] = formatRate(d.Mean)
+			out[prefix+".z"] = formatRate(d.Z)
+		}
 	}
+	return out
 }
 
 func formatRate(val float64) string {
@@ -353,26 +1142,121 @@ func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
 	_ = json.NewEncoder(w).Encode(payload)
 }
 
+// writeJSONWithETag writes payload with an ETag derived from its encoding and
+// answers 304 Not Modified when the client already holds that version.
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(append(data, '\n'))
+}
+
+func etagMatches(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
 func webDir() string {
 	return filepath.Join("web")
 }
 
+// querySpec holds the query parameters accepted by /query and /query/batch.
+type querySpec struct {
+	Level    string `json:"level"`
+	MinLevel string `json:"min_level"`
+	Search   string `json:"search"`
+	Since    string `json:"since"`
+	After    string `json:"after"`
+	Before   string `json:"before"`
+	Limit    *int   `json:"limit"` // nil = server default
+	Q        string `json:"q"`
+}
+
+// filters builds the request's filters with the server's matching options.
+func (q querySpec) filters(opts query.Options) (query.Filters, error) {
+	var cutoff time.Time
+	if q.Since != "" {
+		d, err := parseFlexibleDuration(q.Since)
+		if err != nil {
+			return query.Filters{}, fmt.Errorf("invalid since duration")
+		}
+		cutoff = time.Now().Add(-d)
+	}
+
+	filters := query.BuildFilters(q.Level, cutoff, q.Search)
+	if q.MinLevel != "" {
+		if err := query.CheckLevel(q.MinLevel); err != nil {
+			return query.Filters{}, fmt.Errorf("invalid min_level")
+		}
+	}
+	filters.MinLevel = q.MinLevel
+	if q.After != "" {
+		tm, err := time.Parse(time.RFC3339, q.After)
+		if err != nil {
+			return query.Filters{}, fmt.Errorf("invalid after timestamp")
+		}
+		filters.After = tm
+	}
+	if q.Before != "" {
+		tm, err := time.Parse(time.RFC3339, q.Before)
+		if err != nil {
+			return query.Filters{}, fmt.Errorf("invalid before timestamp")
+		}
+		filters.Before = tm
+	}
+	if q.Q != "" {
+		parsed, err := query.Parse(q.Q)
+		if err != nil {
+			return query.Filters{}, fmt.Errorf("invalid query")
+		}
+		merged, err := query.MergeFilters(filters, parsed)
+		if err != nil {
+			return query.Filters{}, fmt.Errorf("conflicting query filters")
+		}
+		filters = merged
+	}
+	if q.Limit != nil && *q.Limit < 0 {
+		return query.Filters{}, fmt.Errorf("invalid limit")
+	}
+	return filters.WithOptions(opts), nil
+}
+
 type ingestPayload struct {
 	Entry   *ingestEntry   `json:"entry"`
 	Entries []ingestEntry  `json:"entries"`
 }
 
 type ingestEntry struct {
-	Timestamp string `json:"timestamp"`
-	Level     string `json:"level"`
-	Message   string `json:"message"`
+	Timestamp string            `json:"timestamp"`
+	Level     string            `json:"level"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields"`
 }
 
 func (e ingestEntry) toEntry() (types.LogEntry, error) {
 	if e.Timestamp == "" || e.Level == "" || e.Message == "" {
 		return types.LogEntry{}, fmt.Errorf("missing fields")
 	}
-	t, err := time.Parse(time.RFC3339, e.Timestamp)
+	t, err := ingest.ParseTimestamp(e.Timestamp)
 	if err != nil {
 		return types.LogEntry{}, err
 	}
@@ -380,6 +1264,7 @@ func (e ingestEntry) toEntry() (types.LogEntry, error) {
 		Timestamp: t,
 		Level:     e.Level,
 		Message:   e.Message,
+		Fields:    e.Fields,
 	}, nil
 }
 
@@ -391,6 +1276,8 @@ func parseFormat(value string) (ingest.Format, error) {
 		return ingest.FormatJSON, nil
 	case "logfmt":
 		return ingest.FormatLogfmt, nil
+	case "glog", "klog":
+		return ingest.FormatGlog, nil
 	case "auto":
 		return ingest.FormatAuto, nil
 	default:
@@ -0,0 +1,575 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/engine"
+	"github.com/armash/log-pipeline/internal/store"
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+func testEntries() []types.LogEntry {
+	base := time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC)
+	return []types.LogEntry{
+		{Timestamp: base, Level: "INFO", Message: "service started"},
+		{Timestamp: base.Add(time.Second), Level: "ERROR", Message: "auth failed"},
+		{Timestamp: base.Add(2 * time.Second), Level: "WARN", Message: "slow response"},
+	}
+}
+
+func TestConcurrentQueryCounters(t *testing.T) {
+	entries := testEntries()
+	s := New(entries, engine.LoadStats{LogsRead: len(entries), LogsIngested: len(entries)}, nil, Options{})
+	h := s.Handler()
+
+	const workers = 8
+	const perWorker = 25
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/query?level=ERROR", nil))
+				if rec.Code != http.StatusOK {
+					t.Errorf("query status = %d, want %d", rec.Code, http.StatusOK)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var got map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("metrics decode error = %v", err)
+	}
+
+	total := workers * perWorker
+	if got["metrics.total_queries"] != float64(total) {
+		t.Errorf("total_queries = %v, want %d", got["metrics.total_queries"], total)
+	}
+	if got["metrics.total_filtered"] != float64(total*2) {
+		t.Errorf("total_filtered = %v, want %d", got["metrics.total_filtered"], total*2)
+	}
+	if served, _ := got["metrics.total_bytes_served"].(float64); served <= 0 {
+		t.Errorf("total_bytes_served = %v, want > 0", got["metrics.total_bytes_served"])
+	}
+}
+
+func TestQueryETag(t *testing.T) {
+	entries := testEntries()
+	s := New(entries, engine.LoadStats{LogsRead: len(entries), LogsIngested: len(entries)}, nil, Options{})
+	h := s.Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/query?level=ERROR", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("query status = %d etag = %q, want 200 with ETag", rec.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/query?level=ERROR", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional query status = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/query?level=WARN", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("different query status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestQueryBatch(t *testing.T) {
+	entries := testEntries()
+	s := New(entries, engine.LoadStats{LogsRead: len(entries), LogsIngested: len(entries)}, nil, Options{UseIndex: true})
+	h := s.Handler()
+
+	body := strings.NewReader(`[{"level":"ERROR"},{"min_level":"WARN"},{"q":"message~service"}]`)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/query/batch", body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var got struct {
+		Results []struct {
+			Count int `json:"count"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("batch decode error = %v", err)
+	}
+	want := []int{1, 2, 1}
+	if len(got.Results) != len(want) {
+		t.Fatalf("batch returned %d results, want %d", len(got.Results), len(want))
+	}
+	for i, w := range want {
+		if got.Results[i].Count != w {
+			t.Errorf("result %d count = %d, want %d", i, got.Results[i].Count, w)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/query/batch", strings.NewReader(`[{"since":"bogus"}]`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid batch status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestIngestEviction(t *testing.T) {
+	entries := testEntries()
+	s := New(entries, engine.LoadStats{LogsRead: len(entries), LogsIngested: len(entries)}, nil, Options{MaxEntries: 3})
+	h := s.Handler()
+
+	body := strings.NewReader(`{"entries":[{"timestamp":"2026-02-08T10:00:05Z","level":"ERROR","message":"newest"}]}`)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ingest", body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ingest status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/query", nil))
+	var got struct {
+		Count int              `json:"count"`
+		Logs  []types.LogEntry `json:"logs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("query decode error = %v", err)
+	}
+	if got.Count != 3 || got.Logs[0].Message != "auth failed" || got.Logs[2].Message != "newest" {
+		t.Errorf("query after eviction = %+v, want oldest entry evicted", got.Logs)
+	}
+}
+
+func TestReadyzWritability(t *testing.T) {
+	dir := t.TempDir()
+	s := New(nil, engine.LoadStats{}, nil, Options{StorePath: filepath.Join(dir, "store.jsonl"), ShardDir: filepath.Join(dir, "shards")})
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("readyz status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if created, _ := os.ReadDir(dir); len(created) != 0 {
+		t.Errorf("readyz created %d entries in %s, want none", len(created), dir)
+	}
+
+	blocker := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	s = New(nil, engine.LoadStats{}, nil, Options{ShardDir: filepath.Join(blocker, "shards")})
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "not writable") {
+		t.Errorf("readyz status = %d body = %s, want 503 with reason", rec.Code, rec.Body.String())
+	}
+}
+
+// failAfterStore accepts a number of appends, then fails every later one.
+type failAfterStore struct {
+	store.Store
+	left int
+}
+
+func (f *failAfterStore) Append(entries []types.LogEntry) error {
+	if f.left == 0 {
+		return errors.New("disk full")
+	}
+	f.left--
+	return nil
+}
+
+func TestIngestNDJSONResumeFrom(t *testing.T) {
+	s := New(nil, engine.LoadStats{}, nil, Options{})
+	s.backend = &failAfterStore{left: 1}
+	lines := make([]string, 0, ndjsonBatchSize+10)
+	for i := 0; i < ndjsonBatchSize+10; i++ {
+		lines = append(lines, fmt.Sprintf(`{"timestamp":"2026-02-08T10:00:00Z","level":"INFO","message":"m%d"}`, i))
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ingest/ndjson", strings.NewReader(strings.Join(lines, "\n"))))
+
+	var got struct {
+		Ingested   int `json:"ingested"`
+		ResumeFrom int `json:"resume_from"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v (%s)", err, rec.Body.String())
+	}
+	if rec.Code != http.StatusInternalServerError || got.Ingested != ndjsonBatchSize || got.ResumeFrom != ndjsonBatchSize+1 {
+		t.Errorf("ndjson = %d %+v, want 500 with the first batch ingested and resume_from %d", rec.Code, got, ndjsonBatchSize+1)
+	}
+}
+
+func TestIndexStats(t *testing.T) {
+	s := New(testEntries(), engine.LoadStats{}, nil, Options{})
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/index/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("index stats status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var resp struct {
+		Stats struct {
+			Levels      map[string]int `json:"levels"`
+			HourBuckets int            `json:"hourBuckets"`
+		} `json:"stats"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	total := 0
+	for _, n := range resp.Stats.Levels {
+		total += n
+	}
+	if total != len(testEntries()) || resp.Stats.HourBuckets == 0 {
+		t.Errorf("index stats = %+v, want %d entries across levels", resp.Stats, len(testEntries()))
+	}
+}
+
+func TestIngestIdempotencyKey(t *testing.T) {
+	s := New(nil, engine.LoadStats{}, nil, Options{IdempotencyKeys: 1})
+	h := s.Handler()
+	post := func(key string) *httptest.ResponseRecorder {
+		body := strings.NewReader(`{"entry":{"timestamp":"2026-02-08T10:00:05Z","level":"INFO","message":"hello"}}`)
+		req := httptest.NewRequest(http.MethodPost, "/ingest", body)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("ingest status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		return rec
+	}
+
+	post("a")
+	if rec := post("a"); rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry with same key was not replayed")
+	}
+	post("b") // evicts "a"
+	post("a")
+	post("")
+	post("")
+	if got := len(s.entries); got != 5 {
+		t.Errorf("entries after ingest = %d, want 5", got)
+	}
+}
+
+func TestUIBasePath(t *testing.T) {
+	base, err := NormalizeUIBasePath("logs")
+	if err != nil || base != "/logs/" {
+		t.Fatalf("NormalizeUIBasePath(logs) = %q, %v; want /logs/", base, err)
+	}
+	if _, err := NormalizeUIBasePath("/"); err == nil {
+		t.Errorf("NormalizeUIBasePath(/) error = nil, want error")
+	}
+
+	h := New(nil, engine.LoadStats{}, nil, Options{UIBasePath: base}).Handler()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/logs/" {
+		t.Errorf("GET / = %d Location %q, want redirect to /logs/", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /ui/ = %d, want %d once the UI moved", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestIngestNDJSON(t *testing.T) {
+	s := New(nil, engine.LoadStats{}, nil, Options{APIKey: "secret"})
+	h := s.Handler()
+	body := strings.Join([]string{
+		`{"timestamp":"2026-02-08T10:00:00Z","level":"INFO","message":"one"}`,
+		`not json`,
+		``,
+		`{"timestamp":"2026-02-08T10:00:01Z","level":"WARN"}`,
+		`{"timestamp":"2026-02-08T10:00:02Z","level":"ERROR","message":"two"}`,
+	}, "\n")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ingest/ndjson", strings.NewReader(body)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("ndjson without key = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/ingest/ndjson", strings.NewReader(body))
+	req.Header.Set("X-API-Key", "secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var got struct {
+		Ingested int `json:"ingested"`
+		Errors   int `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if rec.Code != http.StatusOK || got.Ingested != 2 || got.Errors != 2 {
+		t.Errorf("ndjson = %d %+v, want 200 with 2 ingested and 2 errors", rec.Code, got)
+	}
+	if len(s.entries) != 2 {
+		t.Errorf("entries after ndjson ingest = %d, want 2", len(s.entries))
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	entries := testEntries()
+	h := New(entries, engine.LoadStats{}, nil, Options{DefaultLimit: 1, MaxLimit: 2}).Handler()
+	tests := []struct {
+		url       string
+		wantCount int
+		wantClamp string
+	}{
+		{"/query", 1, ""},
+		{"/query?limit=2", 2, ""},
+		{"/query?limit=50", 2, "2"},
+		{"/query?limit=0", 2, "2"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+		var got struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: decode: %v", tt.url, err)
+		}
+		if got.Count != tt.wantCount || rec.Header().Get("X-Limit-Clamped") != tt.wantClamp {
+			t.Errorf("%s: count = %d clamp = %q, want %d and %q", tt.url, got.Count, rec.Header().Get("X-Limit-Clamped"), tt.wantCount, tt.wantClamp)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h = New(entries, engine.LoadStats{}, nil, Options{}).Handler()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/query?limit=0", nil))
+	if !strings.Contains(rec.Body.String(), fmt.Sprintf(`"count":%d`, len(entries))) {
+		t.Errorf("limit=0 without a cap should return everything: %s", rec.Body.String())
+	}
+}
+
+func TestStartUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "lp.sock")
+	// A leftover socket from a previous run must not block startup.
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- New(testEntries(), engine.LoadStats{}, nil, Options{}).Start(ctx, "unix:"+sock) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get("http://unix/health"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET /health over unix socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("health status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("socket file still present after shutdown (stat err = %v)", err)
+	}
+}
+
+func TestMaxIOConcurrency(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	if err := os.WriteFile(path, []byte("{\"timestamp\":\"2026-02-08T10:00:00Z\",\"level\":\"INFO\",\"message\":\"a\"}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := New(nil, engine.LoadStats{}, nil, Options{StorePath: path, MaxIOConcurrency: 1})
+	h := s.Handler()
+	get := func(target string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Code
+	}
+	if code := get("/raw"); code != http.StatusOK {
+		t.Fatalf("raw status = %d, want %d", code, http.StatusOK)
+	}
+
+	s.ioSem <- struct{}{} // a read in flight
+	if code := get("/raw"); code != http.StatusServiceUnavailable {
+		t.Errorf("raw status while saturated = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if code := get("/health"); code != http.StatusOK {
+		t.Errorf("health status while saturated = %d, want %d", code, http.StatusOK)
+	}
+	<-s.ioSem
+	if code := get("/raw"); code != http.StatusOK {
+		t.Errorf("raw status after release = %d, want %d", code, http.StatusOK)
+	}
+}
+
+// drainAfterWrite starts the server drain once the first line is written.
+type drainAfterWrite struct {
+	*httptest.ResponseRecorder
+	s *Server
+}
+
+func (d drainAfterWrite) Write(p []byte) (int, error) {
+	n, err := d.ResponseRecorder.Write(p)
+	d.s.drain()
+	return n, err
+}
+
+func TestRawDrain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	var lines strings.Builder
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&lines, "{\"timestamp\":\"2026-02-08T10:00:0%dZ\",\"level\":\"INFO\",\"message\":\"m%d\"}\n", i, i)
+	}
+	if err := os.WriteFile(path, []byte(lines.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := New(nil, engine.LoadStats{}, nil, Options{StorePath: path})
+	rec := drainAfterWrite{ResponseRecorder: httptest.NewRecorder(), s: s}
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/raw?from=2", nil))
+
+	res := rec.Result()
+	if got := strings.Count(rec.Body.String(), "\n"); got != 1 {
+		t.Fatalf("raw wrote %d lines after drain, want 1", got)
+	}
+	if got := res.Trailer.Get("X-Resume-From"); got != "3" {
+		t.Errorf("X-Resume-From = %q, want 3", got)
+	}
+
+	ready := httptest.NewRecorder()
+	s.Handler().ServeHTTP(ready, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if ready.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz while draining = %d, want %d", ready.Code, http.StatusServiceUnavailable)
+	}
+}
+
+// blockingWriter signals its first write and then blocks until release closes,
+// like a client that stopped reading.
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	started chan struct{}
+	release chan struct{}
+	once    *sync.Once
+}
+
+func (b blockingWriter) Write(p []byte) (int, error) {
+	b.once.Do(func() { close(b.started) })
+	<-b.release
+	return b.ResponseRecorder.Write(p)
+}
+
+func TestRawDoesNotBlockIngest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	line := `{"timestamp":"2026-02-08T10:00:00Z","level":"INFO","message":"stored"}` + "\n"
+	if err := os.WriteFile(path, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := New(nil, engine.LoadStats{}, nil, Options{StorePath: path})
+	h := s.Handler()
+
+	rec := blockingWriter{ResponseRecorder: httptest.NewRecorder(), started: make(chan struct{}), release: make(chan struct{}), once: &sync.Once{}}
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/raw", nil))
+		close(done)
+	}()
+	<-rec.started
+
+	ingested := make(chan int, 1)
+	go func() {
+		body := `{"entry":{"timestamp":"2026-02-08T10:00:01Z","level":"WARN","message":"while streaming"}}`
+		ing := httptest.NewRecorder()
+		h.ServeHTTP(ing, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body)))
+		ingested <- ing.Code
+	}()
+	select {
+	case code := <-ingested:
+		if code != http.StatusOK {
+			t.Errorf("ingest status = %d, want %d", code, http.StatusOK)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ingest blocked behind a stalled /raw reader")
+	}
+	close(rec.release)
+	<-done
+	if got := rec.Body.String(); got != line {
+		t.Errorf("raw body = %q, want only the lines stored before the request", got)
+	}
+}
+
+func TestEntriesWindow(t *testing.T) {
+	// Out of time order on purpose; positions follow timestamps.
+	entries := testEntries()
+	entries[0], entries[2] = entries[2], entries[0]
+	h := New(entries, engine.LoadStats{}, nil, Options{}).Handler()
+
+	get := func(url string) (int, []types.LogEntry, int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		var got struct {
+			Total int              `json:"total"`
+			Logs  []types.LogEntry `json:"logs"`
+		}
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%s: decode: %v", url, err)
+			}
+		}
+		return rec.Code, got.Logs, got.Total
+	}
+
+	code, logs, total := get("/entries?from=1&count=1")
+	if code != http.StatusOK || total != 3 || len(logs) != 1 || logs[0].Message != "auth failed" {
+		t.Errorf("from=1 count=1: code %d total %d logs %+v", code, total, logs)
+	}
+	if _, logs, total := get("/entries?min_level=WARN&from=1"); total != 2 || len(logs) != 1 || logs[0].Message != "slow response" {
+		t.Errorf("filtered window: total %d logs %+v", total, logs)
+	}
+	if code, logs, _ := get("/entries?from=10"); code != http.StatusOK || len(logs) != 0 {
+		t.Errorf("past the end: code %d logs %+v", code, logs)
+	}
+	if code, _, _ := get("/entries?from=-1"); code != http.StatusBadRequest {
+		t.Errorf("from=-1: code %d, want 400", code)
+	}
+}
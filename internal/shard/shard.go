@@ -1,18 +1,26 @@
 package shard
 
 import (
-	"fmt"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/armash/log-pipeline/internal/objstore"
 	"github.com/armash/log-pipeline/internal/types"
 )
 
+// FileName returns the shard file name for a YYYY-MM-DD day, gzip-compressed
+// (.jsonl.gz) or plain. Readers accept both forms, so a directory may mix them.
+func FileName(day string, compressed bool) string {
+	if compressed {
+		return day + ".jsonl.gz"
+	}
+	return day + ".jsonl"
+}
+
 func DayShardPath(baseDir string, t time.Time) string {
-	name := t.UTC().Format("2006-01-02") + ".jsonl"
-	return filepath.Join(baseDir, name)
+	return filepath.Join(baseDir, FileName(t.UTC().Format("2006-01-02"), false))
 }
 
 func GroupByDay(entries []types.LogEntry) map[string][]types.LogEntry {
@@ -57,25 +65,101 @@ func SortEntries(entries []types.LogEntry) {
 	})
 }
 
+func SortEntriesDesc(entries []types.LogEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.After(entries[j].Timestamp)
+	})
+}
+
 func ShardPathsForRange(baseDir string, after time.Time, before time.Time) []string {
 	days := DaysInRange(after, before)
 	if len(days) == 0 {
 		return nil
 	}
-	paths := make([]string, 0, len(days))
+	if objstore.IsURL(baseDir) {
+		return remoteShardPathsForDays(baseDir, days)
+	}
+	// Both forms are listed; readers skip the one that doesn't exist.
+	paths := make([]string, 0, 2*len(days))
 	for _, day := range days {
-		paths = append(paths, filepath.Join(baseDir, fmt.Sprintf("%s.jsonl", day)))
+		paths = append(paths,
+			filepath.Join(baseDir, FileName(day, false)),
+			filepath.Join(baseDir, FileName(day, true)))
+	}
+	return paths
+}
+
+// remoteShardPathsForDays lists the prefix once and keeps the shards for days,
+// so days without a shard cost no requests. When the listing is refused (no
+// s3:ListBucket), each day's two forms are probed instead and only the ones
+// found are returned.
+func remoteShardPathsForDays(baseDir string, days []string) []string {
+	want := make(map[string]bool, len(days))
+	for _, day := range days {
+		want[day] = true
+	}
+	if listed, err := remoteShardPaths(baseDir); err == nil {
+		paths := make([]string, 0, len(listed))
+		for _, p := range listed {
+			if t, ok := ParseShardDate(p); ok && want[t.Format("2006-01-02")] {
+				paths = append(paths, p)
+			}
+		}
+		return paths
+	}
+	prefix := strings.TrimSuffix(baseDir, "/") + "/"
+	var paths []string
+	for _, day := range days {
+		for _, name := range []string{FileName(day, false), FileName(day, true)} {
+			p := prefix + name
+			// On an unexpected probe error keep the path so the read reports it.
+			if ok, err := objstore.Exists(p); ok || err != nil {
+				paths = append(paths, p)
+			}
+		}
 	}
 	return paths
 }
 
 func AllShardPaths(baseDir string) ([]string, error) {
-	pattern := filepath.Join(baseDir, "*.jsonl")
-	return filepath.Glob(pattern)
+	if objstore.IsURL(baseDir) {
+		return remoteShardPaths(baseDir)
+	}
+	plain, err := filepath.Glob(filepath.Join(baseDir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	gz, err := filepath.Glob(filepath.Join(baseDir, "*.jsonl.gz"))
+	if err != nil {
+		return nil, err
+	}
+	paths := append(plain, gz...)
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// remoteShardPaths lists the shard objects directly under an s3:// prefix.
+func remoteShardPaths(baseDir string) ([]string, error) {
+	prefix := strings.TrimSuffix(baseDir, "/") + "/"
+	urls, err := objstore.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(urls))
+	for _, u := range urls {
+		name := strings.TrimPrefix(u, prefix)
+		if strings.Contains(name, "/") {
+			continue
+		}
+		if _, ok := ParseShardDate(name); ok {
+			paths = append(paths, u)
+		}
+	}
+	return paths, nil
 }
 
 func ParseShardDate(path string) (time.Time, bool) {
-	base := filepath.Base(path)
+	base := strings.TrimSuffix(filepath.Base(path), ".gz")
 	if !strings.HasSuffix(base, ".jsonl") {
 		return time.Time{}, false
 	}
@@ -0,0 +1,267 @@
+// Package sink sends matched entries somewhere: stdout, a file, or an HTTP
+// collector that accepts NDJSON.
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+// Sink receives entries one at a time. Close flushes anything buffered.
+type Sink interface {
+	Write(e types.LogEntry) error
+	Close() error
+}
+
+// Open picks a sink from spec: "stdout" or "-" for stdout, an http:// or
+// https:// URL for an HTTP sink, and anything else as a file path to append to.
+// jsonOut chooses NDJSON over text lines for stdout and files; HTTP sinks always
+// send NDJSON. Text lines show messageFields after the message (see
+// types.LogEntry.MessageWithFields).
+func Open(spec string, jsonOut bool, messageFields []string) (Sink, error) {
+	switch {
+	case spec == "" || spec == "-" || spec == "stdout":
+		return NewStdout(jsonOut, messageFields), nil
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		return NewHTTP(spec), nil
+	default:
+		return NewFile(spec, jsonOut, messageFields)
+	}
+}
+
+// WriterSink writes one line per entry: NDJSON, or the text form
+// "<RFC3339 timestamp> <level> <message>", with the message followed by any
+// of messageFields the entry has.
+type WriterSink struct {
+	w             *bufio.Writer
+	closer        io.Closer
+	jsonOut       bool
+	messageFields []string
+}
+
+// NewWriter returns a sink writing to w. Close flushes but does not close w.
+func NewWriter(w io.Writer, jsonOut bool, messageFields []string) *WriterSink {
+	return &WriterSink{w: bufio.NewWriter(w), jsonOut: jsonOut, messageFields: messageFields}
+}
+
+// NewStdout returns a sink writing to stdout. Each entry is flushed as it is
+// written so interactive output (tailing) is not delayed.
+func NewStdout(jsonOut bool, messageFields []string) Sink {
+	return flushEach{NewWriter(os.Stdout, jsonOut, messageFields)}
+}
+
+// NewFile returns a sink appending to path, creating it if needed.
+func NewFile(path string, jsonOut bool, messageFields []string) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := NewWriter(f, jsonOut, messageFields)
+	s.closer = f
+	return flushEach{s}, nil
+}
+
+func (s *WriterSink) Write(e types.LogEntry) error {
+	if s.jsonOut {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := s.w.Write(data); err != nil {
+			return err
+		}
+		return s.w.WriteByte('\n')
+	}
+	_, err := fmt.Fprintf(s.w, "%s %s %s\n", e.Timestamp.Format(time.RFC3339), e.Level, e.MessageWithFields(s.messageFields))
+	return err
+}
+
+func (s *WriterSink) Close() error {
+	err := s.w.Flush()
+	if s.closer != nil {
+		if cerr := s.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// flushEach flushes a WriterSink after every entry.
+type flushEach struct {
+	*WriterSink
+}
+
+func (s flushEach) Write(e types.LogEntry) error {
+	if err := s.WriterSink.Write(e); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+const (
+	// DefaultBatchSize is how many entries an HTTP sink buffers before posting.
+	DefaultBatchSize = 500
+	// DefaultFlushInterval bounds how long a partial batch waits.
+	DefaultFlushInterval = 2 * time.Second
+	// DefaultRetries is how many times an HTTP sink re-posts a failed batch.
+	DefaultRetries = 2
+	// DefaultRetryDelay is the wait before the first re-post; it doubles after.
+	DefaultRetryDelay = 500 * time.Millisecond
+)
+
+// HTTPSink POSTs entries to URL as NDJSON (Content-Type application/x-ndjson)
+// in batches of BatchSize, and posts a partial batch once it is FlushInterval
+// old so a slow stream still arrives promptly. A batch is posted without
+// holding up Write, so entries keep buffering during a slow request; batches
+// are still sent one at a time, in order.
+//
+// A batch that fails with a network error, 429 or 5xx is re-posted up to
+// Retries times. A batch that still fails, or gets another non-2xx response,
+// is dropped and reported: the error names the number of entries lost and is
+// returned from the Write or Close that sent it (or, for a timed flush, from
+// the next one).
+type HTTPSink struct {
+	URL           string
+	BatchSize     int
+	FlushInterval time.Duration
+	Retries       int
+	RetryDelay    time.Duration
+	Client        *http.Client
+
+	// sendMu serializes posts; it is taken before mu, never while holding it.
+	sendMu sync.Mutex
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	count   int
+	timer   *time.Timer
+	pending error
+}
+
+// NewHTTP returns an HTTP sink with the default batch size, flush interval and
+// retries.
+func NewHTTP(url string) *HTTPSink {
+	return &HTTPSink{
+		URL:           url,
+		BatchSize:     DefaultBatchSize,
+		FlushInterval: DefaultFlushInterval,
+		Retries:       DefaultRetries,
+		RetryDelay:    DefaultRetryDelay,
+		Client:        &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *HTTPSink) Write(e types.LogEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if err := s.pending; err != nil {
+		s.pending = nil
+		s.mu.Unlock()
+		return err
+	}
+	s.buf.Write(data)
+	s.buf.WriteByte('\n')
+	s.count++
+	full := s.BatchSize > 0 && s.count >= s.BatchSize
+	if !full && s.timer == nil && s.FlushInterval > 0 {
+		s.timer = time.AfterFunc(s.FlushInterval, s.timedFlush)
+	}
+	s.mu.Unlock()
+	if full {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *HTTPSink) timedFlush() {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if err := s.sendBatch(); err != nil {
+		s.mu.Lock()
+		if s.pending == nil {
+			s.pending = err
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Close posts any buffered entries.
+func (s *HTTPSink) Close() error {
+	err := s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		err = s.pending
+	}
+	s.pending = nil
+	return err
+}
+
+func (s *HTTPSink) flush() error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.sendBatch()
+}
+
+// sendBatch takes the buffered batch under mu and posts it without mu held.
+// The caller holds sendMu.
+func (s *HTTPSink) sendBatch() error {
+	s.mu.Lock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	n := s.count
+	body := append([]byte(nil), s.buf.Bytes()...)
+	s.buf.Reset()
+	s.count = 0
+	s.mu.Unlock()
+	if n == 0 {
+		return nil
+	}
+
+	delay := s.RetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.Retries {
+			return fmt.Errorf("sink %s: %d entries dropped: %w", s.URL, n, err)
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post sends one batch, reporting whether a failure is worth retrying.
+func (s *HTTPSink) post(body []byte) (bool, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(s.URL, "application/x-ndjson", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("%s", resp.Status)
+	}
+	return false, nil
+}
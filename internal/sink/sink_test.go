@@ -0,0 +1,128 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+func TestWriterSinkText(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewWriter(&buf, false, nil)
+	s.Write(types.LogEntry{Timestamp: time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC), Level: "ERROR", Message: "disk full"})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got, want := buf.String(), "2026-02-08T10:00:00Z ERROR disk full\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestHTTPSinkBatches(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]types.LogEntry
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			http.Error(w, "bad content type "+ct, http.StatusUnsupportedMediaType)
+			return
+		}
+		var batch []types.LogEntry
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			var e types.LogEntry
+			if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			batch = append(batch, e)
+		}
+		mu.Lock()
+		batches = append(batches, batch)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	s := NewHTTP(srv.URL)
+	s.BatchSize = 2
+	s.FlushInterval = 0
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := s.Write(types.LogEntry{Level: "INFO", Message: msg}); err != nil {
+			t.Fatalf("Write(%s) error = %v", msg, err)
+		}
+	}
+	mu.Lock()
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("before Close: batches = %v, want one batch of 2", batches)
+	}
+	mu.Unlock()
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(batches) != 2 || len(batches[1]) != 1 || batches[1][0].Message != "c" {
+		t.Fatalf("after Close: batches = %v, want the remaining entry posted", batches)
+	}
+}
+
+func TestHTTPSinkTimedFlushAndErrors(t *testing.T) {
+	posted := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusServiceUnavailable)
+		select {
+		case posted <- struct{}{}:
+		default:
+		}
+	}))
+	defer srv.Close()
+
+	s := NewHTTP(srv.URL)
+	s.FlushInterval = 10 * time.Millisecond
+	s.RetryDelay = time.Millisecond
+	if err := s.Write(types.LogEntry{Level: "INFO", Message: "slow stream"}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	select {
+	case <-posted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("partial batch was not posted after FlushInterval")
+	}
+	if err := s.Close(); err == nil || !strings.Contains(err.Error(), "1 entries dropped") {
+		t.Errorf("Close() error = %v, want the rejected timed flush", err)
+	}
+}
+
+func TestHTTPSinkRetries(t *testing.T) {
+	var mu sync.Mutex
+	var attempts, delivered int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		delivered++
+	}))
+	defer srv.Close()
+
+	s := NewHTTP(srv.URL)
+	s.FlushInterval = 0
+	s.RetryDelay = time.Millisecond
+	if err := s.Write(types.LogEntry{Level: "INFO", Message: "a"}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if attempts != 2 || delivered != 1 {
+		t.Errorf("attempts = %d, delivered = %d; want the batch re-posted once", attempts, delivered)
+	}
+}
@@ -1,22 +1,31 @@
 package snapshot
 
 import (
+	"bufio"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/armash/log-pipeline/internal/index"
+	"github.com/armash/log-pipeline/internal/shard"
 	"github.com/armash/log-pipeline/internal/types"
 )
 
 const Version = 1
 
+// StreamThreshold is the file size above which LoadAuto uses the streaming decoder.
+const StreamThreshold = 64 << 20
+
 type Metadata struct {
 	Version     int       `json:"version"`
 	CreatedAt   time.Time `json:"createdAt"`
 	EntryCount  int       `json:"entryCount"`
 	SourceFiles []string  `json:"sourceFiles"`
+	// Filter describes the query the entries were selected with, in query DSL
+	// form, for snapshots written by CreateFiltered. It is empty for full snapshots.
+	Filter string `json:"filter,omitempty"`
 }
 
 type Snapshot struct {
@@ -26,6 +35,12 @@ type Snapshot struct {
 }
 
 func Create(path string, entries []types.LogEntry, sources []string) error {
+	return CreateFiltered(path, entries, sources, "")
+}
+
+// CreateFiltered writes a snapshot of entries that were selected with filter and
+// records filter in the metadata so readers know the snapshot is partial.
+func CreateFiltered(path string, entries []types.LogEntry, sources []string, filter string) error {
 	if err := ensureDir(path); err != nil {
 		return err
 	}
@@ -37,6 +52,7 @@ func Create(path string, entries []types.LogEntry, sources []string) error {
 			CreatedAt:   time.Now().UTC(),
 			EntryCount:  len(entries),
 			SourceFiles: sources,
+			Filter:      filter,
 		},
 		Entries: entries,
 		Index:   index.ToSnapshotIndex(idx, entries),
@@ -69,6 +85,141 @@ func Load(path string) (Snapshot, error) {
 	return snap, nil
 }
 
+// Merge loads several snapshots and returns their entries, de-duplicated under
+// dedup and sorted by time, along with the combined source file list.
+func Merge(paths []string, dedup types.DedupKey) ([]types.LogEntry, []string, error) {
+	entries := make([]types.LogEntry, 0)
+	sources := make([]string, 0, len(paths))
+	seen := make(map[string]struct{})
+	for _, p := range paths {
+		snap, err := LoadAuto(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", p, err)
+		}
+		if snap.Metadata.Version != Version {
+			return nil, nil, fmt.Errorf("%s: snapshot version %d is not supported (expected %d)", p, snap.Metadata.Version, Version)
+		}
+		for _, e := range snap.Entries {
+			key := dedup.Key(e)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			entries = append(entries, e)
+		}
+		sources = append(sources, p)
+	}
+	shard.SortEntries(entries)
+	return entries, sources, nil
+}
+
+// LoadAuto picks Load for small files and LoadStreaming for files above StreamThreshold.
+func LoadAuto(path string) (Snapshot, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if info.Size() > StreamThreshold {
+		return LoadStreaming(path)
+	}
+	return Load(path)
+}
+
+// LoadStreaming decodes a snapshot with json.Decoder, reading entries one at a time
+// instead of buffering the whole file, which roughly halves peak memory.
+func LoadStreaming(path string) (Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	if err := expectDelim(dec, '{'); err != nil {
+		return Snapshot{}, err
+	}
+
+	var snap Snapshot
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return Snapshot{}, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return Snapshot{}, fmt.Errorf("unexpected token %v", tok)
+		}
+		switch key {
+		case "metadata":
+			if err := dec.Decode(&snap.Metadata); err != nil {
+				return Snapshot{}, err
+			}
+		case "index":
+			if err := dec.Decode(&snap.Index); err != nil {
+				return Snapshot{}, err
+			}
+		case "entries":
+			entries, err := decodeEntries(dec, snap.Metadata.EntryCount)
+			if err != nil {
+				return Snapshot{}, err
+			}
+			snap.Entries = entries
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return Snapshot{}, err
+			}
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return Snapshot{}, err
+	}
+	return snap, nil
+}
+
+// maxSizeHint caps the capacity taken from a snapshot's entryCount, which comes
+// from the file and may be wrong; larger snapshots grow the slice as they decode.
+const maxSizeHint = 1 << 20
+
+// decodeEntries decodes the entries array, preallocating for sizeHint entries
+// (clamped to 0..maxSizeHint).
+func decodeEntries(dec *json.Decoder, sizeHint int) ([]types.LogEntry, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, nil
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return nil, fmt.Errorf("expected entries array")
+	}
+	sizeHint = max(0, min(sizeHint, maxSizeHint))
+	entries := make([]types.LogEntry, 0, sizeHint)
+	for dec.More() {
+		var e types.LogEntry
+		if err := dec.Decode(&e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := expectDelim(dec, ']'); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q in snapshot", want)
+	}
+	return nil
+}
+
 func ensureDir(path string) error {
 	dir := filepath.Dir(path)
 	if dir == "." || dir == "" {
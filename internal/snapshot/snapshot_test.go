@@ -0,0 +1,85 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+func TestLoadStreamingMatchesLoad(t *testing.T) {
+	base := time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC)
+	entries := []types.LogEntry{
+		{Timestamp: base, Level: "INFO", Message: "service started"},
+		{Timestamp: base.Add(time.Minute), Level: "ERROR", Message: "auth failed"},
+	}
+	path := filepath.Join(t.TempDir(), "snap.json")
+	if err := Create(path, entries, []string{"test.log"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	want, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	got, err := LoadStreaming(path)
+	if err != nil {
+		t.Fatalf("LoadStreaming() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadStreaming() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCreateFilteredRecordsFilter(t *testing.T) {
+	base := time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC)
+	entries := []types.LogEntry{{Timestamp: base, Level: "ERROR", Message: "auth failed"}}
+	dir := t.TempDir()
+
+	filtered := filepath.Join(dir, "filtered.json")
+	if err := CreateFiltered(filtered, entries, []string{"test.log"}, "level=ERROR"); err != nil {
+		t.Fatalf("CreateFiltered() error = %v", err)
+	}
+	for name, load := range map[string]func(string) (Snapshot, error){"Load": Load, "LoadStreaming": LoadStreaming} {
+		snap, err := load(filtered)
+		if err != nil {
+			t.Fatalf("%s() error = %v", name, err)
+		}
+		if snap.Metadata.Filter != "level=ERROR" || snap.Metadata.EntryCount != 1 {
+			t.Errorf("%s() metadata = %+v, want filter level=ERROR and 1 entry", name, snap.Metadata)
+		}
+	}
+
+	full := filepath.Join(dir, "full.json")
+	if err := Create(full, entries, nil); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	snap, err := Load(full)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if snap.Metadata.Filter != "" {
+		t.Errorf("Create() recorded filter %q, want none", snap.Metadata.Filter)
+	}
+}
+
+func TestLoadStreamingIgnoresBadEntryCount(t *testing.T) {
+	dir := t.TempDir()
+	for _, count := range []string{"-1", "9223372036854775807"} {
+		path := filepath.Join(dir, "snap.json")
+		data := `{"metadata":{"version":1,"entryCount":` + count + `},"entries":[{"timestamp":"2026-02-08T10:00:00Z","level":"INFO","message":"ok"}]}`
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		snap, err := LoadStreaming(path)
+		if err != nil {
+			t.Fatalf("entryCount %s: LoadStreaming() error = %v", count, err)
+		}
+		if len(snap.Entries) != 1 {
+			t.Errorf("entryCount %s: got %d entries, want 1", count, len(snap.Entries))
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package store
+
+import "github.com/armash/log-pipeline/internal/types"
+
+// Store persists ingested entries. The engine appends and replays through it, so
+// alternative backends can be plugged in without engine changes. JSONLStore is
+// the default.
+type Store interface {
+	// Append adds entries in the given order.
+	Append(entries []types.LogEntry) error
+	// Load returns every stored entry in stored order.
+	Load() ([]types.LogEntry, error)
+}
+
+// HeaderAppender is implemented by stores that can record a run header.
+type HeaderAppender interface {
+	AppendHeader(header string) error
+}
+
+// JSONLStore is a Store backed by one append-only JSONL file.
+type JSONLStore struct {
+	Path string
+}
+
+// NewJSONL returns a JSONL store for path.
+func NewJSONL(path string) *JSONLStore {
+	return &JSONLStore{Path: path}
+}
+
+func (s *JSONLStore) Append(entries []types.LogEntry) error {
+	return AppendJSONL(s.Path, entries)
+}
+
+func (s *JSONLStore) Load() ([]types.LogEntry, error) {
+	return LoadJSONL(s.Path)
+}
+
+func (s *JSONLStore) AppendHeader(header string) error {
+	return AppendHeader(s.Path, header)
+}
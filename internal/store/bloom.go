@@ -0,0 +1,295 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/armash/log-pipeline/internal/objstore"
+	"github.com/armash/log-pipeline/internal/query"
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+// A shard bloom filter records the lowercase byte trigrams of every message in
+// the shard. Search and message= filters are case-insensitive substring/exact
+// matches, so a shard can only match a term if it contains all of the term's
+// trigrams; when the filter rules one out the shard is skipped unread. Terms
+// shorter than three bytes never skip anything.
+//
+// The sidecar lives next to the shard as <shard>.bloom and records the shard's
+// size when it was written. A shard modified without updating the filter (by an
+// older binary, say) no longer matches that size, so its filter is ignored
+// rather than trusted.
+
+const (
+	bloomMagic  = "LPBLOOM1"
+	bloomWords  = 1 << 14 // 2^20 bits, 128 KiB per shard
+	bloomHashes = 4
+)
+
+var errBadBloom = errors.New("invalid bloom filter")
+
+// BloomPath returns the sidecar path for a shard file.
+func BloomPath(shardPath string) string {
+	return shardPath + ".bloom"
+}
+
+type bloom struct {
+	bits []uint64
+	// size is the shard file size the filter describes.
+	size int64
+}
+
+func newBloom() *bloom {
+	return &bloom{bits: make([]uint64, bloomWords)}
+}
+
+func (b *bloom) addMessage(msg string) {
+	lower := strings.ToLower(msg)
+	for i := 0; i+3 <= len(lower); i++ {
+		b.add(lower[i : i+3])
+	}
+}
+
+// mayContain reports whether a message containing term could be in the shard.
+func (b *bloom) mayContain(term string) bool {
+	lower := strings.ToLower(term)
+	for i := 0; i+3 <= len(lower); i++ {
+		if !b.has(lower[i : i+3]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bloom) add(gram string) {
+	h1, h2 := bloomHash(gram)
+	m := uint64(len(b.bits) * 64)
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (b *bloom) has(gram string) bool {
+	h1, h2 := bloomHash(gram)
+	m := uint64(len(b.bits) * 64)
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHash derives the two hashes for double hashing from a trigram.
+func bloomHash(gram string) (uint64, uint64) {
+	x := uint64(gram[0])<<16 | uint64(gram[1])<<8 | uint64(gram[2])
+	return mix64(x), mix64(x^0x9e3779b97f4a7c15) | 1
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func readBloom(path string) (*bloom, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var header struct {
+		Magic [8]byte
+		Size  int64
+		Words uint32
+	}
+	if err := binary.Read(f, binary.LittleEndian, &header); err != nil {
+		return nil, errBadBloom
+	}
+	if string(header.Magic[:]) != bloomMagic || header.Words != bloomWords {
+		return nil, errBadBloom
+	}
+	b := &bloom{bits: make([]uint64, header.Words), size: header.Size}
+	if err := binary.Read(f, binary.LittleEndian, b.bits); err != nil {
+		return nil, errBadBloom
+	}
+	return b, nil
+}
+
+// save writes the filter for shardPath, recording the shard's current size.
+func (b *bloom) save(shardPath string) error {
+	info, err := os.Stat(shardPath)
+	if err != nil {
+		return err
+	}
+	b.size = info.Size()
+	path := BloomPath(shardPath)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	var magic [8]byte
+	copy(magic[:], bloomMagic)
+	for _, v := range []interface{}{magic, b.size, uint32(len(b.bits)), b.bits} {
+		if err := binary.Write(f, binary.LittleEndian, v); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// appendShardFile appends batch to one shard file and keeps its filter current.
+// With bloom set a shard without a filter gets one; existing filters are kept
+// current either way.
+func appendShardFile(path string, batch []types.LogEntry, bloom bool) error {
+	unlock, err := lockShard(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return appendShardLocked(path, batch, bloom)
+}
+
+// appendShardLocked is appendShardFile for a caller that holds the shard lock.
+func appendShardLocked(path string, batch []types.LogEntry, bloom bool) error {
+	var prevSize int64
+	if info, err := os.Stat(path); err == nil {
+		prevSize = info.Size()
+	}
+	if err := AppendJSONL(path, batch); err != nil {
+		return err
+	}
+	return updateBloom(path, prevSize, batch, bloom)
+}
+
+// rewriteShardFile replaces one shard file with raw lines followed by entries
+// and keeps its filter current, as appendShardFile does. The caller holds the
+// shard lock.
+func rewriteShardFile(path string, raw [][]byte, entries []types.LogEntry, bloom bool) error {
+	if err := rewriteJSONL(path, raw, entries); err != nil {
+		return err
+	}
+	return refreshBloom(path, entries, bloom)
+}
+
+// updateBloom brings a shard's filter up to date after batch was appended to a
+// shard that was prevSize bytes long. A missing or stale filter is rebuilt from
+// the whole shard; unless create is set a missing one is left missing.
+func updateBloom(shardPath string, prevSize int64, batch []types.LogEntry, create bool) error {
+	b, err := readBloom(BloomPath(shardPath))
+	if err != nil && !os.IsNotExist(err) && !errors.Is(err, errBadBloom) {
+		return err
+	}
+	if b == nil && os.IsNotExist(err) && !create {
+		return nil
+	}
+	if b == nil || b.size != prevSize {
+		all, err := LoadJSONL(shardPath)
+		if err != nil {
+			return err
+		}
+		return rebuildBloom(shardPath, all)
+	}
+	for _, e := range batch {
+		b.addMessage(e.Message)
+	}
+	return b.save(shardPath)
+}
+
+// refreshBloom rebuilds a shard's filter after the shard was rewritten with
+// entries, if the shard has a filter or create is set.
+func refreshBloom(shardPath string, entries []types.LogEntry, create bool) error {
+	if !create {
+		if _, err := os.Stat(BloomPath(shardPath)); err != nil {
+			return nil
+		}
+	}
+	return rebuildBloom(shardPath, entries)
+}
+
+func rebuildBloom(shardPath string, entries []types.LogEntry) error {
+	b := newBloom()
+	for _, e := range entries {
+		b.addMessage(e.Message)
+	}
+	return b.save(shardPath)
+}
+
+// ShardMayMatch reports whether the shard at path could hold an entry matching
+// f. It is false only when a current bloom sidecar rules out every search term;
+// shards without one (including object-store shards) always may match.
+func ShardMayMatch(path string, f query.Filters) bool {
+	if objstore.IsURL(path) || !hasTerms(f) {
+		return true
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	b, err := readBloom(BloomPath(path))
+	if err != nil || b.size != info.Size() {
+		return true
+	}
+	return bloomMayMatch(b, f)
+}
+
+func hasTerms(f query.Filters) bool {
+	if len(f.Or) > 0 {
+		for _, opt := range f.Or {
+			if !hasTerms(opt) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, sub := range f.Search {
+		if len(sub) >= 3 {
+			return true
+		}
+	}
+	return len(f.MessageEquals) >= 3
+}
+
+func bloomMayMatch(b *bloom, f query.Filters) bool {
+	if len(f.Or) > 0 {
+		for _, opt := range f.Or {
+			if bloomMayMatch(b, opt) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, sub := range f.Search {
+		if !b.mayContain(sub) {
+			return false
+		}
+	}
+	return b.mayContain(f.MessageEquals)
+}
+
+// PruneShards drops shard paths that ShardMayMatch rules out for f, returning
+// the remaining paths in order and how many were skipped.
+func PruneShards(paths []string, f query.Filters) ([]string, int) {
+	kept := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if ShardMayMatch(p, f) {
+			kept = append(kept, p)
+		}
+	}
+	return kept, len(paths) - len(kept)
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package store
+
+import "sync"
+
+var (
+	fileLocksMu sync.Mutex
+	fileLocks   = make(map[string]*sync.Mutex)
+)
+
+// lockFile serializes writers of path within this process; without flock it
+// cannot exclude other processes.
+func lockFile(path string) (func(), error) {
+	fileLocksMu.Lock()
+	mu, ok := fileLocks[path]
+	if !ok {
+		mu = &sync.Mutex{}
+		fileLocks[path] = mu
+	}
+	fileLocksMu.Unlock()
+	mu.Lock()
+	return mu.Unlock, nil
+}
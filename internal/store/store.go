@@ -2,16 +2,29 @@ package store
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
+	"github.com/armash/log-pipeline/internal/decompress"
+	"github.com/armash/log-pipeline/internal/objstore"
 	"github.com/armash/log-pipeline/internal/types"
 	"github.com/armash/log-pipeline/internal/shard"
 )
 
-// AppendJSONL appends entries as JSON lines to a file.
+// AppendJSONL appends entries as JSON lines to a file. For a path ending in ".gz"
+// the batch is appended as one more gzip member; gzip readers (including LoadJSONL)
+// decode concatenated members as a single stream, so existing data is never rewritten.
 func AppendJSONL(path string, entries []types.LogEntry) error {
 	if err := ensureDir(path); err != nil {
 		return err
@@ -22,6 +35,9 @@ func AppendJSONL(path string, entries []types.LogEntry) error {
 	}
 	defer f.Close()
 
+	if strings.HasSuffix(path, ".gz") {
+		return appendGzipMember(f, entries)
+	}
 	for _, e := range entries {
 		if err := AppendJSONLToWriter(f, e); err != nil {
 			return err
@@ -30,6 +46,73 @@ func AppendJSONL(path string, entries []types.LogEntry) error {
 	return nil
 }
 
+func appendGzipMember(f *os.File, entries []types.LogEntry) error {
+	zw := gzip.NewWriter(f)
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := zw.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// WriteJSONL writes entries as JSON lines to path, replacing any existing file.
+// A ".gz" path is written gzip-compressed.
+func WriteJSONL(path string, entries []types.LogEntry) error {
+	if err := ensureDir(path); err != nil {
+		return err
+	}
+	return rewriteJSONL(path, nil, entries)
+}
+
+// rewriteJSONL replaces path with raw lines followed by entries through a
+// temporary file, keeping the path's compression.
+func rewriteJSONL(path string, raw [][]byte, entries []types.LogEntry) error {
+	tmp := path + ".tmp"
+	if strings.HasSuffix(path, ".gz") {
+		tmp = strings.TrimSuffix(path, ".gz") + ".tmp.gz"
+	}
+	_ = os.Remove(tmp)
+	if len(raw) > 0 {
+		if err := appendLines(tmp, raw); err != nil {
+			return err
+		}
+	}
+	if err := AppendJSONL(tmp, entries); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// appendLines appends raw lines to path as they are, gzip-compressed for a
+// ".gz" path.
+func appendLines(path string, lines [][]byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var w io.Writer = f
+	var zw *gzip.Writer
+	if strings.HasSuffix(path, ".gz") {
+		zw = gzip.NewWriter(f)
+		w = zw
+	}
+	for _, line := range lines {
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	if zw != nil {
+		return zw.Close()
+	}
+	return nil
+}
+
 // AppendJSONLToWriter writes a single entry as JSON line to a writer.
 func AppendJSONLToWriter(f *os.File, entry types.LogEntry) error {
 	data, err := json.Marshal(entry)
@@ -42,9 +125,22 @@ func AppendJSONLToWriter(f *os.File, entry types.LogEntry) error {
 	return nil
 }
 
-// LoadJSONL reads entries from a JSONL file.
+// openJSONL opens a local path or s3:// URL, decompressing by extension.
+func openJSONL(path string) (io.ReadCloser, error) {
+	if objstore.IsURL(path) {
+		rc, err := objstore.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return decompress.Wrap(rc, path, decompress.Auto)
+	}
+	return decompress.Open(path, decompress.Auto)
+}
+
+// LoadJSONL reads entries from a JSONL file, decompressing .gz/.bz2/.zst files by extension.
+// path may also be an s3:// URL.
 func LoadJSONL(path string) ([]types.LogEntry, error) {
-	f, err := os.Open(path)
+	f, err := openJSONL(path)
 	if err != nil {
 		return nil, err
 	}
@@ -69,24 +165,384 @@ func LoadJSONL(path string) ([]types.LogEntry, error) {
 	return entries, nil
 }
 
-// LoadJSONLFromMany reads entries from multiple JSONL files.
-func LoadJSONLFromMany(paths []string) ([]types.LogEntry, error) {
-	all := make([]types.LogEntry, 0)
-	for _, p := range paths {
-		if _, err := os.Stat(p); err != nil {
+// readShard loads a shard like LoadJSONL but also returns the lines LoadJSONL
+// would skip as malformed, so a rewrite can carry them over instead of
+// deleting them.
+func readShard(path string) ([]types.LogEntry, [][]byte, error) {
+	f, err := openJSONL(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	entries := make([]types.LogEntry, 0)
+	var malformed [][]byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e types.LogEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			malformed = append(malformed, append([]byte(nil), line...))
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return entries, malformed, nil
+}
+
+// ScanJSONL reads a JSONL file in batches of up to batchSize entries and calls fn for
+// each batch in file order, so the whole file is never held in memory. Returning
+// ErrStopScan from fn ends the scan early without error.
+func ScanJSONL(path string, batchSize int, fn func([]types.LogEntry) error) error {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	f, err := openJSONL(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	batch := make([]types.LogEntry, 0, batchSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e types.LogEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			continue
+		}
+		batch = append(batch, e)
+		if len(batch) == batchSize {
+			if err := fn(batch); err != nil {
+				if errors.Is(err, ErrStopScan) {
+					return nil
+				}
+				return err
+			}
+			batch = make([]types.LogEntry, 0, batchSize)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		if err := fn(batch); err != nil && !errors.Is(err, ErrStopScan) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrStopScan can be returned by a ScanJSONL callback to stop reading.
+var ErrStopScan = errors.New("stop scan")
+
+// JSONLLineError is one line ValidateJSONL rejected.
+type JSONLLineError struct {
+	Line   int    `json:"line"` // 1-based
+	Reason string `json:"reason"`
+}
+
+// JSONLValidation summarizes a ValidateJSONL scan. Blank lines are not counted.
+type JSONLValidation struct {
+	Lines   int              `json:"lines"`
+	Valid   int              `json:"valid"`
+	Invalid int              `json:"invalid"`
+	Errors  []JSONLLineError `json:"errors"`
+}
+
+// ValidateJSONL checks every line of a JSONL file the way LoadJSONL parses it,
+// but reports rejected lines instead of skipping them. A line is valid when it
+// decodes as a LogEntry with a timestamp, level and message; LoadJSONL itself
+// also keeps entries missing those fields. Up to maxErrors line errors are kept.
+func ValidateJSONL(path string, maxErrors int) (JSONLValidation, error) {
+	f, err := openJSONL(path)
+	if err != nil {
+		return JSONLValidation{}, err
+	}
+	defer f.Close()
+
+	res := JSONLValidation{Errors: []JSONLLineError{}}
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		res.Lines++
+		reason := validateJSONLLine(line)
+		if reason == "" {
+			res.Valid++
+			continue
+		}
+		res.Invalid++
+		if len(res.Errors) < maxErrors {
+			res.Errors = append(res.Errors, JSONLLineError{Line: lineNo, Reason: reason})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return res, fmt.Errorf("line %d: %w", lineNo+1, err)
+	}
+	return res, nil
+}
+
+// SampleJSONL checks the first n non-blank lines of path the way ValidateJSONL
+// does, so a store or shard can be vetted before anything is appended to it.
+// --store-header blocks are skipped. A missing file samples as empty.
+func SampleJSONL(path string, n int) (JSONLValidation, error) {
+	res := JSONLValidation{Errors: []JSONLLineError{}}
+	f, err := openJSONL(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return res, nil
+		}
+		return res, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	inHeader := false
+	for res.Lines < n && scanner.Scan() {
+		lineNo++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if bytes.HasPrefix(line, []byte(headerBorder)) {
+			inHeader = !inHeader
+			continue
+		}
+		if inHeader {
+			continue
+		}
+		res.Lines++
+		if reason := validateJSONLLine(line); reason != "" {
+			res.Invalid++
+			res.Errors = append(res.Errors, JSONLLineError{Line: lineNo, Reason: reason})
+			continue
+		}
+		res.Valid++
+	}
+	if err := scanner.Err(); err != nil {
+		if !errors.Is(err, bufio.ErrTooLong) {
+			return res, fmt.Errorf("line %d: %w", lineNo+1, err)
+		}
+		res.Lines++
+		res.Invalid++
+		res.Errors = append(res.Errors, JSONLLineError{Line: lineNo + 1, Reason: "line longer than 64 KiB"})
+	}
+	return res, nil
+}
+
+// headerBorder starts and ends a --store-header block.
+const headerBorder = "═"
+
+func validateJSONLLine(line []byte) string {
+	if bytes.IndexByte(line, 0) >= 0 || !utf8.Valid(line) {
+		return "binary data, not text"
+	}
+	var e types.LogEntry
+	if err := json.Unmarshal(line, &e); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		var timeErr *time.ParseError
+		switch {
+		case errors.As(err, &typeErr) && typeErr.Field == "":
+			return "not a JSON object"
+		case errors.As(err, &typeErr):
+			return fmt.Sprintf("field %q has the wrong type (%s)", typeErr.Field, typeErr.Value)
+		case errors.As(err, &timeErr):
+			return fmt.Sprintf("invalid timestamp %q", timeErr.Value)
+		}
+		if !json.Valid(line) {
+			return "not valid JSON"
+		}
+		return err.Error()
+	}
+	var missing []string
+	if e.Timestamp.IsZero() {
+		missing = append(missing, "timestamp")
+	}
+	if e.Level == "" {
+		missing = append(missing, "level")
+	}
+	if e.Message == "" {
+		missing = append(missing, "message")
+	}
+	if len(missing) > 0 {
+		return "missing " + strings.Join(missing, ", ")
+	}
+	return ""
+}
+
+// loadIfExists loads path, reporting false instead of an error when it is missing.
+func loadIfExists(path string) ([]types.LogEntry, bool, error) {
+	if !objstore.IsURL(path) {
+		if _, err := os.Stat(path); err != nil {
 			if os.IsNotExist(err) {
-				continue
+				return nil, false, nil
 			}
-			return nil, err
+			return nil, false, err
 		}
-		entries, err := LoadJSONL(p)
+	}
+	entries, err := LoadJSONL(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return entries, true, nil
+}
+
+// ProgressFunc receives multi-file load progress: files finished (loaded or
+// found missing) out of total, and entries loaded so far.
+type ProgressFunc func(filesDone, filesTotal, entries int)
+
+// progressTracker aggregates one multi-file load for its ProgressFunc. Calls
+// are serialized, so the func sees consistent totals even if files are loaded
+// concurrently.
+type progressTracker struct {
+	mu      sync.Mutex
+	fn      ProgressFunc
+	total   int
+	done    int
+	entries int
+}
+
+func newProgressTracker(fn ProgressFunc, total int) *progressTracker {
+	if fn == nil {
+		return nil
+	}
+	return &progressTracker{fn: fn, total: total}
+}
+
+func (p *progressTracker) fileDone(entries int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.entries += entries
+	p.fn(p.done, p.total, p.entries)
+}
+
+// LoadJSONLFromMany reads entries from multiple JSONL files.
+// It also returns the number of entries loaded from each existing path.
+// progress, if not nil, is called after each file.
+func LoadJSONLFromMany(paths []string, progress ProgressFunc) ([]types.LogEntry, map[string]int, error) {
+	all := make([]types.LogEntry, 0)
+	counts := make(map[string]int)
+	tracker := newProgressTracker(progress, len(paths))
+	for _, p := range paths {
+		entries, ok, err := loadIfExists(p)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		tracker.fileDone(len(entries))
+		if !ok {
+			continue
 		}
+		counts[p] = len(entries)
 		all = append(all, entries...)
 	}
 	shard.SortEntries(all)
-	return all, nil
+	return all, counts, nil
+}
+
+// DropDuplicates keeps the first entry for each dedup key, in order, and
+// returns how many were dropped. Shards can overlap after a re-ingest, a
+// compaction or a manual import; run this on the loaded entries to read each
+// entry once.
+func DropDuplicates(entries []types.LogEntry, dedup types.DedupKey) ([]types.LogEntry, int) {
+	seen := make(map[string]struct{}, len(entries))
+	kept := entries[:0]
+	for _, e := range entries {
+		key := dedup.Key(e)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		kept = append(kept, e)
+	}
+	return kept, len(entries) - len(kept)
+}
+
+// DescLoad describes what LoadJSONLFromManyDesc read.
+type DescLoad struct {
+	// Counts holds every entry read per shard, for the shards actually opened.
+	Counts map[string]int
+	// Duplicates counts entries dropped by dedup.
+	Duplicates int
+	// Stopped is set when older shards were left unread because limit was
+	// reached, so totals over the result are lower bounds.
+	Stopped bool
+}
+
+// LoadJSONLFromManyDesc reads entries newest-first from day shard paths.
+// When limit > 0 it stops opening older shards once limit entries satisfy match.
+// With dedup set, entries whose dedup key was already read are dropped as each
+// shard loads (see DropDuplicates), so duplicates never count toward limit.
+// progress is as in LoadJSONLFromMany.
+func LoadJSONLFromManyDesc(paths []string, limit int, match func(types.LogEntry) bool, dedup bool, key types.DedupKey, progress ProgressFunc) ([]types.LogEntry, DescLoad, error) {
+	ordered := append([]string(nil), paths...)
+	sort.Sort(sort.Reverse(sort.StringSlice(ordered)))
+
+	all := make([]types.LogEntry, 0)
+	res := DescLoad{Counts: make(map[string]int)}
+	seen := make(map[string]struct{})
+	matched := 0
+	tracker := newProgressTracker(progress, len(ordered))
+	for i, p := range ordered {
+		entries, ok, err := loadIfExists(p)
+		if err != nil {
+			return nil, DescLoad{}, err
+		}
+		tracker.fileDone(len(entries))
+		if !ok {
+			continue
+		}
+		res.Counts[p] = len(entries)
+		shard.SortEntriesDesc(entries)
+		if dedup {
+			kept := entries[:0]
+			for _, e := range entries {
+				k := key.Key(e)
+				if _, ok := seen[k]; ok {
+					res.Duplicates++
+					continue
+				}
+				seen[k] = struct{}{}
+				kept = append(kept, e)
+			}
+			entries = kept
+		}
+		all = append(all, entries...)
+		if limit <= 0 {
+			continue
+		}
+		for _, e := range entries {
+			if match == nil || match(e) {
+				matched++
+			}
+		}
+		if matched >= limit {
+			res.Stopped = i < len(ordered)-1
+			break
+		}
+	}
+	return all, res, nil
 }
 
 // WriteSnapshot writes all entries to a JSON file (pretty-printed).
@@ -122,8 +578,101 @@ func AppendHeaderToWriter(f *os.File, header string) error {
 	return nil
 }
 
+// ShardOptions controls how day shards are written.
+type ShardOptions struct {
+	// Sorted keeps each day shard sorted by time (see AppendShardsSorted).
+	Sorted bool
+	// Compress names new day shards .jsonl.gz and gzip-compresses them. A day
+	// that already has a shard keeps being written in that shard's form.
+	Compress bool
+	// Bloom writes a bloom sidecar for shards that lack one (see
+	// ShardMayMatch). Existing sidecars are kept current either way.
+	Bloom bool
+}
+
+// dayShardFile returns the shard file for day under baseDir: the existing one
+// in either form, preferring the form opts selects, or a new name in that form.
+func dayShardFile(baseDir string, day string, opts ShardOptions) string {
+	preferred := filepath.Join(baseDir, shard.FileName(day, opts.Compress))
+	if _, err := os.Stat(preferred); err != nil {
+		other := filepath.Join(baseDir, shard.FileName(day, !opts.Compress))
+		if _, err := os.Stat(other); err == nil {
+			return other
+		}
+	}
+	return preferred
+}
+
+// otherForm returns the path of a shard file's twin in the other compression
+// form: X.jsonl for X.jsonl.gz and the reverse.
+func otherForm(path string) string {
+	if strings.HasSuffix(path, ".gz") {
+		return strings.TrimSuffix(path, ".gz")
+	}
+	return path + ".gz"
+}
+
+// readShardDay reads a shard together with its other-form twin, which a day
+// can have when --shard-compress was toggled by an older binary. It returns the
+// twin's path, or "" when there is none; a missing path reads as empty.
+func readShardDay(path string) ([]types.LogEntry, [][]byte, string, error) {
+	entries, malformed, err := readShard(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, "", err
+	}
+	twin := otherForm(path)
+	if _, err := os.Stat(twin); err != nil {
+		return entries, malformed, "", nil
+	}
+	twinEntries, twinMalformed, err := readShard(twin)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return append(entries, twinEntries...), append(malformed, twinMalformed...), twin, nil
+}
+
+// removeTwin deletes a twin shard folded into its day's other file, along with
+// its bloom sidecar.
+func removeTwin(twin string) error {
+	if twin == "" {
+		return nil
+	}
+	if err := os.Remove(twin); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(BloomPath(twin)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 // AppendShards appends entries into per-day shard files under baseDir.
-func AppendShards(baseDir string, entries []types.LogEntry) error {
+func AppendShards(baseDir string, entries []types.LogEntry, opts ShardOptions) error {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return err
+	}
+
+	grouped := shard.GroupByDay(entries)
+	days := make([]string, 0, len(grouped))
+	for day := range grouped {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	for _, day := range days {
+		path := dayShardFile(baseDir, day, opts)
+		if err := appendShardFile(path, grouped[day], opts.Bloom); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AppendShardsSorted is like AppendShards but keeps each day shard sorted by time.
+// A batch that starts at or after a shard's last entry is appended; otherwise the
+// shard is merged and rewritten, which costs a full read and write of that day.
+// Only the shard's tail is read to decide.
+func AppendShardsSorted(baseDir string, entries []types.LogEntry, opts ShardOptions) error {
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
 		return err
 	}
@@ -136,14 +685,366 @@ func AppendShards(baseDir string, entries []types.LogEntry) error {
 	sort.Strings(days)
 
 	for _, day := range days {
-		path := filepath.Join(baseDir, day+".jsonl")
-		if err := AppendJSONL(path, grouped[day]); err != nil {
+		path := dayShardFile(baseDir, day, opts)
+		batch := grouped[day]
+		sortStable(batch)
+		if err := appendSortedShard(path, batch, opts.Bloom); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// appendSortedShard adds a time-sorted batch to one shard, keeping it sorted,
+// with the shard locked throughout. A twin in the other form is folded in.
+func appendSortedShard(path string, batch []types.LogEntry, bloom bool) error {
+	unlock, err := lockShard(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(otherForm(path)); err != nil {
+		last, ok, err := lastShardEntry(path)
+		if err != nil {
+			return err
+		}
+		if !ok || !batch[0].Timestamp.Before(last.Timestamp) {
+			return appendShardLocked(path, batch, bloom)
+		}
+	}
+
+	existing, malformed, twin, err := readShardDay(path)
+	if err != nil {
+		return err
+	}
+	merged := append(existing, batch...)
+	sortStable(merged)
+	if err := rewriteShardFile(path, malformed, merged, bloom); err != nil {
+		return err
+	}
+	return removeTwin(twin)
+}
+
+// lastShardEntry returns the last entry of a shard that parses, reporting false
+// for a missing or entry-less shard. A plain file is read backwards from its
+// end; a gzip stream can only be read from the start, but just the final entry
+// is decoded.
+func lastShardEntry(path string) (types.LogEntry, bool, error) {
+	if strings.HasSuffix(path, ".gz") {
+		return lastEntryScan(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return types.LogEntry{}, false, nil
+		}
+		return types.LogEntry{}, false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return types.LogEntry{}, false, err
+	}
+
+	const chunk = 4096
+	end := info.Size()
+	var tail []byte
+	for end > 0 {
+		start := end - chunk
+		if start < 0 {
+			start = 0
+		}
+		buf := make([]byte, end-start)
+		if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+			return types.LogEntry{}, false, err
+		}
+		tail = append(buf, tail...)
+		end = start
+		// Try every complete line in the tail, newest first.
+		for {
+			i := bytes.LastIndexByte(tail, '\n')
+			line := tail[i+1:]
+			if i < 0 && end > 0 {
+				break // the line may continue before the bytes read so far
+			}
+			var e types.LogEntry
+			if len(line) > 0 && json.Unmarshal(line, &e) == nil {
+				return e, true, nil
+			}
+			if i < 0 {
+				break
+			}
+			tail = tail[:i]
+		}
+	}
+	return types.LogEntry{}, false, nil
+}
+
+// lastEntryScan finds the last entry of a compressed shard by streaming it,
+// keeping only the last non-empty line; if that one is malformed it falls back
+// to decoding the whole shard.
+func lastEntryScan(path string) (types.LogEntry, bool, error) {
+	f, err := openJSONL(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return types.LogEntry{}, false, nil
+		}
+		return types.LogEntry{}, false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	var last []byte
+	for scanner.Scan() {
+		if line := scanner.Bytes(); len(line) > 0 {
+			last = append(last[:0], line...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return types.LogEntry{}, false, err
+	}
+	if last == nil {
+		return types.LogEntry{}, false, nil
+	}
+	var e types.LogEntry
+	if json.Unmarshal(last, &e) == nil {
+		return e, true, nil
+	}
+	entries, _, err := readShard(path)
+	if err != nil || len(entries) == 0 {
+		return types.LogEntry{}, false, err
+	}
+	return entries[len(entries)-1], true, nil
+}
+
+// ImportResult reports how many entries one day shard gained from an import.
+type ImportResult struct {
+	Day     string
+	Added   int
+	Skipped int
+}
+
+// ImportShards backfills entries into per-day shard files under baseDir, skipping
+// any entry already present in its shard (or earlier in the same batch) under
+// dedup, so re-running an import adds nothing. Existing entries are looked up in
+// both forms of a day's shard. With opts.Sorted, shards stay time-ordered as in
+// AppendShardsSorted. Results are ordered by day.
+func ImportShards(baseDir string, entries []types.LogEntry, dedup types.DedupKey, opts ShardOptions) ([]ImportResult, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, err
+	}
+
+	grouped := shard.GroupByDay(entries)
+	days := make([]string, 0, len(grouped))
+	for day := range grouped {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	results := make([]ImportResult, 0, len(days))
+	for _, day := range days {
+		path := dayShardFile(baseDir, day, opts)
+		existing, _, _, err := readShardDay(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		seen := make(map[string]struct{}, len(existing))
+		for _, e := range existing {
+			seen[dedup.Key(e)] = struct{}{}
+		}
+
+		batch := grouped[day]
+		added := make([]types.LogEntry, 0, len(batch))
+		for _, e := range batch {
+			key := dedup.Key(e)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			added = append(added, e)
+		}
+		if len(added) > 0 {
+			if opts.Sorted {
+				err = AppendShardsSorted(baseDir, added, opts)
+			} else {
+				err = appendShardFile(path, added, opts.Bloom)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		results = append(results, ImportResult{Day: day, Added: len(added), Skipped: len(batch) - len(added)})
+	}
+	return results, nil
+}
+
+// sortStable orders entries by time, keeping arrival order for equal timestamps.
+func sortStable(entries []types.LogEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+}
+
+// CompactResult describes one compacted shard.
+type CompactResult struct {
+	Path           string
+	EntriesBefore  int
+	EntriesAfter   int
+	BytesReclaimed int64
+	// Malformed counts lines that do not parse; they are kept as they are, at
+	// the start of the shard.
+	Malformed int
+}
+
+// CompactShard rewrites a shard file with duplicates (under dedup) removed and
+// entries sorted by time. A twin of the day in the other form is folded into
+// path and removed. The shard is locked against appends for the whole rewrite.
+// Only opts.Bloom applies: the shard keeps its name and form.
+func CompactShard(path string, dedup types.DedupKey, opts ShardOptions) (CompactResult, error) {
+	unlock, err := lockShard(path)
+	if err != nil {
+		return CompactResult{}, err
+	}
+	defer unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return CompactResult{}, err
+	}
+	sizeBefore := info.Size()
+	if twinInfo, err := os.Stat(otherForm(path)); err == nil {
+		sizeBefore += twinInfo.Size()
+	}
+	entries, malformed, twin, err := readShardDay(path)
+	if err != nil {
+		return CompactResult{}, err
+	}
+
+	seen := make(map[string]struct{}, len(entries))
+	kept := make([]types.LogEntry, 0, len(entries))
+	for _, e := range entries {
+		key := dedup.Key(e)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		kept = append(kept, e)
+	}
+	shard.SortEntries(kept)
+
+	if err := rewriteShardFile(path, malformed, kept, opts.Bloom); err != nil {
+		return CompactResult{}, err
+	}
+	if err := removeTwin(twin); err != nil {
+		return CompactResult{}, err
+	}
+	newInfo, err := os.Stat(path)
+	if err != nil {
+		return CompactResult{}, err
+	}
+	return CompactResult{
+		Path:           path,
+		EntriesBefore:  len(entries),
+		EntriesAfter:   len(kept),
+		BytesReclaimed: sizeBefore - newInfo.Size(),
+		Malformed:      len(malformed),
+	}, nil
+}
+
+// ShardCheck describes one verified shard file.
+type ShardCheck struct {
+	Path    string
+	Entries int
+	// Undated is set when the file name is not a YYYY-MM-DD shard date; every
+	// entry in it is then counted as misplaced.
+	Undated   bool
+	Misplaced int
+	// WrongDays counts misplaced entries by the UTC day they belong to.
+	WrongDays map[string]int
+}
+
+// VerifyShard checks that every entry in a shard falls on the UTC day named by
+// the file (see shard.ParseShardDate).
+func VerifyShard(path string) (ShardCheck, error) {
+	entries, err := LoadJSONL(path)
+	if err != nil {
+		return ShardCheck{}, err
+	}
+	check := ShardCheck{Path: path, Entries: len(entries), WrongDays: make(map[string]int)}
+	date, ok := shard.ParseShardDate(path)
+	check.Undated = !ok
+	want := date.Format("2006-01-02")
+	for _, e := range entries {
+		day := e.Timestamp.UTC().Format("2006-01-02")
+		if ok && day == want {
+			continue
+		}
+		check.Misplaced++
+		check.WrongDays[day]++
+	}
+	return check, nil
+}
+
+// CompactShards compacts shard files using up to workers goroutines. Each shard is
+// an independent file, so days compact in parallel. Results keep the order of paths.
+// A day listed in both forms is compacted once, into its plain .jsonl file.
+func CompactShards(paths []string, workers int, dedup types.DedupKey, opts ShardOptions) ([]CompactResult, error) {
+	listed := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		listed[p] = true
+	}
+	days := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if strings.HasSuffix(p, ".gz") && listed[otherForm(p)] {
+			continue
+		}
+		days = append(days, p)
+	}
+	paths = days
+
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+
+	results := make([]CompactResult, len(paths))
+	errs := make([]error, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = CompactShard(paths[i], dedup, opts)
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", paths[i], err)
+		}
+	}
+	return results, nil
+}
+
+// lockShard locks the day of a shard file against other writers until the
+// returned function is called. The lock file, <day>.lock next to the shard,
+// covers both the .jsonl and .jsonl.gz forms of the day.
+func lockShard(path string) (func(), error) {
+	base := strings.TrimSuffix(strings.TrimSuffix(path, ".gz"), ".jsonl")
+	return lockFile(base + ".lock")
+}
+
 func ensureDir(path string) error {
 	dir := filepath.Dir(path)
 	if dir == "." || dir == "" {
@@ -0,0 +1,621 @@
+package store
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armash/log-pipeline/internal/query"
+	"github.com/armash/log-pipeline/internal/shard"
+	"github.com/armash/log-pipeline/internal/types"
+)
+
+// entryAt is an INFO entry at 2026-02-<day> hour:min UTC.
+func entryAt(day, hour, min int, msg string) types.LogEntry {
+	return types.LogEntry{Timestamp: time.Date(2026, 2, day, hour, min, 0, 0, time.UTC), Level: "INFO", Message: msg}
+}
+
+func TestLoadJSONLKeyCompat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	legacy := `{"Timestamp":"2026-02-08T10:00:00Z","Level":"INFO","Message":"legacy"}` + "\n" +
+		`{"message":"reordered","level":"WARN","timestamp":"2026-02-08T10:00:00Z"}` + "\n"
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	entry := types.LogEntry{Timestamp: time.Date(2026, 2, 8, 10, 0, 1, 0, time.UTC), Level: "ERROR", Message: "current"}
+	if err := AppendJSONL(path, []types.LogEntry{entry}); err != nil {
+		t.Fatalf("AppendJSONL() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !strings.Contains(string(data), `{"timestamp":"2026-02-08T10:00:01Z","level":"ERROR","message":"current"}`) {
+		t.Errorf("AppendJSONL() wrote %q, want lowercase keys", data)
+	}
+
+	got, err := LoadJSONL(path)
+	if err != nil {
+		t.Fatalf("LoadJSONL() error = %v", err)
+	}
+	if len(got) != 3 || got[0].Message != "legacy" || got[1].Message != "reordered" || got[2].Message != "current" {
+		t.Errorf("LoadJSONL() = %+v, want legacy, reordered and current entries", got)
+	}
+}
+
+func TestAppendShardsSorted(t *testing.T) {
+	dir := t.TempDir()
+	if err := AppendShardsSorted(dir, []types.LogEntry{entryAt(8, 10, 5, "b"), entryAt(8, 10, 1, "a")}, ShardOptions{}); err != nil {
+		t.Fatalf("AppendShardsSorted() error = %v", err)
+	}
+	if err := AppendShardsSorted(dir, []types.LogEntry{entryAt(8, 10, 9, "d")}, ShardOptions{}); err != nil {
+		t.Fatalf("AppendShardsSorted() error = %v", err)
+	}
+	if err := AppendShardsSorted(dir, []types.LogEntry{entryAt(8, 10, 7, "c"), entryAt(8, 10, 0, "first")}, ShardOptions{}); err != nil {
+		t.Fatalf("AppendShardsSorted() error = %v", err)
+	}
+
+	got, err := LoadJSONL(filepath.Join(dir, "2026-02-08.jsonl"))
+	if err != nil {
+		t.Fatalf("LoadJSONL() error = %v", err)
+	}
+	want := []string{"first", "a", "b", "c", "d"}
+	if len(got) != len(want) {
+		t.Fatalf("shard has %d entries, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].Message != w {
+			t.Errorf("entry %d = %q, want %q", i, got[i].Message, w)
+		}
+	}
+}
+
+func TestImportShardsRerun(t *testing.T) {
+	dir := t.TempDir()
+	if err := AppendShards(dir, []types.LogEntry{entryAt(8, 10, 0, "existing")}, ShardOptions{}); err != nil {
+		t.Fatalf("AppendShards() error = %v", err)
+	}
+	batch := []types.LogEntry{entryAt(8, 10, 0, "existing"), entryAt(8, 10, 1, "new"), entryAt(8, 10, 1, "new"), entryAt(9, 10, 0, "next day")}
+
+	got, err := ImportShards(dir, batch, nil, ShardOptions{})
+	if err != nil {
+		t.Fatalf("ImportShards() error = %v", err)
+	}
+	want := []ImportResult{{Day: "2026-02-08", Added: 1, Skipped: 2}, {Day: "2026-02-09", Added: 1}}
+	if len(got) != len(want) {
+		t.Fatalf("ImportShards() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("result %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	again, err := ImportShards(dir, batch, nil, ShardOptions{})
+	if err != nil {
+		t.Fatalf("second ImportShards() error = %v", err)
+	}
+	for _, r := range again {
+		if r.Added != 0 {
+			t.Errorf("re-run added %d entries to %s, want 0", r.Added, r.Day)
+		}
+	}
+	entries, err := LoadJSONL(filepath.Join(dir, "2026-02-08.jsonl"))
+	if err != nil {
+		t.Fatalf("LoadJSONL() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("shard has %d entries, want 2", len(entries))
+	}
+}
+
+func TestLastShardEntry(t *testing.T) {
+	dir := t.TempDir()
+	long := strings.Repeat("x", 10000)
+	data := `{"timestamp":"2026-02-08T10:00:00Z","level":"INFO","message":"a"}` + "\n" +
+		`{"timestamp":"2026-02-08T10:05:00Z","level":"INFO","message":"` + long + `"}` + "\n" +
+		`not json` + "\n\n"
+	for _, name := range []string{"2026-02-08.jsonl", "2026-02-08.jsonl.gz"} {
+		path := filepath.Join(dir, name)
+		if strings.HasSuffix(name, ".gz") {
+			if err := appendLines(path, [][]byte{[]byte(strings.TrimSuffix(data, "\n\n"))}); err != nil {
+				t.Fatalf("appendLines() error = %v", err)
+			}
+		} else if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		got, ok, err := lastShardEntry(path)
+		if err != nil || !ok || got.Message != long {
+			t.Errorf("lastShardEntry(%s) = %q, %v, %v; want the long entry before the malformed line", name, got.Message, ok, err)
+		}
+	}
+	if _, ok, err := lastShardEntry(filepath.Join(dir, "missing.jsonl")); ok || err != nil {
+		t.Errorf("lastShardEntry(missing) = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestCompactShardDedupKey(t *testing.T) {
+	dedup, err := types.ParseDedupKey("level,message")
+	if err != nil {
+		t.Fatalf("ParseDedupKey() error = %v", err)
+	}
+	if _, err := types.ParseDedupKey("message,host"); err == nil {
+		t.Errorf("ParseDedupKey() with unknown field: want error")
+	}
+
+	path := filepath.Join(t.TempDir(), "2026-02-08.jsonl")
+	entries := []types.LogEntry{
+		{Timestamp: time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC), Level: "WARN", Message: "disk full"},
+		{Timestamp: time.Date(2026, 2, 8, 10, 5, 0, 0, time.UTC), Level: "WARN", Message: "disk full"},
+		{Timestamp: time.Date(2026, 2, 8, 10, 6, 0, 0, time.UTC), Level: "ERROR", Message: "disk full"},
+	}
+	if err := AppendJSONL(path, entries); err != nil {
+		t.Fatalf("AppendJSONL() error = %v", err)
+	}
+	res, err := CompactShard(path, dedup, ShardOptions{})
+	if err != nil {
+		t.Fatalf("CompactShard() error = %v", err)
+	}
+	if res.EntriesAfter != 2 {
+		t.Errorf("EntriesAfter = %d, want 2 (timestamp ignored by the dedup key)", res.EntriesAfter)
+	}
+
+	byHost, err := types.ParseDedupKey("message,field.host")
+	if err != nil {
+		t.Fatalf("ParseDedupKey() error = %v", err)
+	}
+	a := types.LogEntry{Message: "disk full", Fields: map[string]string{"host": "a"}}
+	b := types.LogEntry{Message: "disk full", Fields: map[string]string{"host": "b"}}
+	if byHost.Key(a) == byHost.Key(b) {
+		t.Errorf("Key() equal for different field.host values")
+	}
+}
+
+func TestCompactShardKeepsMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "2026-02-08.jsonl")
+	data := `{"timestamp":"2026-02-08T10:05:00Z","level":"INFO","message":"b"}` + "\n" +
+		`not json` + "\n" +
+		`{"timestamp":"2026-02-08T10:00:00Z","level":"INFO","message":"a"}` + "\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	res, err := CompactShard(path, nil, ShardOptions{})
+	if err != nil {
+		t.Fatalf("CompactShard() error = %v", err)
+	}
+	if res.Malformed != 1 || res.EntriesAfter != 2 {
+		t.Errorf("CompactShard() = %+v, want 2 entries and 1 malformed line", res)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(got)), "\n")
+	if len(lines) != 3 || lines[0] != "not json" || !strings.Contains(lines[1], `"message":"a"`) {
+		t.Errorf("compacted shard = %q, want the malformed line kept ahead of the sorted entries", got)
+	}
+}
+
+func TestVerifyShard(t *testing.T) {
+	dir := t.TempDir()
+	dated := filepath.Join(dir, "2026-02-08.jsonl")
+	undated := filepath.Join(dir, "backup.jsonl")
+	if err := AppendJSONL(dated, []types.LogEntry{entryAt(8, 23, 30, "m"), entryAt(9, 23, 30, "m"), entryAt(8, 23, 30, "m")}); err != nil {
+		t.Fatalf("AppendJSONL() error = %v", err)
+	}
+	if err := AppendJSONL(undated, []types.LogEntry{entryAt(8, 23, 30, "m")}); err != nil {
+		t.Fatalf("AppendJSONL() error = %v", err)
+	}
+
+	got, err := VerifyShard(dated)
+	if err != nil {
+		t.Fatalf("VerifyShard() error = %v", err)
+	}
+	if got.Entries != 3 || got.Misplaced != 1 || got.WrongDays["2026-02-09"] != 1 || got.Undated {
+		t.Errorf("VerifyShard(dated) = %+v, want 1 of 3 misplaced on 2026-02-09", got)
+	}
+	got, err = VerifyShard(undated)
+	if err != nil {
+		t.Fatalf("VerifyShard() error = %v", err)
+	}
+	if !got.Undated || got.Misplaced != 1 {
+		t.Errorf("VerifyShard(undated) = %+v, want undated with 1 misplaced", got)
+	}
+}
+
+func TestGzipShards(t *testing.T) {
+	dir := t.TempDir()
+	gz := ShardOptions{Compress: true}
+	if err := AppendShards(dir, []types.LogEntry{entryAt(8, 10, 1, "a"), entryAt(8, 10, 2, "b")}, gz); err != nil {
+		t.Fatalf("AppendShards() error = %v", err)
+	}
+	// A second append adds a gzip member; an out-of-order sorted append rewrites.
+	if err := AppendShards(dir, []types.LogEntry{entryAt(8, 10, 3, "c"), entryAt(8, 10, 3, "c")}, gz); err != nil {
+		t.Fatalf("AppendShards() error = %v", err)
+	}
+	if err := AppendShardsSorted(dir, []types.LogEntry{entryAt(8, 10, 0, "first")}, gz); err != nil {
+		t.Fatalf("AppendShardsSorted() error = %v", err)
+	}
+
+	paths, err := shard.AllShardPaths(dir)
+	if err != nil {
+		t.Fatalf("AllShardPaths() error = %v", err)
+	}
+	if len(paths) != 1 || filepath.Base(paths[0]) != "2026-02-08.jsonl.gz" {
+		t.Fatalf("AllShardPaths() = %v, want one .jsonl.gz shard", paths)
+	}
+	if _, ok := shard.ParseShardDate(paths[0]); !ok {
+		t.Errorf("ParseShardDate(%q) not recognized", paths[0])
+	}
+	res, err := CompactShard(paths[0], nil, ShardOptions{})
+	if err != nil {
+		t.Fatalf("CompactShard() error = %v", err)
+	}
+	if res.EntriesBefore != 5 || res.EntriesAfter != 4 {
+		t.Errorf("CompactShard() = %+v, want 5 -> 4 entries", res)
+	}
+
+	got, _, err := LoadJSONLFromMany(shard.ShardPathsForRange(dir, entryAt(8, 10, 0, "").Timestamp, entryAt(8, 10, 5, "").Timestamp), nil)
+	if err != nil {
+		t.Fatalf("LoadJSONLFromMany() error = %v", err)
+	}
+	want := []string{"first", "a", "b", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("loaded %d entries, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].Message != w {
+			t.Errorf("entry %d = %q, want %q", i, got[i].Message, w)
+		}
+	}
+}
+
+func TestShardTwins(t *testing.T) {
+	dir := t.TempDir()
+	if err := AppendShards(dir, []types.LogEntry{entryAt(8, 10, 1, "a")}, ShardOptions{}); err != nil {
+		t.Fatalf("AppendShards() error = %v", err)
+	}
+	// An existing plain shard keeps receiving appends after compression is switched on.
+	if err := AppendShards(dir, []types.LogEntry{entryAt(8, 10, 2, "b")}, ShardOptions{Compress: true}); err != nil {
+		t.Fatalf("AppendShards() error = %v", err)
+	}
+	plain := filepath.Join(dir, "2026-02-08.jsonl")
+	if err := appendLines(plain+".gz", [][]byte{[]byte(`{"timestamp":"2026-02-08T10:00:00Z","level":"INFO","message":"legacy"}`)}); err != nil {
+		t.Fatalf("appendLines() error = %v", err)
+	}
+
+	paths, err := shard.AllShardPaths(dir)
+	if err != nil {
+		t.Fatalf("AllShardPaths() error = %v", err)
+	}
+	if _, err := CompactShards(paths, 1, nil, ShardOptions{}); err != nil {
+		t.Fatalf("CompactShards() error = %v", err)
+	}
+	paths, err = shard.AllShardPaths(dir)
+	if err != nil {
+		t.Fatalf("AllShardPaths() error = %v", err)
+	}
+	if len(paths) != 1 || paths[0] != plain {
+		t.Fatalf("AllShardPaths() after compact = %v, want only %s", paths, plain)
+	}
+	got, err := LoadJSONL(plain)
+	if err != nil {
+		t.Fatalf("LoadJSONL() error = %v", err)
+	}
+	if len(got) != 3 || got[0].Message != "legacy" {
+		t.Errorf("compacted shard = %+v, want legacy, a, b", got)
+	}
+}
+
+func TestJSONLStore(t *testing.T) {
+	var st Store = NewJSONL(filepath.Join(t.TempDir(), "store.jsonl"))
+	if err := st.Append([]types.LogEntry{entryAt(8, 9, 0, "m"), entryAt(8, 10, 0, "m")}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if err := st.Append([]types.LogEntry{entryAt(8, 11, 0, "m"), entryAt(8, 12, 0, "m")}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	all, err := st.Load()
+	if err != nil || len(all) != 4 {
+		t.Fatalf("Load() = %d entries, %v; want 4", len(all), err)
+	}
+	for i, e := range all {
+		if e.Timestamp.Hour() != 9+i {
+			t.Errorf("entry %d at %v, want stored order", i, e.Timestamp)
+		}
+	}
+}
+
+func TestLoadShardsFromS3(t *testing.T) {
+	objects := map[string]string{
+		"/logs/prod/2026-02-08.jsonl":      `{"timestamp":"2026-02-08T10:00:00Z","level":"INFO","message":"one"}` + "\n",
+		"/logs/prod/2026-02-09.jsonl":      `{"timestamp":"2026-02-09T10:00:00Z","level":"ERROR","message":"two"}` + "\n",
+		"/logs/prod/archive/2026-02.jsonl": "ignored\n",
+	}
+	denyList := false
+	var misses int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("list-type") == "2" {
+			if denyList {
+				http.Error(w, "AccessDenied", http.StatusForbidden)
+				return
+			}
+			var b strings.Builder
+			b.WriteString("<ListBucketResult>")
+			for _, k := range []string{"prod/2026-02-08.jsonl", "prod/2026-02-09.jsonl", "prod/archive/2026-02.jsonl", "prod/notes.txt"} {
+				b.WriteString("<Contents><Key>" + k + "</Key></Contents>")
+			}
+			b.WriteString("</ListBucketResult>")
+			w.Write([]byte(b.String()))
+			return
+		}
+		body, ok := objects[r.URL.Path]
+		if !ok {
+			misses++
+			// Without s3:ListBucket, S3 answers 403 for a missing key.
+			if denyList {
+				http.Error(w, "AccessDenied", http.StatusForbidden)
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	t.Setenv("AWS_ENDPOINT_URL_S3", srv.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+
+	paths, err := shard.AllShardPaths("s3://logs/prod")
+	if err != nil {
+		t.Fatalf("AllShardPaths() error = %v", err)
+	}
+	if len(paths) != 2 || paths[0] != "s3://logs/prod/2026-02-08.jsonl" {
+		t.Fatalf("AllShardPaths() = %v", paths)
+	}
+	entries, counts, err := LoadJSONLFromMany(paths, nil)
+	if err != nil {
+		t.Fatalf("LoadJSONLFromMany() error = %v", err)
+	}
+	if len(entries) != 2 || counts["s3://logs/prod/2026-02-09.jsonl"] != 1 {
+		t.Fatalf("LoadJSONLFromMany() = %v, %v", entries, counts)
+	}
+
+	// Range paths come from one listing, so missing days and forms are never requested.
+	from, to := time.Date(2026, 2, 9, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	ranged := shard.ShardPathsForRange("s3://logs/prod/", from, to)
+	if len(ranged) != 1 || ranged[0] != "s3://logs/prod/2026-02-09.jsonl" {
+		t.Fatalf("ShardPathsForRange() = %v", ranged)
+	}
+	entries, _, err = LoadJSONLFromMany(ranged, nil)
+	if err != nil {
+		t.Fatalf("LoadJSONLFromMany(range) error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Message != "two" || misses != 0 {
+		t.Fatalf("LoadJSONLFromMany(range) = %v with %d missing requests", entries, misses)
+	}
+
+	// With the listing refused, probes that come back 403 count as missing.
+	denyList = true
+	ranged = shard.ShardPathsForRange("s3://logs/prod/", from, to)
+	if len(ranged) != 1 || ranged[0] != "s3://logs/prod/2026-02-09.jsonl" {
+		t.Fatalf("ShardPathsForRange(no list) = %v", ranged)
+	}
+}
+
+func TestBloomSkipsShards(t *testing.T) {
+	dir := t.TempDir()
+	day1 := time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	if err := AppendShards(dir, []types.LogEntry{
+		{Timestamp: day1, Level: "ERROR", Message: "Payment gateway timeout"},
+		{Timestamp: day2, Level: "INFO", Message: "user login ok"},
+	}, ShardOptions{Bloom: true}); err != nil {
+		t.Fatalf("AppendShards() error = %v", err)
+	}
+	paths, err := shard.AllShardPaths(dir)
+	if err != nil {
+		t.Fatalf("AllShardPaths() error = %v", err)
+	}
+
+	kept, skipped := PruneShards(paths, query.Filters{Search: []string{"GATEWAY"}})
+	if skipped != 1 || len(kept) != 1 || !strings.HasSuffix(kept[0], "2026-02-08.jsonl") {
+		t.Fatalf("PruneShards(gateway) = %v, %d", kept, skipped)
+	}
+	if _, skipped := PruneShards(paths, query.Filters{Search: []string{"ok"}}); skipped != 0 {
+		t.Fatalf("short terms must not skip shards, skipped %d", skipped)
+	}
+	or := query.Filters{Or: []query.Filters{{Search: []string{"gateway"}}, {Search: []string{"login"}}}}
+	if _, skipped := PruneShards(paths, or); skipped != 0 {
+		t.Fatalf("PruneShards(or) skipped %d", skipped)
+	}
+
+	// Existing filters are kept current even without Bloom.
+	if err := AppendShards(dir, []types.LogEntry{{Timestamp: day2, Level: "ERROR", Message: "gateway down"}}, ShardOptions{}); err != nil {
+		t.Fatalf("AppendShards() error = %v", err)
+	}
+	if _, skipped := PruneShards(paths, query.Filters{Search: []string{"gateway"}}); skipped != 0 {
+		t.Fatalf("appended term was skipped, skipped %d", skipped)
+	}
+
+	// A shard changed behind the filter's back is read rather than trusted.
+	f, err := os.OpenFile(paths[0], os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	f.WriteString(`{"timestamp":"2026-02-08T11:00:00Z","level":"INFO","message":"cache warmup"}` + "\n")
+	f.Close()
+	if !ShardMayMatch(paths[0], query.Filters{Search: []string{"warmup"}}) {
+		t.Fatal("stale bloom filter was trusted")
+	}
+}
+
+func TestValidateJSONL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.jsonl")
+	data := strings.Join([]string{
+		`{"timestamp":"2026-02-08T10:00:00Z","level":"INFO","message":"ok"}`,
+		`{"timestamp":"yesterday","level":"INFO","message":"bad"}`,
+		``,
+		`not json`,
+		`{"message":"no time"}`,
+		`{"timestamp":"2026-02-08T10:00:01Z","level":"WARN","message":"ok too"}`,
+	}, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := ValidateJSONL(path, 2)
+	if err != nil {
+		t.Fatalf("ValidateJSONL() error = %v", err)
+	}
+	if res.Lines != 5 || res.Valid != 2 || res.Invalid != 3 {
+		t.Fatalf("ValidateJSONL() = %+v, want 5 lines, 2 valid, 3 invalid", res)
+	}
+	want := []JSONLLineError{
+		{Line: 2, Reason: `invalid timestamp "yesterday"`},
+		{Line: 4, Reason: "not valid JSON"},
+	}
+	if len(res.Errors) != len(want) || res.Errors[0] != want[0] || res.Errors[1] != want[1] {
+		t.Fatalf("Errors = %+v, want %+v", res.Errors, want)
+	}
+}
+
+func TestLoadProgress(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.jsonl")
+	b := filepath.Join(dir, "b.jsonl")
+	ts := time.Date(2026, 2, 8, 10, 0, 0, 0, time.UTC)
+	if err := AppendJSONL(a, []types.LogEntry{{Timestamp: ts, Level: "INFO", Message: "a1"}, {Timestamp: ts, Level: "INFO", Message: "a2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendJSONL(b, []types.LogEntry{{Timestamp: ts, Level: "WARN", Message: "b1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls [][3]int
+	progress := func(done, total, entries int) {
+		calls = append(calls, [3]int{done, total, entries})
+	}
+	if _, _, err := LoadJSONLFromMany([]string{a, filepath.Join(dir, "missing.jsonl"), b}, progress); err != nil {
+		t.Fatalf("LoadJSONLFromMany() error = %v", err)
+	}
+	want := [][3]int{{1, 3, 2}, {2, 3, 2}, {3, 3, 3}}
+	if len(calls) != len(want) {
+		t.Fatalf("progress calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("progress calls = %v, want %v", calls, want)
+			break
+		}
+	}
+}
+
+func TestDropDuplicatesAcrossShards(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.jsonl")
+	b := filepath.Join(dir, "b.jsonl")
+	if err := AppendJSONL(a, []types.LogEntry{entryAt(8, 10, 0, "first"), entryAt(8, 10, 1, "overlap"), entryAt(8, 10, 2, "a only")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendJSONL(b, []types.LogEntry{entryAt(8, 10, 1, "overlap"), entryAt(8, 10, 3, "b only"), entryAt(8, 10, 3, "b only")}); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, _, err := LoadJSONLFromMany([]string{a, b}, nil)
+	if err != nil {
+		t.Fatalf("LoadJSONLFromMany() error = %v", err)
+	}
+	if len(loaded) != 6 {
+		t.Fatalf("loaded %d entries, want all 6 copies", len(loaded))
+	}
+	got, dropped := DropDuplicates(loaded, nil)
+	if dropped != 2 {
+		t.Errorf("dropped = %d, want 2", dropped)
+	}
+	var msgs []string
+	for _, e := range got {
+		msgs = append(msgs, e.Message)
+	}
+	if want := []string{"first", "overlap", "a only", "b only"}; strings.Join(msgs, ",") != strings.Join(want, ",") {
+		t.Errorf("messages = %v, want %v", msgs, want)
+	}
+}
+
+func TestLoadJSONLFromManyDescDedup(t *testing.T) {
+	dir := t.TempDir()
+	// Names sort newest-first as c, b, a; b is a re-imported copy of c.
+	a := filepath.Join(dir, "a.jsonl")
+	b := filepath.Join(dir, "b.jsonl")
+	c := filepath.Join(dir, "c.jsonl")
+	copies := []types.LogEntry{entryAt(9, 10, 1, "x1"), entryAt(9, 10, 2, "x2")}
+	for _, p := range []string{b, c} {
+		if err := AppendJSONL(p, copies); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AppendJSONL(a, []types.LogEntry{entryAt(8, 10, 0, "older")}); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, res, err := LoadJSONLFromManyDesc([]string{a, b, c}, 3, nil, false, nil, nil)
+	if err != nil {
+		t.Fatalf("LoadJSONLFromManyDesc() error = %v", err)
+	}
+	if len(loaded) != 4 || res.Duplicates != 0 || !res.Stopped {
+		t.Errorf("without dedup: loaded %d, %+v; want the 4 copies from c and b and a stop before a", len(loaded), res)
+	}
+
+	loaded, res, err = LoadJSONLFromManyDesc([]string{a, b, c}, 3, nil, true, nil, nil)
+	if err != nil {
+		t.Fatalf("LoadJSONLFromManyDesc() error = %v", err)
+	}
+	var msgs []string
+	for _, e := range loaded {
+		msgs = append(msgs, e.Message)
+	}
+	if want := "x2,x1,older"; strings.Join(msgs, ",") != want || res.Duplicates != 2 || res.Stopped {
+		t.Errorf("with dedup: messages = %v, %+v; want %s, 2 dropped and every shard read", msgs, res, want)
+	}
+	if res.Counts[b] != 2 || res.Counts[a] != 1 {
+		t.Errorf("counts = %v, want every entry read per shard", res.Counts)
+	}
+}
+
+func TestSampleJSONL(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "store.jsonl")
+	header := "════\nLog ingestion run\nMode       : append (JSONL)\n════\n"
+	data := header + `{"timestamp":"2026-02-08T10:00:00Z","level":"INFO","message":"ok"}` + "\n" + "not json\n"
+	if err := os.WriteFile(good, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := SampleJSONL(good, 1)
+	if err != nil {
+		t.Fatalf("SampleJSONL() error = %v", err)
+	}
+	if res.Lines != 1 || res.Valid != 1 {
+		t.Errorf("SampleJSONL(header + entry) = %+v, want the header skipped and 1 valid line", res)
+	}
+
+	binary := filepath.Join(dir, "image.png")
+	if err := os.WriteFile(binary, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err = SampleJSONL(binary, 5)
+	if err != nil {
+		t.Fatalf("SampleJSONL() error = %v", err)
+	}
+	if res.Valid != 0 || res.Invalid == 0 || res.Errors[0].Reason != "binary data, not text" {
+		t.Errorf("SampleJSONL(binary) = %+v, want binary lines rejected", res)
+	}
+
+	res, err = SampleJSONL(filepath.Join(dir, "missing.jsonl"), 5)
+	if err != nil || res.Lines != 0 {
+		t.Errorf("SampleJSONL(missing) = %+v, %v; want an empty sample", res, err)
+	}
+}
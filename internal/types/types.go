@@ -1,10 +1,152 @@
 package types
 
-import "time"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
-// LogEntry represents a single log line entry
+// DedupKey lists the entry fields that identify duplicate entries, in order:
+// timestamp, level, message, or field.<key> for one of the entry's Fields. It
+// is used by snapshot merges, shard compaction/import, snapshot+shard loads and
+// replay de-duplication. The zero value is the default timestamp,level,message
+// tuple.
+type DedupKey []string
+
+var defaultDedupKey = DedupKey{"timestamp", "level", "message"}
+
+// ParseDedupKey parses a comma-separated --dedup-key spec; "" gives the default.
+func ParseDedupKey(spec string) (DedupKey, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	var fields DedupKey
+	for _, part := range strings.Split(spec, ",") {
+		name := strings.TrimSpace(part)
+		lower := strings.ToLower(name)
+		switch {
+		case lower == "timestamp", lower == "level", lower == "message":
+			name = lower
+		case strings.HasPrefix(lower, "field.") && len(name) > len("field."):
+			name = "field." + name[len("field."):]
+		default:
+			return nil, fmt.Errorf("unknown dedup field %q (use timestamp, level, message, field.<key>)", part)
+		}
+		fields = append(fields, name)
+	}
+	return fields, nil
+}
+
+// Key returns the identity of e under k.
+func (k DedupKey) Key(e LogEntry) string {
+	if len(k) == 0 {
+		k = defaultDedupKey
+	}
+	var b strings.Builder
+	for i, name := range k {
+		if i > 0 {
+			b.WriteByte('|')
+		}
+		switch name {
+		case "timestamp":
+			b.WriteString(e.Timestamp.Format(time.RFC3339Nano))
+		case "level":
+			b.WriteString(e.Level)
+		case "message":
+			b.WriteString(e.Message)
+		default:
+			b.WriteString(e.Fields[strings.TrimPrefix(name, "field.")])
+		}
+	}
+	return b.String()
+}
+
+// LogEntry represents a single log line entry.
+// JSON keys are lowercase to match the ingest field names; decoding is
+// case-insensitive, so stores written with the old capitalized keys still load.
 type LogEntry struct {
-	Timestamp time.Time
-	Level     string // ERROR, WARN, INFO, DEBUG
-	Message   string
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"` // ERROR, WARN, INFO, DEBUG
+	Message   string    `json:"message"`
+	// Fields holds the other keys of a JSON or logfmt line (user_id, trace_id,
+	// ...), with non-string JSON values in their JSON text form. Plain and glog
+	// lines leave it nil.
+	Fields map[string]string `json:"fields,omitempty"`
+	// Raw is the original input line, kept only when reading with --keep-raw.
+	Raw string `json:"raw,omitempty"`
+	// IngestedAt is when the pipeline parsed the entry, set only with --stamp-ingest.
+	IngestedAt time.Time `json:"ingestedAt,omitempty"`
+}
+
+// MarshalJSON writes keys in a fixed, documented order (timestamp, level, message,
+// then fields, ingestedAt and raw when set) so stored JSONL stays deterministic and greppable by prefix regardless of struct layout.
+func (e LogEntry) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	if err := writeKey(&b, "timestamp", e.Timestamp, true); err != nil {
+		return nil, err
+	}
+	if err := writeKey(&b, "level", e.Level, false); err != nil {
+		return nil, err
+	}
+	if err := writeKey(&b, "message", e.Message, false); err != nil {
+		return nil, err
+	}
+	if len(e.Fields) > 0 {
+		if err := writeKey(&b, "fields", e.Fields, false); err != nil {
+			return nil, err
+		}
+	}
+	if !e.IngestedAt.IsZero() {
+		if err := writeKey(&b, "ingestedAt", e.IngestedAt, false); err != nil {
+			return nil, err
+		}
+	}
+	if e.Raw != "" {
+		if err := writeKey(&b, "raw", e.Raw, false); err != nil {
+			return nil, err
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func writeKey(b *bytes.Buffer, key string, value interface{}, first bool) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if !first {
+		b.WriteByte(',')
+	}
+	b.WriteByte('"')
+	b.WriteString(key)
+	b.WriteString(`":`)
+	b.Write(data)
+	return nil
+}
+
+// MessageWithFields returns the message followed by " [user_id=42 trace_id=abc]"
+// for keys of e.Fields, in the order given. Keys the entry lacks (or has empty)
+// are left out, and values with spaces, quotes or "=" are quoted. It is for
+// display only; the stored message never carries the suffix.
+func (e LogEntry) MessageWithFields(keys []string) string {
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		val := e.Fields[key]
+		if val == "" {
+			continue
+		}
+		if strings.ContainsAny(val, " \t\"=") {
+			val = strconv.Quote(val)
+		}
+		parts = append(parts, key+"="+val)
+	}
+	if len(parts) == 0 {
+		return e.Message
+	}
+	return e.Message + " [" + strings.Join(parts, " ") + "]"
 }